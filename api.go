@@ -3,6 +3,7 @@ package main
 import (
 	"github.com/NeuralNexusDev/neuralnexus-api/modules/twitch"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
 	"github.com/rs/cors"
 	"log"
 	"net"
@@ -13,11 +14,15 @@ import (
 
 	mw "github.com/NeuralNexusDev/neuralnexus-api/middleware"
 	"github.com/NeuralNexusDev/neuralnexus-api/modules/auth"
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/auth/linking"
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/auth/oidc"
+	perms "github.com/NeuralNexusDev/neuralnexus-api/modules/auth/permissions"
 	authroutes "github.com/NeuralNexusDev/neuralnexus-api/modules/auth/routes"
 	bng "github.com/NeuralNexusDev/neuralnexus-api/modules/bee_name_generator"
 	"github.com/NeuralNexusDev/neuralnexus-api/modules/database"
 	ds "github.com/NeuralNexusDev/neuralnexus-api/modules/datastore"
 	nds "github.com/NeuralNexusDev/neuralnexus-api/modules/datastore/numbers"
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/email"
 	gss "github.com/NeuralNexusDev/neuralnexus-api/modules/game_server_status"
 	mcs "github.com/NeuralNexusDev/neuralnexus-api/modules/mcstatus"
 	petpics "github.com/NeuralNexusDev/neuralnexus-api/modules/pet_pictures"
@@ -40,106 +45,180 @@ func NewAPIServer(address string, usingUDS bool) *APIServer {
 }
 
 // ApplyRoutes - Apply the routes to the API server
-func ApplyRoutes(mux *http.ServeMux, nndb *pgxpool.Pool, session auth.SessionService, authStore auth.Store, rateLimit auth.RateLimitService) *http.ServeMux {
-	mwAuth := mw.Auth(session)
+func ApplyRoutes(router *mw.Router, nndb *pgxpool.Pool, rdb *redis.Client, session auth.SessionService, signingKeys auth.SigningKeyService, apiKeys auth.APIKeyService, roles auth.RoleService, oauthTokens auth.OAuthTokenService, authStore auth.Store, rateLimit auth.RateLimitService, mailer email.Sender) *mw.Router {
 
 	// --------------- Auth ---------------
 	account := auth.NewAccountService(authStore)
 	user := auth.NewUserService(authStore)
+	linkCodes := auth.NewLinkCodeService(authStore)
+	verification := auth.NewVerificationService(authStore, mailer)
+	password := auth.NewPasswordService(authStore, session, mailer)
+	lockout := auth.NewLockoutService(authStore, mailer)
+	mfa := auth.NewMFAService(authStore)
+	webAuthn := auth.NewWebAuthnService(authStore)
+	serviceAccounts := auth.NewServiceAccountService(authStore)
 
 	loginRateLimit := mw.RateLimitMiddleware(rateLimit, "login", 5, 5)
 
-	mux.Handle("POST /api/v1/auth/login", loginRateLimit(authroutes.LoginHandler(account, session)))
-	mux.Handle("POST /api/v1/auth/logout", loginRateLimit(mwAuth(authroutes.LogoutHandler(session))))
-
-	mux.Handle("/api/oauth", loginRateLimit(authroutes.OAuthHandler(account, authStore.LinkAccount(), session)))
-
-	mux.Handle("GET /api/v1/users/{user_id}", mwAuth(authroutes.GetUserHandler(user)))
-	mux.Handle("GET /api/v1/users/{user_id}/permissions", mwAuth(authroutes.GetUserPermissionsHandler(user)))
-	mux.Handle("GET /api/v1/users/{platform}/{platform_id}", mwAuth(authroutes.GetUserFromPlatformHandler(user)))
-	mux.Handle("PUT /api/v1/users/{user_id}", mwAuth(authroutes.UpdateUserHandler(user)))
-	mux.Handle("PUT /api/v1/users/{platform}/{platform_id}", mwAuth(authroutes.UpdateUserFromPlatformHandler(user)))
-	// mux.HandleFunc("DELETE /api/v1/users/{user_id}", mwAuth(authroutes.DeleteUserHandler(gssService)))
+	router.Handle("GET /.well-known/jwks.json", authroutes.JWKSHandler(signingKeys))
+	router.Handle("POST /api/v1/auth/login", loginRateLimit(authroutes.LoginHandler(account, session, mfa, lockout)))
+	router.Handle("POST /api/v1/auth/refresh", loginRateLimit(authroutes.RefreshHandler(session)))
+	router.Handle("POST /api/v1/auth/login/mfa", loginRateLimit(authroutes.MFALoginHandler(account, session, mfa, lockout)))
+	router.Handle("POST /api/v1/auth/register", loginRateLimit(authroutes.RegisterHandler(account, verification)))
+	router.Handle("POST /api/v1/auth/verify-email", loginRateLimit(authroutes.VerifyEmailHandler(verification)))
+	router.Handle("POST /api/v1/auth/verify-email/resend", loginRateLimit(authroutes.ResendVerificationHandler(account, verification)))
+	router.Handle("POST /api/v1/auth/password", loginRateLimit(authroutes.ChangePasswordHandler(password)), mw.RequireFirstParty())
+	router.Handle("POST /api/v1/auth/password/forgot", loginRateLimit(authroutes.ForgotPasswordHandler(password)))
+	router.Handle("POST /api/v1/auth/password/reset", loginRateLimit(authroutes.ResetPasswordHandler(password)))
+	router.Handle("POST /api/v1/auth/mfa/totp", authroutes.EnrollTOTPHandler(account, mfa), mw.RequireFirstParty())
+	router.Handle("POST /api/v1/auth/mfa/totp/confirm", loginRateLimit(authroutes.ConfirmTOTPHandler(mfa)), mw.RequireFirstParty())
+	router.Handle("DELETE /api/v1/auth/mfa/totp", loginRateLimit(authroutes.DisableTOTPHandler(mfa)), mw.RequireFirstParty())
+	router.Handle("POST /api/v1/auth/webauthn/register/begin", authroutes.BeginWebAuthnRegistrationHandler(account, webAuthn), mw.RequireFirstParty())
+	router.Handle("POST /api/v1/auth/webauthn/register/finish", authroutes.FinishWebAuthnRegistrationHandler(account, webAuthn), mw.RequireFirstParty())
+	router.Handle("GET /api/v1/auth/webauthn/credentials", authroutes.GetWebAuthnCredentialsHandler(webAuthn), mw.RequireFirstParty())
+	router.Handle("DELETE /api/v1/auth/webauthn/credentials/{credential_id}", authroutes.DeleteWebAuthnCredentialHandler(webAuthn), mw.RequireFirstParty())
+	router.Handle("POST /api/v1/auth/webauthn/login/begin", loginRateLimit(authroutes.BeginWebAuthnLoginHandler(webAuthn)))
+	router.Handle("POST /api/v1/auth/webauthn/login/finish", loginRateLimit(authroutes.FinishWebAuthnLoginHandler(session, webAuthn, lockout)))
+	router.Handle("GET /api/v1/auth/api-keys", authroutes.GetAPIKeysHandler(apiKeys), mw.RequireFirstParty())
+	router.Handle("POST /api/v1/auth/api-keys", authroutes.CreateAPIKeyHandler(apiKeys), mw.RequireFirstParty())
+	router.Handle("DELETE /api/v1/auth/api-keys/{key_id}", authroutes.DeleteAPIKeyHandler(apiKeys), mw.RequireFirstParty())
+	router.Handle("POST /api/v1/auth/logout", loginRateLimit(authroutes.LogoutHandler(session)), mw.Require())
+
+	oauthStates := linking.NewStore(rdb)
+	router.Handle("GET /api/v1/auth/oauth/{platform}", loginRateLimit(authroutes.StartOAuthHandler(oauthStates)))
+	router.Handle("/api/oauth", loginRateLimit(authroutes.OAuthHandler(account, authStore.LinkAccount(), session, oauthTokens, lockout, oauthStates)))
+
+	router.Handle("GET /api/v1/users/{user_id}", authroutes.GetUserHandler(user), mw.Require())
+	router.Handle("GET /api/v1/users/{user_id}/permissions", authroutes.GetUserPermissionsHandler(user), mw.RequireSelfOr("user_id", perms.ScopeUsers))
+	router.Handle("GET /api/v1/users/{user_id}/links", authroutes.GetUserLinksHandler(user), mw.RequireFirstPartyOr("user_id", perms.ScopeAdminUsers))
+	router.Handle("DELETE /api/v1/users/{user_id}/links/{platform}", authroutes.DeleteUserLinkHandler(user), mw.RequireFirstPartyOr("user_id", perms.ScopeAdminUsers))
+	router.Handle("POST /api/v1/users/{user_id}/merge", authroutes.MergeUserHandler(user, session), mw.RequireFirstParty())
+	router.Handle("POST /api/v1/users/{user_id}/links/codes", authroutes.CreateUserLinkCodeHandler(linkCodes), mw.RequireFirstPartyOr("user_id", perms.ScopeAdminUsers))
+	router.Handle("POST /api/v1/links/minecraft", authroutes.MinecraftLinkHandler(linkCodes), mw.RequireAPIKey(perms.ScopeLinks(string(auth.PlatformMinecraft))))
+	router.Handle("POST /api/v1/links/minecraft/codes", authroutes.MinecraftLinkCodeHandler(linkCodes), mw.RequireAPIKey(perms.ScopeLinks(string(auth.PlatformMinecraft))))
+	router.Handle("GET /api/v1/users/{user_id}/auth-events", authroutes.GetUserAuthEventsHandler(lockout), mw.RequireFirstPartyOr("user_id", perms.ScopeAdminUsers))
+	router.Handle("POST /api/v1/users/{user_id}/unlock", authroutes.UnlockUserHandler(lockout), mw.Require(perms.ScopeAdminUsers))
+	router.Handle("GET /api/v1/users/{user_id}/sessions", authroutes.GetUserSessionsHandler(session), mw.RequireFirstPartyOr("user_id", perms.ScopeAdminUsers))
+	router.Handle("DELETE /api/v1/users/{user_id}/sessions", authroutes.DeleteUserSessionsHandler(session), mw.RequireFirstPartyOr("user_id", perms.ScopeAdminUsers))
+	router.Handle("DELETE /api/v1/users/{user_id}/sessions/{session_id}", authroutes.DeleteUserSessionHandler(session), mw.RequireFirstPartyOr("user_id", perms.ScopeAdminUsers))
+	router.Handle("GET /api/v1/users/{platform}/{platform_id}", authroutes.GetUserFromPlatformHandler(user), mw.Require(perms.ScopeAdminUsers))
+	router.Handle("PUT /api/v1/users/{user_id}", authroutes.UpdateUserHandler(user), mw.Require(perms.ScopeAdminUsers))
+	router.Handle("PUT /api/v1/users/{platform}/{platform_id}", authroutes.UpdateUserFromPlatformHandler(user), mw.Require(perms.ScopeAdminUsers))
+	// router.Handle("DELETE /api/v1/users/{user_id}", authroutes.DeleteUserHandler(gssService), mw.Require(perms.ScopeAdminUsers))
+
+	router.Handle("GET /api/v1/roles", authroutes.GetRolesHandler(roles), mw.Require(perms.ScopeAdminRoles))
+	router.Handle("POST /api/v1/roles", authroutes.CreateRoleHandler(roles), mw.Require(perms.ScopeAdminRoles))
+	router.Handle("GET /api/v1/roles/{name}", authroutes.GetRoleHandler(roles), mw.Require(perms.ScopeAdminRoles))
+	router.Handle("PUT /api/v1/roles/{name}", authroutes.UpdateRoleHandler(roles), mw.Require(perms.ScopeAdminRoles))
+	router.Handle("DELETE /api/v1/roles/{name}", authroutes.DeleteRoleHandler(roles), mw.Require(perms.ScopeAdminRoles))
+
+	router.Handle("GET /api/v1/service-accounts", authroutes.GetServiceAccountsHandler(serviceAccounts), mw.Require(perms.ScopeAdminServiceAccounts))
+	router.Handle("POST /api/v1/service-accounts", authroutes.CreateServiceAccountHandler(serviceAccounts), mw.Require(perms.ScopeAdminServiceAccounts))
+	router.Handle("GET /api/v1/service-accounts/{client_id}", authroutes.GetServiceAccountHandler(serviceAccounts), mw.Require(perms.ScopeAdminServiceAccounts))
+	router.Handle("PUT /api/v1/service-accounts/{client_id}", authroutes.UpdateServiceAccountHandler(serviceAccounts), mw.Require(perms.ScopeAdminServiceAccounts))
+	router.Handle("DELETE /api/v1/service-accounts/{client_id}", authroutes.DeleteServiceAccountHandler(serviceAccounts), mw.Require(perms.ScopeAdminServiceAccounts))
+
+	// --------------- OpenID Connect ---------------
+	oidcStore := oidc.NewStore(nndb, rdb)
+	oidcService := oidc.NewService(oidcStore, authStore, session, signingKeys, apiKeys, serviceAccounts)
+
+	router.Handle("GET /.well-known/openid-configuration", oidc.DiscoveryHandler(oidcService))
+	router.Handle("GET /api/v1/oauth/authorize", oidc.AuthorizeHandler(oidcService), mw.RequireFirstParty())
+	router.Handle("POST /api/v1/oauth/authorize/consent", oidc.ConsentHandler(oidcService), mw.RequireFirstParty())
+	router.Handle("POST /api/v1/oauth/token", loginRateLimit(oidc.TokenHandler(oidcService)))
+	router.Handle("POST /api/v1/oauth/introspect", oidc.IntrospectHandler(oidcService))
+	router.Handle("POST /api/v1/oauth/revoke", oidc.RevokeHandler(oidcService))
+	router.Handle("POST /api/v1/oauth/device_authorization", loginRateLimit(oidc.DeviceAuthorizationHandler(oidcService)))
+	router.Handle("GET /api/v1/oauth/device", loginRateLimit(oidc.DeviceConsentHandler(oidcService)), mw.RequireFirstParty())
+	router.Handle("POST /api/v1/oauth/device", loginRateLimit(oidc.DeviceDecisionHandler(oidcService)), mw.RequireFirstParty())
+	router.Handle("GET /api/v1/oauth/userinfo", oidc.UserInfoHandler(oidcService), mw.Require())
+	router.Handle("POST /api/v1/oauth/userinfo", oidc.UserInfoHandler(oidcService), mw.Require())
+	router.Handle("GET /api/v1/oauth/clients", oidc.GetClientsHandler(oidcService), mw.RequireFirstParty())
+	router.Handle("POST /api/v1/oauth/clients", oidc.RegisterClientHandler(oidcService), mw.RequireFirstParty())
+	router.Handle("DELETE /api/v1/oauth/clients/{client_id}", oidc.DeleteClientHandler(oidcService), mw.RequireFirstParty())
 
 	// --------------- Bee Name Generator ---------------
 	bngStore := bng.NewStore(database.GetDB("bee_name_generator"))
 
-	mux.Handle("GET /api/v1/bee-name-generator/name", bng.GetBeeNameHandler(bngStore))
-	mux.Handle("POST /api/v1/bee-name-generator/name/{name}", mwAuth(bng.UploadBeeNameHandler(bngStore)))
-	mux.Handle("DELETE /api/v1/bee-name-generator/name/{name}", mwAuth(bng.DeleteBeeNameHandler(bngStore)))
-	mux.Handle("POST /api/v1/bee-name-generator/suggestion/{name}", bng.SubmitBeeNameHandler(bngStore))
-	mux.Handle("GET /api/v1/bee-name-generator/suggestion", mwAuth(bng.GetBeeNameSuggestionsHandler(bngStore)))
-	mux.Handle("GET /api/v1/bee-name-generator/suggestion/{amount}", mwAuth(bng.GetBeeNameSuggestionsHandler(bngStore)))
-	mux.Handle("PUT /api/v1/bee-name-generator/suggestion/{name}", mwAuth(bng.AcceptBeeNameSuggestionHandler(bngStore)))
-	mux.Handle("DELETE /api/v1/bee-name-generator/suggestion/{name}", mwAuth(bng.RejectBeeNameSuggestionHandler(bngStore)))
+	router.Handle("GET /api/v1/bee-name-generator/name", bng.GetBeeNameHandler(bngStore))
+	router.Handle("POST /api/v1/bee-name-generator/name/{name}", bng.UploadBeeNameHandler(bngStore), mw.Require(perms.ScopeAdminBeeNameGenerator))
+	router.Handle("DELETE /api/v1/bee-name-generator/name/{name}", bng.DeleteBeeNameHandler(bngStore), mw.Require(perms.ScopeAdminBeeNameGenerator))
+	router.Handle("POST /api/v1/bee-name-generator/suggestion/{name}", bng.SubmitBeeNameHandler(bngStore))
+	router.Handle("GET /api/v1/bee-name-generator/suggestion", bng.GetBeeNameSuggestionsHandler(bngStore), mw.Require(perms.ScopeAdminBeeNameGenerator))
+	router.Handle("GET /api/v1/bee-name-generator/suggestion/{amount}", bng.GetBeeNameSuggestionsHandler(bngStore), mw.Require(perms.ScopeAdminBeeNameGenerator))
+	router.Handle("PUT /api/v1/bee-name-generator/suggestion/{name}", bng.AcceptBeeNameSuggestionHandler(bngStore), mw.Require(perms.ScopeAdminBeeNameGenerator))
+	router.Handle("DELETE /api/v1/bee-name-generator/suggestion/{name}", bng.RejectBeeNameSuggestionHandler(bngStore), mw.Require(perms.ScopeAdminBeeNameGenerator))
 
 	// --------------- Data Store ---------------
 	dsStore := ds.NewStore(nndb)
 	dsService := ds.NewService(dsStore)
 
-	mux.Handle("POST /api/v1/datastore", mwAuth(ds.CreateDataStoreHandler(dsService)))
-	mux.Handle("GET /api/v1/datastore", ds.ReadDataStoreHandler(dsService))
-	mux.Handle("PUT /api/v1/datastore", mwAuth(ds.UpdateDataStoreHandler(dsService)))
-	mux.Handle("DELETE /api/v1/datastore", mwAuth(ds.DeleteDataStoreHandler(dsService)))
+	router.Handle("POST /api/v1/datastore", ds.CreateDataStoreHandler(dsService), mw.Require(perms.ScopeAdminDataStore))
+	router.Handle("GET /api/v1/datastore", ds.ReadDataStoreHandler(dsService))
+	router.Handle("PUT /api/v1/datastore", ds.UpdateDataStoreHandler(dsService), mw.Require(perms.ScopeAdminDataStore))
+	router.Handle("DELETE /api/v1/datastore", ds.DeleteDataStoreHandler(dsService), mw.Require(perms.ScopeAdminDataStore))
 
 	// --------------- Numbers Data Store ---------------
 	nStore := nds.NewStore(nndb)
 	nService := nds.NewService(nStore)
 
-	mux.Handle("POST /api/v1/datastore/number", mwAuth(nds.CreateNumberHandler(nService)))
-	mux.Handle("GET /api/v1/datastore/number", nds.ReadNumberHandler(nService))
-	mux.Handle("PUT /api/v1/datastore/number", mwAuth(nds.UpdateNumberHandler(nService)))
-	mux.Handle("DELETE /api/v1/datastore/number", mwAuth(nds.DeleteNumberHandler(nService)))
+	router.Handle("POST /api/v1/datastore/number", nds.CreateNumberHandler(nService), mw.Require(perms.ScopeAdminNumberStore))
+	router.Handle("GET /api/v1/datastore/number", nds.ReadNumberHandler(nService))
+	router.Handle("PUT /api/v1/datastore/number", nds.UpdateNumberHandler(nService), mw.Require(perms.ScopeAdminNumberStore))
+	router.Handle("DELETE /api/v1/datastore/number", nds.DeleteNumberHandler(nService), mw.Require(perms.ScopeAdminNumberStore))
 
 	// --------------- Game Server Status ---------------
 	gssService := gss.NewService()
-	mux.Handle("GET /api/v1/game-server-status/{game}", gss.GameServerStatusHandler(gssService))
-	mux.Handle("GET /api/v1/game-server-status/simple/{game}", gss.SimpleGameServerStatus(gssService))
+	router.Handle("GET /api/v1/game-server-status/{game}", gss.GameServerStatusHandler(gssService))
+	router.Handle("GET /api/v1/game-server-status/simple/{game}", gss.SimpleGameServerStatus(gssService))
 
 	// --------------- Minecraft Status ---------------
 	mcsService := mcs.NewService()
-	mux.Handle("GET /api/v1/mcstatus/{host}", mcs.ServerStatusHandler(mcsService))
-	mux.Handle("GET /api/v1/mcstatus/icon/{host}", mcs.IconHandler(mcsService))
-	mux.Handle("GET /api/v1/mcstatus/simple/{host}", mcs.SimpleStatusHandler(mcsService))
+	router.Handle("GET /api/v1/mcstatus/{host}", mcs.ServerStatusHandler(mcsService))
+	router.Handle("GET /api/v1/mcstatus/icon/{host}", mcs.IconHandler(mcsService))
+	router.Handle("GET /api/v1/mcstatus/simple/{host}", mcs.SimpleStatusHandler(mcsService))
 
 	// --------------- Pet Pictures ---------------
 	petStore := petpics.NewStore(database.GetDB("pet_pictures"))
 	petService := petpics.NewService(petStore)
 
-	mux.Handle("POST /api/v1/pet-pictures/pets/{name}", mwAuth(petpics.CreatePetHandler(petService)))
-	mux.Handle("POST /api/v1/pet-pictures/pets", mwAuth(petpics.CreatePetHandler(petService)))
-	mux.Handle("GET /api/v1/pet-pictures/pets/{id}", petpics.GetPetHandler(petService))
-	mux.Handle("GET /api/v1/pet-pictures/pets", petpics.GetPetHandler(petService))
-	mux.Handle("PUT /api/v1/pet-pictures/pets", mwAuth(petpics.UpdatePetHandler(petService)))
-	mux.Handle("GET /api/v1/pet-pictures/pictures/random", petpics.GetRandPetPictureByNameHandler(petService))
-	mux.Handle("GET /api/v1/pet-pictures/pictures/{id}", petpics.GetPetPictureHandler(petService))
-	mux.Handle("GET /api/v1/pet-pictures/pictures", petpics.GetPetPictureHandler(petService))
-	mux.Handle("PUT /api/v1/pet-pictures/pictures", mwAuth(petpics.UpdatePetPictureHandler(petService)))
-	mux.Handle("DELETE /api/v1/pet-pictures/pictures/{id}", mwAuth(petpics.DeletePetPictureHandler(petService)))
-	mux.Handle("DELETE /api/v1/pet-pictures/pictures", mwAuth(petpics.DeletePetPictureHandler(petService)))
+	router.Handle("POST /api/v1/pet-pictures/pets/{name}", petpics.CreatePetHandler(petService), mw.Require(perms.ScopeAdminPetPictures))
+	router.Handle("POST /api/v1/pet-pictures/pets", petpics.CreatePetHandler(petService), mw.Require(perms.ScopeAdminPetPictures))
+	router.Handle("GET /api/v1/pet-pictures/pets/{id}", petpics.GetPetHandler(petService))
+	router.Handle("GET /api/v1/pet-pictures/pets", petpics.GetPetHandler(petService))
+	router.Handle("PUT /api/v1/pet-pictures/pets", petpics.UpdatePetHandler(petService), mw.Require())
+	router.Handle("GET /api/v1/pet-pictures/pictures/random", petpics.GetRandPetPictureByNameHandler(petService))
+	router.Handle("GET /api/v1/pet-pictures/pictures/{id}", petpics.GetPetPictureHandler(petService))
+	router.Handle("GET /api/v1/pet-pictures/pictures", petpics.GetPetPictureHandler(petService))
+	router.Handle("PUT /api/v1/pet-pictures/pictures", petpics.UpdatePetPictureHandler(petService), mw.Require())
+	router.Handle("DELETE /api/v1/pet-pictures/pictures/{id}", petpics.DeletePetPictureHandler(petService), mw.Require())
+	router.Handle("DELETE /api/v1/pet-pictures/pictures", petpics.DeletePetPictureHandler(petService), mw.Require())
 
 	// --------------- Projects ---------------
-	mux.HandleFunc("GET /api/v1/projects/releases/{group}/{project}", projects.GetReleasesHandler)
+	router.HandleFunc("GET /api/v1/projects/releases/{group}/{project}", projects.GetReleasesHandler)
 
 	// --------------- Switchboard ---------------
-	// mux.HandleFunc("GET /ws/v1/switchboard/relay", switchboard.ebSocketRelayHandler)
-	mux.HandleFunc("GET /websocket/{id}", switchboard.WebSocketRelayHandler)
+	// router.HandleFunc("GET /ws/v1/switchboard/relay", switchboard.ebSocketRelayHandler)
+	router.HandleFunc("GET /websocket/{id}", switchboard.WebSocketRelayHandler)
 
 	// --------------- Teapot ---------------
-	mux.HandleFunc("GET /api/v1/teapot", teapot.HandleTeapot)
+	router.HandleFunc("GET /api/v1/teapot", teapot.HandleTeapot)
 
 	// --------------- Twitch ---------------
 	twitchStore := twitch.NewStore(database.GetDB("twitch"))
 	twitchService := twitch.NewService(twitchStore)
-	mux.HandleFunc("POST /api/twitch/eventsub", twitch.HandleEventSub(twitchService, authStore.OAuthToken(), authStore.LinkAccount()))
+	router.HandleFunc("POST /api/twitch/eventsub", twitch.HandleEventSub(twitchService, oauthTokens, authStore.LinkAccount(), linkCodes))
 
 	// --------------- Health Check ---------------
-	mux.HandleFunc("GET /api/v1/health", func(w http.ResponseWriter, r *http.Request) {
+	router.HandleFunc("GET /api/v1/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	})
 
-	return mux
+	// --------------- OpenAPI ---------------
+	router.Handle("GET /api/v1/openapi.json", mw.OpenAPIHandler(router, "./public/api/v1/openapi.json", "/api/v1"))
+
+	return router
 }
 
 // Setup - Setup the API server
@@ -147,25 +226,51 @@ func (s *APIServer) Setup() http.Handler {
 	db := database.GetDB("neuralnexus")
 	rdb := database.GetRedis()
 	authStore := auth.NewStore(db, rdb)
-	session := auth.NewSessionService(authStore)
+	signingKeys := auth.NewSigningKeyService(authStore)
+	signingKeys.StartKeyRotation()
+	session := auth.NewSessionService(authStore, signingKeys)
+	apiKeys := auth.NewAPIKeyService(authStore)
+	roles := auth.NewRoleService(authStore)
+	roles.StartRoleSync()
+	oauthTokens := auth.NewOAuthTokenService(authStore, linking.Configs())
+	oauthTokens.StartTokenRefresher()
 	rateLimit := auth.NewRateLimitService(authStore)
+	mailer := email.NewSender()
 
 	middlewareStack := mw.CreateStack(
-		cors.AllowAll().Handler,
+		corsMiddleware,
 		mw.IPMiddleware,
-		mw.SessionMiddleware(session),
+		mw.SessionMiddleware(session, apiKeys),
 		mw.RequestIDMiddleware,
 		mw.RateLimitMiddleware(rateLimit, "default", 300, 60),
 		mw.RequestLoggerMiddleware,
 	)
 
-	router := ApplyRoutes(http.NewServeMux(), db, session, authStore, rateLimit)
+	router := ApplyRoutes(mw.NewRouter(http.NewServeMux(), session), db, rdb, session, signingKeys, apiKeys, roles, oauthTokens, authStore, rateLimit, mailer)
 
 	// --------------- Static Files ---------------
 	router.Handle("/", http.FileServer(http.Dir("./public")))
 	return middlewareStack(router)
 }
 
+// corsMiddleware - Allow any origin, only the site can make credentialed requests since those carry the session cookie
+func corsMiddleware(next http.Handler) http.Handler {
+	site := cors.New(cors.Options{
+		AllowedOrigins:   []string{auth.NN_SITE_URL},
+		AllowedMethods:   []string{http.MethodHead, http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete},
+		AllowedHeaders:   []string{"*"},
+		AllowCredentials: true,
+	}).Handler(next)
+	public := cors.AllowAll().Handler(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth.NN_SITE_URL != "" && r.Header.Get("Origin") == auth.NN_SITE_URL {
+			site.ServeHTTP(w, r)
+			return
+		}
+		public.ServeHTTP(w, r)
+	})
+}
+
 // Run - Start the API server
 func (s *APIServer) Run() error {
 	server := http.Server{
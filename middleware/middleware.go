@@ -2,6 +2,7 @@ package mw
 
 import (
 	"context"
+	"crypto/subtle"
 	"fmt"
 	"log"
 	"net/http"
@@ -26,6 +27,8 @@ const (
 	RequestIDKey
 	// RemoteAddrKey - Key for remote address in context
 	RemoteAddrKey
+	// APIKeyKey - Key for the API key in context, set when the session came from an API key
+	APIKeyKey
 )
 
 const (
@@ -33,12 +36,24 @@ const (
 	XRequestIDHeader     = "X-Request-ID"
 	XForwardedForHeader  = "X-Forwarded-For"
 	CFConnectingIPHeader = "CF-Connecting-IP"
+	XCSRFTokenHeader     = "X-CSRF-Token"
+
+	// SessionCookie - Cookie holding the session JWT for the site
+	SessionCookie = "session"
+	// CSRFCookie - Cookie holding the CSRF token the site sends back in the X-CSRF-Token header
+	CSRFCookie = "csrf_token"
 
 	RetryAfter = 60
 )
 
+// RemoteAddr - Get the remote address set by IPMiddleware
+func RemoteAddr(ctx context.Context) string {
+	remoteAddr, _ := ctx.Value(RemoteAddrKey).(string)
+	return remoteAddr
+}
+
 func LogRequest(ctx context.Context, message ...string) {
-	remoteAddr := ctx.Value(RemoteAddrKey).(string)
+	remoteAddr := RemoteAddr(ctx)
 	requestId := ctx.Value(RequestIDKey).(int)
 	session, ok := ctx.Value(SessionKey).(*auth.Session)
 	if !ok {
@@ -47,6 +62,9 @@ func LogRequest(ctx context.Context, message ...string) {
 	userId := "N/A"
 	if session != nil {
 		userId = session.UserID
+		if session.Machine {
+			userId = "machine:" + userId
+		}
 	}
 	log.Printf("%d %s %s %s",
 		requestId,
@@ -98,7 +116,7 @@ func IPMiddleware(next http.Handler) http.Handler {
 }
 
 // SessionMiddleware - Read the session from the request
-func SessionMiddleware(service auth.SessionService) Middleware {
+func SessionMiddleware(service auth.SessionService, keys auth.APIKeyService) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authHeader := r.Header.Get(AuthHeader)
@@ -108,6 +126,22 @@ func SessionMiddleware(service auth.SessionService) Middleware {
 					responses.Unauthorized(w, r, "")
 					return
 				}
+
+				if strings.HasPrefix(authStrings[1], auth.APIKeyPrefix) {
+					apiKey, session, err := keys.ReadAPIKey(authStrings[1])
+					if err != nil {
+						LogRequest(r.Context(), "Error reading API key:\n\t", err.Error())
+						responses.Unauthorized(w, r, "")
+						return
+					}
+
+					ctx := r.Context()
+					ctx = context.WithValue(ctx, SessionKey, session)
+					ctx = context.WithValue(ctx, APIKeyKey, apiKey)
+					next.ServeHTTP(w, r.WithContext(ctx))
+					return
+				}
+
 				session, err := service.ReadJWT(authStrings[1])
 				if err != nil {
 					LogRequest(r.Context(), "Error reading JWT:\n\t", err.Error())
@@ -124,16 +158,22 @@ func SessionMiddleware(service auth.SessionService) Middleware {
 					return
 				}
 
-				err = service.UpdateSession(session)
-				if err != nil {
-					responses.InternalServerError(w, r, "Error updating session")
-					LogRequest(r.Context(), "Error updating session:\n\t", err.Error())
-					return
-				}
-
 				ctx := r.Context()
 				ctx = context.WithValue(ctx, SessionKey, session)
 				r = r.WithContext(ctx)
+			} else if cookie, err := r.Cookie(SessionCookie); err == nil && cookie.Value != "" {
+				// A stale cookie shouldn't get in the way of requests that don't need a session, so it is only used if valid
+				session, err := service.ReadJWT(cookie.Value)
+				if err == nil && session.IsValid() {
+					// Browsers send cookies on their own, so changes need proof that the site itself made the request
+					if !isSafeMethod(r.Method) && !validCSRFToken(r) {
+						responses.Forbidden(w, r, "Missing or invalid CSRF token")
+						return
+					}
+					ctx := r.Context()
+					ctx = context.WithValue(ctx, SessionKey, session)
+					r = r.WithContext(ctx)
+				}
 			}
 
 			next.ServeHTTP(w, r)
@@ -141,6 +181,22 @@ func SessionMiddleware(service auth.SessionService) Middleware {
 	}
 }
 
+// isSafeMethod checks if a method is read-only, so it doesn't need CSRF protection
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// validCSRFToken checks the double-submitted CSRF token, the header has to match the cookie
+// Other sites can make the browser send the cookie, but they can't read it to set the header
+func validCSRFToken(r *http.Request) bool {
+	cookie, err := r.Cookie(CSRFCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	header := r.Header.Get(XCSRFTokenHeader)
+	return subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) == 1
+}
+
 // RateLimitMiddleware - Rate limit requests
 func RateLimitMiddleware(service auth.RateLimitService, prefix string, sessionLimit int, ipLimit int) Middleware {
 	return func(next http.Handler) http.Handler {
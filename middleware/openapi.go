@@ -0,0 +1,100 @@
+package mw
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/NeuralNexusDev/neuralnexus-api/responses"
+	"github.com/goccy/go-json"
+)
+
+const (
+	// securityScheme - The security scheme in the OpenAPI document that sessions and API keys use
+	securityScheme = "bearerAuth"
+	// cookieSecurityScheme - The security scheme in the OpenAPI document for the site's session cookie
+	cookieSecurityScheme = "cookieAuth"
+)
+
+// applySecurity - Set each documented operation's security from the policy declared on its route
+func applySecurity(doc map[string]any, routes []Route, prefix string) {
+	paths, ok := doc["paths"].(map[string]any)
+	if !ok {
+		return
+	}
+	for _, route := range routes {
+		if route.Method == "" || !strings.HasPrefix(route.Pattern, prefix) {
+			continue
+		}
+		path, ok := paths[strings.TrimPrefix(route.Pattern, prefix)].(map[string]any)
+		if !ok {
+			continue
+		}
+		op, ok := path[strings.ToLower(route.Method)].(map[string]any)
+		if !ok {
+			continue
+		}
+		if route.Policy == nil {
+			delete(op, "security")
+			delete(op, "x-permissions")
+			continue
+		}
+		op["security"] = []map[string][]string{{securityScheme: {}}, {cookieSecurityScheme: {}}}
+		if permissions := route.Policy.Describe(); len(permissions) > 0 {
+			op["x-permissions"] = permissions
+		}
+		resps, ok := op["responses"].(map[string]any)
+		if !ok {
+			continue
+		}
+		if _, ok := resps["401"]; !ok {
+			resps["401"] = map[string]string{"$ref": "#/components/responses/401Unauthorized"}
+		}
+		if _, ok := resps["403"]; !ok && len(route.Policy.Describe()) > 0 {
+			resps["403"] = map[string]string{"$ref": "#/components/responses/403Forbidden"}
+		}
+	}
+}
+
+// loadOpenAPI - Read the OpenAPI document and apply the router's security to it
+func loadOpenAPI(rt *Router, file string, prefix string) ([]byte, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	err = json.Unmarshal(raw, &doc)
+	if err != nil {
+		return nil, err
+	}
+	applySecurity(doc, rt.Routes(), prefix)
+	return json.MarshalIndent(doc, "", "    ")
+}
+
+// OpenAPIHandler - Serve the OpenAPI document with security taken from the router's declarations
+// Paths in the document are relative to prefix, which is the server URL's path. The document is built on the
+// first request so every route has been registered by then
+func OpenAPIHandler(rt *Router, file string, prefix string) http.HandlerFunc {
+	var (
+		once sync.Once
+		spec []byte
+		err  error
+	)
+	return func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() {
+			spec, err = loadOpenAPI(rt, file, prefix)
+			if err != nil {
+				log.Println("Failed to load OpenAPI document:\n\t", err)
+			}
+		})
+		if err != nil {
+			responses.InternalServerError(w, r, "Failed to load OpenAPI document")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(spec)
+	}
+}
@@ -0,0 +1,199 @@
+package mw
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/auth"
+	perms "github.com/NeuralNexusDev/neuralnexus-api/modules/auth/permissions"
+	"github.com/NeuralNexusDev/neuralnexus-api/responses"
+)
+
+// GetSession - Get the session set by SessionMiddleware, if there is one
+func GetSession(ctx context.Context) (*auth.Session, bool) {
+	session, ok := ctx.Value(SessionKey).(*auth.Session)
+	return session, ok && session != nil
+}
+
+// FirstPartySession - Get the session if it's the user's own, for routes where signing in is optional
+func FirstPartySession(r *http.Request) (*auth.Session, bool) {
+	session, ok := GetSession(r.Context())
+	if !ok || !firstParty(session, r) {
+		return nil, false
+	}
+	return session, true
+}
+
+// -------------- Policies --------------
+
+// Policy - Authorization declared on a route, checked by the router and published in the OpenAPI document
+type Policy struct {
+	scopes     []perms.Scope
+	pathValue  string
+	resource   func(string) perms.Scope
+	verb       perms.Verb
+	self       bool
+	apiKey     bool
+	firstParty bool
+}
+
+// Require - Require a session holding every one of the scopes, with no scopes any session will do
+func Require(scopes ...perms.Scope) *Policy {
+	return &Policy{scopes: scopes}
+}
+
+// RequireResource - Require a scope on the resource named by a path value, e.g. users:{user_id}:write
+func RequireResource(pathValue string, resource func(string) perms.Scope, verb perms.Verb) *Policy {
+	return &Policy{pathValue: pathValue, resource: resource, verb: verb}
+}
+
+// RequireSelfOr - Allow the user named by a path value from their own first-party session, anyone else needs the
+// scope on that resource. API keys and tokens issued to other clients always need the scope, even for their own user
+func RequireSelfOr(pathValue string, resource func(string) perms.Scope) *Policy {
+	return &Policy{pathValue: pathValue, resource: resource, self: true}
+}
+
+// RequireFirstParty - Require the user's own session holding every one of the scopes, for managing the account itself.
+// API keys, service accounts and tokens issued to other clients are turned away whatever scopes they hold
+func RequireFirstParty(scopes ...perms.Scope) *Policy {
+	return &Policy{scopes: scopes, firstParty: true}
+}
+
+// RequireFirstPartyOr - Allow the user named by a path value from their own first-party session, anyone else needs
+// every one of the scopes. For routes that act on the account itself, where staff are the only other callers
+func RequireFirstPartyOr(pathValue string, scopes ...perms.Scope) *Policy {
+	return &Policy{scopes: scopes, pathValue: pathValue, self: true}
+}
+
+// RequireAPIKey - Require an API key holding every one of the scopes, for servers and plugins rather than people
+func RequireAPIKey(scopes ...perms.Scope) *Policy {
+	return &Policy{scopes: scopes, apiKey: true}
+}
+
+// required - The scopes the policy asks for on a request
+func (p *Policy) required(r *http.Request) []perms.Scope {
+	if p.resource == nil {
+		return p.scopes
+	}
+	scope := p.resource(r.PathValue(p.pathValue))
+	if p.verb != "" {
+		scope = scope.WithVerb(p.verb)
+	}
+	return []perms.Scope{scope}
+}
+
+// firstParty - Check if a session is the user's own, rather than an API key, a service account or another client's token
+func firstParty(session *auth.Session, r *http.Request) bool {
+	_, isKey := r.Context().Value(APIKeyKey).(*auth.APIKey)
+	return !isKey && session.ClientID == "" && !session.Machine
+}
+
+// Allows - Check if a session satisfies the policy for a request
+func (p *Policy) Allows(session *auth.Session, r *http.Request) bool {
+	if _, ok := r.Context().Value(APIKeyKey).(*auth.APIKey); p.apiKey && !ok {
+		return false
+	}
+	if p.firstParty && !firstParty(session, r) {
+		return false
+	}
+	if p.self && session.UserID == r.PathValue(p.pathValue) && firstParty(session, r) {
+		return true
+	}
+	for _, scope := range p.required(r) {
+		if !session.HasPermission(scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// Describe - Human-readable permissions for the OpenAPI document
+func (p *Policy) Describe() []string {
+	var described []string
+	if p.apiKey {
+		described = append(described, "apikey")
+	}
+	if p.firstParty {
+		described = append(described, "first-party")
+	}
+	if p.self {
+		described = append(described, "first-party self:{"+p.pathValue+"}")
+	}
+	if p.resource != nil {
+		scope := p.resource("{" + p.pathValue + "}")
+		if p.verb != "" {
+			scope = scope.WithVerb(p.verb)
+		}
+		return append(described, scope.String())
+	}
+	for _, scope := range p.scopes {
+		described = append(described, scope.String())
+	}
+	return described
+}
+
+// -------------- Router --------------
+
+// Route - A route and the authorization declared for it
+type Route struct {
+	Method  string
+	Pattern string
+	Policy  *Policy
+}
+
+// Router - Registers routes on a ServeMux, keeping track of their authorization
+type Router struct {
+	*http.ServeMux
+	auth   Middleware
+	routes []Route
+}
+
+// NewRouter - Create a new router, sessions are validated with the session service
+func NewRouter(mux *http.ServeMux, service auth.SessionService) *Router {
+	return &Router{
+		ServeMux: mux,
+		auth:     Auth(service),
+	}
+}
+
+// Handle - Register a handler, with a policy the request must be authenticated and authorized
+func (rt *Router) Handle(pattern string, handler http.Handler, policy ...*Policy) {
+	method, path, ok := strings.Cut(pattern, " ")
+	if !ok {
+		method, path = "", pattern
+	}
+	route := Route{Method: method, Pattern: path}
+	if len(policy) > 0 {
+		route.Policy = policy[0]
+		handler = rt.auth(authorize(policy[0], handler))
+	}
+	rt.routes = append(rt.routes, route)
+	rt.ServeMux.Handle(pattern, handler)
+}
+
+// HandleFunc - Register a handler function without authorization
+func (rt *Router) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	rt.Handle(pattern, http.HandlerFunc(handler))
+}
+
+// Routes - Get every registered route
+func (rt *Router) Routes() []Route {
+	return rt.routes
+}
+
+// authorize - Check the policy before calling the handler
+func authorize(policy *Policy, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, ok := GetSession(r.Context())
+		if !ok {
+			responses.Unauthorized(w, r, "")
+			return
+		}
+		if !policy.Allows(session, r) {
+			responses.Forbidden(w, r, "You do not have permission to do this")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
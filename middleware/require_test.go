@@ -0,0 +1,85 @@
+package mw
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/auth"
+	perms "github.com/NeuralNexusDev/neuralnexus-api/modules/auth/permissions"
+)
+
+// serveWithPolicy makes a request to a route protected by the policy, as the session and API key given
+func serveWithPolicy(policy *Policy, path string, session *auth.Session, apiKey *auth.APIKey) int {
+	mux := http.NewServeMux()
+	mux.Handle("GET /users/{user_id}/sessions", authorize(policy, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	ctx := r.Context()
+	if session != nil {
+		ctx = context.WithValue(ctx, SessionKey, session)
+	}
+	if apiKey != nil {
+		ctx = context.WithValue(ctx, APIKeyKey, apiKey)
+	}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r.WithContext(ctx))
+	return w.Code
+}
+
+func TestRequireSelfOr(t *testing.T) {
+	policy := RequireSelfOr("user_id", perms.ScopeUsers)
+	admin := []string{perms.ScopeAdminUsers.String()}
+
+	tests := []struct {
+		name    string
+		path    string
+		session *auth.Session
+		apiKey  *auth.APIKey
+		want    int
+	}{
+		{"own session", "/users/1/sessions", &auth.Session{UserID: "1"}, nil, http.StatusOK},
+		{"someone else's", "/users/2/sessions", &auth.Session{UserID: "1"}, nil, http.StatusForbidden},
+		{"admin", "/users/2/sessions", &auth.Session{UserID: "1", Permissions: admin}, nil, http.StatusOK},
+		{"scopeless api key", "/users/1/sessions", &auth.Session{UserID: "1"}, &auth.APIKey{UserID: "1"}, http.StatusForbidden},
+		{"oidc client", "/users/1/sessions", &auth.Session{UserID: "1", ClientID: "client"}, nil, http.StatusForbidden},
+		{"service account", "/users/1/sessions", &auth.Session{UserID: "1", Machine: true}, nil, http.StatusForbidden},
+		{"admin api key", "/users/2/sessions", &auth.Session{UserID: "1", Permissions: admin}, &auth.APIKey{UserID: "1", Permissions: admin}, http.StatusOK},
+		{"no session", "/users/1/sessions", nil, nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := serveWithPolicy(policy, tt.path, tt.session, tt.apiKey)
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireFirstParty(t *testing.T) {
+	policy := RequireFirstParty()
+
+	tests := []struct {
+		name    string
+		session *auth.Session
+		apiKey  *auth.APIKey
+		want    int
+	}{
+		{"own session", &auth.Session{UserID: "1"}, nil, http.StatusOK},
+		{"api key", &auth.Session{UserID: "1"}, &auth.APIKey{UserID: "1"}, http.StatusForbidden},
+		{"oidc client", &auth.Session{UserID: "1", ClientID: "client"}, nil, http.StatusForbidden},
+		{"service account", &auth.Session{UserID: "1", Machine: true}, nil, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := serveWithPolicy(policy, "/users/1/sessions", tt.session, tt.apiKey)
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
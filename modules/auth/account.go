@@ -1,8 +1,20 @@
 package auth
 
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+)
+
+var (
+	ErrUsernameTaken = errors.New("username is already taken")
+	ErrEmailTaken    = errors.New("email is already registered")
+)
+
 // AccountService - The userService interface
 type AccountService interface {
 	AddAccount(account *Account) error
+	AddPlatformAccount(name, email string) (*Account, error)
 	GetAccountByID(userID string) (*Account, error)
 	GetAccountByUsername(username string) (*Account, error)
 	GetAccountByEmail(email string) (*Account, error)
@@ -40,6 +52,32 @@ func (s *accountService) AddAccount(account *Account) error {
 	return s.as.AddAccountToDB(account)
 }
 
+// AddPlatformAccount - Add an account for someone signing in with a platform for the first time
+// The platform's name is made into a valid username, with a random suffix when it's already taken
+func (s *accountService) AddPlatformAccount(name, email string) (*Account, error) {
+	base := PlatformUsername(name)
+	username := base
+	for range 5 {
+		account, err := NewPasswordLessAccount(username, email)
+		if err != nil {
+			return nil, err
+		}
+		err = s.as.AddAccountToDB(account)
+		if err == nil {
+			return account, nil
+		} else if !errors.Is(err, ErrUsernameTaken) {
+			return nil, err
+		}
+
+		n, err := rand.Int(rand.Reader, big.NewInt(10000))
+		if err != nil {
+			return nil, err
+		}
+		username = base[:min(len(base), usernameMaxLength-5)] + "_" + n.String()
+	}
+	return nil, ErrUsernameTaken
+}
+
 // UpdateAccount - Update an account in the database
 func (s *accountService) UpdateAccount(account *Account) error {
 	return s.as.UpdateAccountInDB(account)
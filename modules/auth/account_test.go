@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// takenAccountStore - AccountStore that only knows which usernames and emails are taken
+type takenAccountStore struct {
+	AccountStore
+	usernames map[string]bool
+	emails    map[string]bool
+	added     []*Account
+}
+
+func (s *takenAccountStore) AddAccountToDB(account *Account) error {
+	if s.usernames[account.Username] {
+		return ErrUsernameTaken
+	}
+	if account.Email != "" && s.emails[account.Email] {
+		return ErrEmailTaken
+	}
+	s.usernames[account.Username] = true
+	s.added = append(s.added, account)
+	return nil
+}
+
+func TestPlatformUsername(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"octocat", "octocat"},
+		{"Jane Doe", "Jane_Doe"},
+		{"Zoë O'Brien", "Zo_OBrien"},
+		{"李", "user"},
+		{"ab", "userab"},
+		{"", "user"},
+		{strings.Repeat("a", 40), strings.Repeat("a", 32)},
+	}
+	for _, tt := range tests {
+		got := PlatformUsername(tt.name)
+		if got != tt.want {
+			t.Errorf("PlatformUsername(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+		if err := ValidateUsername(got); err != nil {
+			t.Errorf("PlatformUsername(%q) = %q is not a valid username: %v", tt.name, got, err)
+		}
+	}
+}
+
+func TestAddPlatformAccount(t *testing.T) {
+	store := &takenAccountStore{usernames: map[string]bool{}, emails: map[string]bool{}}
+	s := &accountService{as: store}
+
+	account, err := s.AddPlatformAccount("Jane Doe", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Username != "Jane_Doe" {
+		t.Errorf("got username %q, want %q", account.Username, "Jane_Doe")
+	}
+	if account.HashedSecret != nil {
+		t.Error("platform accounts should not have a password")
+	}
+}
+
+func TestAddPlatformAccountTakenUsername(t *testing.T) {
+	base := strings.Repeat("a", 32)
+	store := &takenAccountStore{usernames: map[string]bool{base: true}, emails: map[string]bool{}}
+	s := &accountService{as: store}
+
+	account, err := s.AddPlatformAccount(base, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix, suffix, ok := strings.Cut(account.Username, "_")
+	if !ok || !strings.HasPrefix(base, prefix) || suffix == "" {
+		t.Errorf("got username %q, want the name with a random suffix", account.Username)
+	}
+	if err := ValidateUsername(account.Username); err != nil {
+		t.Errorf("suffixed username %q is not valid: %v", account.Username, err)
+	}
+}
+
+func TestAddPlatformAccountTakenEmail(t *testing.T) {
+	store := &takenAccountStore{usernames: map[string]bool{}, emails: map[string]bool{"jane@example.com": true}}
+	s := &accountService{as: store}
+
+	_, err := s.AddPlatformAccount("Jane Doe", "jane@example.com")
+	if !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("got error %v, want %v", err, ErrEmailTaken)
+	}
+	if len(store.added) != 0 {
+		t.Error("no account should be added when the email is taken")
+	}
+}
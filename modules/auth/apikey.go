@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	perms "github.com/NeuralNexusDev/neuralnexus-api/modules/auth/permissions"
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/database"
+)
+
+// APIKeyPrefix - Prefix that marks a bearer token as an API key rather than a JWT
+const APIKeyPrefix = "nnk_"
+
+var (
+	ErrInvalidAPIKey      = errors.New("invalid or expired api key")
+	ErrAPIKeyPermission   = errors.New("api keys can only be given permissions the user already has")
+	ErrAPIKeyExpiryInPast = errors.New("api key expiry must be in the future")
+	ErrAPIKeyNameRequired = errors.New("api key name is required")
+)
+
+// -------------- Structs --------------
+
+// APIKey struct, the key itself is only ever stored as a hash
+type APIKey struct {
+	ID          string    `json:"key_id" xml:"key_id" db:"key_id"`
+	UserID      string    `json:"user_id" xml:"user_id" db:"user_id"`
+	Name        string    `json:"name" xml:"name" db:"name"`
+	Prefix      string    `json:"prefix" xml:"prefix" db:"prefix"`
+	KeyHash     string    `json:"-" xml:"-" db:"key_hash"`
+	Permissions []string  `json:"permissions" xml:"permissions" db:"permissions"`
+	ExpiresAt   int64     `json:"exp" xml:"exp" db:"expires_at"`
+	LastUsedAt  int64     `json:"lua" xml:"lua" db:"last_used_at"`
+	CreatedAt   time.Time `json:"created_at" xml:"created_at" db:"created_at"`
+}
+
+// NewAPIKey struct returned once when a key is created, it is the only time the key can be seen
+type NewAPIKey struct {
+	*APIKey
+	Key string `json:"key" xml:"key"`
+}
+
+// IsValid checks if an API key is expired
+func (k *APIKey) IsValid() bool {
+	if k.ExpiresAt == 0 {
+		return true
+	}
+	return time.Now().Unix() < k.ExpiresAt
+}
+
+// -------------- Service --------------
+
+// APIKeyService - API key service interface
+type APIKeyService interface {
+	CreateAPIKey(session *Session, name string, permissions []string, expiresAt int64) (*NewAPIKey, error)
+	GetAPIKeys(userID string) ([]*APIKey, error)
+	DeleteAPIKey(userID, keyID string) error
+	ReadAPIKey(key string) (*APIKey, *Session, error)
+}
+
+// apiKeyService - APIKeyService implementation
+type apiKeyService struct {
+	store APIKeyStore
+	as    AccountStore
+}
+
+// NewAPIKeyService - Create a new API key service
+func NewAPIKeyService(store Store) APIKeyService {
+	return &apiKeyService{
+		store: store.APIKey(),
+		as:    store.Account(),
+	}
+}
+
+// CreateAPIKey creates a key carrying a subset of the session's permissions
+func (s *apiKeyService) CreateAPIKey(session *Session, name string, permissions []string, expiresAt int64) (*NewAPIKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrAPIKeyNameRequired
+	}
+	if expiresAt != 0 && expiresAt <= time.Now().Unix() {
+		return nil, ErrAPIKeyExpiryInPast
+	}
+	normalized := []string{}
+	for _, p := range permissions {
+		if !perms.HasPermission(session.Permissions, p) {
+			return nil, ErrAPIKeyPermission
+		}
+		p, _ = perms.Normalize(p)
+		normalized = append(normalized, p)
+	}
+	permissions = normalized
+
+	id, err := database.GenSnowflake()
+	if err != nil {
+		return nil, err
+	}
+	token, err := GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+	key := APIKeyPrefix + token
+	apiKey := &APIKey{
+		ID:          id,
+		UserID:      session.UserID,
+		Name:        name,
+		Prefix:      key[:len(APIKeyPrefix)+6],
+		KeyHash:     HashToken(key),
+		Permissions: permissions,
+		ExpiresAt:   expiresAt,
+		CreatedAt:   time.Now(),
+	}
+	err = s.store.AddAPIKeyToDB(apiKey)
+	if err != nil {
+		return nil, err
+	}
+	return &NewAPIKey{apiKey, key}, nil
+}
+
+// GetAPIKeys lists a user's API keys
+func (s *apiKeyService) GetAPIKeys(userID string) ([]*APIKey, error) {
+	return s.store.GetAPIKeysByUserID(userID)
+}
+
+// DeleteAPIKey revokes one of a user's API keys
+func (s *apiKeyService) DeleteAPIKey(userID, keyID string) error {
+	return s.store.DeleteAPIKeyFromDB(userID, keyID)
+}
+
+// ReadAPIKey checks an API key and builds a session from it
+// The key's permissions are narrowed to what the user currently has, so removing a role also takes it away from their keys
+func (s *apiKeyService) ReadAPIKey(key string) (*APIKey, *Session, error) {
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	apiKey, err := s.store.GetAPIKeyByHash(HashToken(key))
+	if err != nil || !apiKey.IsValid() {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	account, err := s.as.GetAccountByID(apiKey.UserID)
+	if err != nil {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	current := account.Permissions()
+	var permissions []string
+	for _, p := range apiKey.Permissions {
+		if perms.HasPermission(current, p) {
+			permissions = append(permissions, p)
+		}
+	}
+
+	apiKey.LastUsedAt = time.Now().Unix()
+	err = s.store.UpdateAPIKeyLastUsed(apiKey.ID, apiKey.LastUsedAt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return apiKey, &Session{
+		ID:          apiKey.ID,
+		UserID:      apiKey.UserID,
+		Permissions: permissions,
+		IssuedAt:    apiKey.CreatedAt.Unix(),
+		LastUsedAt:  apiKey.LastUsedAt,
+		ExpiresAt:   apiKey.ExpiresAt,
+	}, nil
+}
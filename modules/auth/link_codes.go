@@ -0,0 +1,204 @@
+package auth
+
+import (
+	"crypto/rand"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// LinkCodeTTL - How long a link code can be redeemed for
+var LinkCodeTTL = 10 * time.Minute
+
+const (
+	linkCodeLength = 8
+	// linkCodeAlphabet - Crockford's base32, without letters that are easy to mistake for each other in chat
+	linkCodeAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+	// linkCodeCreateLimit - Codes a user or platform account can create per minute
+	linkCodeCreateLimit = 5
+	// linkCodeRedeemLimit - Codes a caller can try to redeem per minute
+	linkCodeRedeemLimit = 10
+)
+
+var (
+	ErrLinkCodeInvalid     = errors.New("link code is invalid or has expired")
+	ErrLinkCodeRateLimited = errors.New("too many link codes, try again in a minute")
+)
+
+// -------------- Structs --------------
+
+// LinkCode short code that links a platform account to a user without OAuth
+// A code is made for either side, a signed-in user or a platform account, and redeemed by the other
+type LinkCode struct {
+	Code             string    `json:"code" xml:"code"`
+	UserID           string    `json:"user_id,omitempty" xml:"user_id,omitempty"`
+	Platform         Platform  `json:"platform,omitempty" xml:"platform,omitempty"`
+	PlatformID       string    `json:"platform_id,omitempty" xml:"platform_id,omitempty"`
+	PlatformUsername string    `json:"platform_username,omitempty" xml:"platform_username,omitempty"`
+	ExpiresAt        time.Time `json:"expires_at" xml:"expires_at"`
+}
+
+// linkCodeData - Linked account data for a platform account that was only identified by a link code
+type linkCodeData struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+// -------------- Service --------------
+
+// LinkCodeService - Links platform accounts using short codes typed in game or in chat
+type LinkCodeService interface {
+	CreateUserCode(userID string) (*LinkCode, error)
+	CreatePlatformCode(platform Platform, platformID string, platformUsername string) (*LinkCode, error)
+	RedeemUserCode(code string, redeemer string, platform Platform, platformID string, platformUsername string) (*LinkedAccount, error)
+	RedeemPlatformCode(code string, platform Platform, userID string) (*LinkedAccount, error)
+}
+
+// linkCodeService - LinkCodeService implementation
+type linkCodeService struct {
+	store LinkCodeStore
+	las   LinkAccountStore
+	rl    RateLimitStore
+}
+
+// NewLinkCodeService - Create a new link code service
+func NewLinkCodeService(store Store) LinkCodeService {
+	return &linkCodeService{
+		store: store.LinkCode(),
+		las:   store.LinkAccount(),
+		rl:    store.RateLimit(),
+	}
+}
+
+// NormalizeLinkCode uppercases a code and maps the characters Crockford's base32 treats as the same
+func NormalizeLinkCode(code string) string {
+	return strings.NewReplacer("I", "1", "L", "1", "O", "0").Replace(strings.ToUpper(strings.TrimSpace(code)))
+}
+
+// newLinkCode generates a random code
+func newLinkCode() (string, error) {
+	b := make([]byte, linkCodeLength)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = linkCodeAlphabet[int(b[i])%len(linkCodeAlphabet)]
+	}
+	return string(b), nil
+}
+
+// limited counts an attempt against a key, returning true once there have been too many this minute
+func (s *linkCodeService) limited(key string, limit int) (bool, error) {
+	err := s.rl.IncrementRateLimit("linkcode:" + key)
+	if err != nil {
+		return false, err
+	}
+	count, err := s.rl.GetRateLimit("linkcode:" + key)
+	if err != nil {
+		return false, err
+	}
+	return count > limit, nil
+}
+
+// create stores a new code, retrying if the random code is already in use
+func (s *linkCodeService) create(rateLimitKey string, linkCode *LinkCode) (*LinkCode, error) {
+	limited, err := s.limited("create:"+rateLimitKey, linkCodeCreateLimit)
+	if err != nil {
+		return nil, err
+	}
+	if limited {
+		return nil, ErrLinkCodeRateLimited
+	}
+	for range 3 {
+		linkCode.Code, err = newLinkCode()
+		if err != nil {
+			return nil, err
+		}
+		linkCode.ExpiresAt = time.Now().Add(LinkCodeTTL)
+		added, err := s.store.AddLinkCode(linkCode, LinkCodeTTL)
+		if err != nil {
+			return nil, err
+		}
+		if added {
+			return linkCode, nil
+		}
+	}
+	return nil, errors.New("failed to generate a unique link code")
+}
+
+// consume uses up a code, rate limiting the caller so codes can't be guessed
+func (s *linkCodeService) consume(code string, redeemer string) (*LinkCode, error) {
+	limited, err := s.limited("redeem:"+redeemer, linkCodeRedeemLimit)
+	if err != nil {
+		return nil, err
+	}
+	if limited {
+		return nil, ErrLinkCodeRateLimited
+	}
+	linkCode, err := s.store.ConsumeLinkCode(NormalizeLinkCode(code))
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrLinkCodeInvalid
+	} else if err != nil {
+		return nil, err
+	}
+	return linkCode, nil
+}
+
+// CreateUserCode creates a code for a signed-in user, to be entered on the platform
+func (s *linkCodeService) CreateUserCode(userID string) (*LinkCode, error) {
+	return s.create("user:"+userID, &LinkCode{UserID: userID})
+}
+
+// CreatePlatformCode creates a code for a platform account, to be entered by a user somewhere they are signed in
+func (s *linkCodeService) CreatePlatformCode(platform Platform, platformID string, platformUsername string) (*LinkCode, error) {
+	return s.create(string(platform)+":"+platformID, &LinkCode{
+		Platform:         platform,
+		PlatformID:       platformID,
+		PlatformUsername: platformUsername,
+	})
+}
+
+// RedeemUserCode links the platform account to the user that created the code
+func (s *linkCodeService) RedeemUserCode(code string, redeemer string, platform Platform, platformID string, platformUsername string) (*LinkedAccount, error) {
+	linkCode, err := s.consume(code, redeemer)
+	if err != nil {
+		return nil, err
+	}
+	if linkCode.UserID == "" {
+		return nil, ErrLinkCodeInvalid
+	}
+	return s.link(linkCode.UserID, platform, platformID, platformUsername)
+}
+
+// RedeemPlatformCode links the platform account that created the code to the user
+func (s *linkCodeService) RedeemPlatformCode(code string, platform Platform, userID string) (*LinkedAccount, error) {
+	linkCode, err := s.consume(code, "user:"+userID)
+	if err != nil {
+		return nil, err
+	}
+	if linkCode.Platform != platform {
+		return nil, ErrLinkCodeInvalid
+	}
+	return s.link(userID, linkCode.Platform, linkCode.PlatformID, linkCode.PlatformUsername)
+}
+
+// link creates the linked account, it's unverified since the platform account was only vouched for by the caller.
+// Unverified links can't be used to sign in, and signing in to the platform account takes it over
+func (s *linkCodeService) link(userID string, platform Platform, platformID string, platformUsername string) (*LinkedAccount, error) {
+	la := &LinkedAccount{
+		UserID:           userID,
+		Platform:         platform,
+		PlatformUsername: platformUsername,
+		PlatformID:       platformID,
+		Data:             linkCodeData{ID: platformID, Username: platformUsername},
+	}
+	err := LinkPlatformAccount(s.las, la)
+	if err != nil {
+		return nil, err
+	}
+	return la, nil
+}
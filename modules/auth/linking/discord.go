@@ -74,3 +74,12 @@ func GetDiscordUser(token *auth.OAuthToken) (*DiscordData, error) {
 	}
 	return &DiscordData{User: user}, nil
 }
+
+// NewDiscordClient creates a Discord client acting as a user, with a token from their stored platform token
+func NewDiscordClient(ts oauth2.TokenSource) (*discordgo.Session, error) {
+	token, err := ts.Token()
+	if err != nil {
+		return nil, err
+	}
+	return discordgo.New("Bearer " + token.AccessToken)
+}
@@ -0,0 +1,107 @@
+package linking
+
+import (
+	"cmp"
+	"os"
+	"strconv"
+
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/auth"
+	"github.com/goccy/go-json"
+	"golang.org/x/oauth2"
+)
+
+// -------------- Global Variables --------------
+
+//goland:noinspection GoSnakeCaseUsage
+var (
+	GITHUB_CLIENT_ID     = os.Getenv("GITHUB_CLIENT_ID")
+	GITHUB_CLIENT_SECRET = os.Getenv("GITHUB_CLIENT_SECRET")
+	GITHUB_REDIRECT_URI  = os.Getenv("GITHUB_REDIRECT_URI")
+	// GITHUB_AUTH_URL and the URLs below can be pointed at a local server for testing
+	GITHUB_AUTH_URL  = cmp.Or(os.Getenv("GITHUB_AUTH_URL"), "https://github.com/login/oauth/authorize")
+	GITHUB_TOKEN_URL = cmp.Or(os.Getenv("GITHUB_TOKEN_URL"), "https://github.com/login/oauth/access_token")
+	GITHUB_API_URL   = cmp.Or(os.Getenv("GITHUB_API_URL"), "https://api.github.com")
+	githubConfig     = &oauth2.Config{
+		ClientID:     GITHUB_CLIENT_ID,
+		ClientSecret: GITHUB_CLIENT_SECRET,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   GITHUB_AUTH_URL,
+			TokenURL:  GITHUB_TOKEN_URL,
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+		RedirectURL: GITHUB_REDIRECT_URI,
+		Scopes:      []string{"read:user", "user:email"},
+	}
+)
+
+// -------------- Structs --------------
+
+// GitHubData struct
+type GitHubData struct {
+	ID        int64  `json:"id"`
+	Login     string `json:"login"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+// githubEmail an entry from the GitHub user's email addresses
+type githubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+// GetID returns the platform ID
+func (g *GitHubData) GetID() string {
+	return strconv.FormatInt(g.ID, 10)
+}
+
+// GetEmail returns the platform email
+func (g *GitHubData) GetEmail() string {
+	return g.Email
+}
+
+// GetUsername returns the platform username
+func (g *GitHubData) GetUsername() string {
+	return g.Login
+}
+
+// GetData returns the platform data
+func (g *GitHubData) GetData() string {
+	data, _ := json.Marshal(g)
+	return string(data)
+}
+
+// CreateLinkedAccount creates a linked account
+func (g *GitHubData) CreateLinkedAccount(userID string) *auth.LinkedAccount {
+	return auth.NewLinkedAccount(userID, auth.PlatformGitHub, g.Login, g.GetID(), g)
+}
+
+// -------------- Functions --------------
+
+// GetGitHubUser gets a GitHub user with the given access token
+// The profile only has an email if the user made one public, otherwise the primary verified email is used
+func GetGitHubUser(token *auth.OAuthToken) (*GitHubData, error) {
+	var user GitHubData
+	err := getProviderJSON(GITHUB_API_URL+"/user", token.AccessToken, &user)
+	if err != nil {
+		return nil, err
+	}
+	if user.Email != "" {
+		return &user, nil
+	}
+
+	var emails []githubEmail
+	err = getProviderJSON(GITHUB_API_URL+"/user/emails", token.AccessToken, &emails)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range emails {
+		if e.Primary && e.Verified {
+			user.Email = e.Email
+			break
+		}
+	}
+	return &user, nil
+}
@@ -0,0 +1,86 @@
+package linking
+
+import (
+	"cmp"
+	"os"
+
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/auth"
+	"github.com/goccy/go-json"
+	"golang.org/x/oauth2"
+)
+
+// -------------- Global Variables --------------
+
+//goland:noinspection GoSnakeCaseUsage
+var (
+	GOOGLE_CLIENT_ID     = os.Getenv("GOOGLE_CLIENT_ID")
+	GOOGLE_CLIENT_SECRET = os.Getenv("GOOGLE_CLIENT_SECRET")
+	GOOGLE_REDIRECT_URI  = os.Getenv("GOOGLE_REDIRECT_URI")
+	// GOOGLE_AUTH_URL and the URLs below can be pointed at a local server for testing
+	GOOGLE_AUTH_URL     = cmp.Or(os.Getenv("GOOGLE_AUTH_URL"), "https://accounts.google.com/o/oauth2/v2/auth")
+	GOOGLE_TOKEN_URL    = cmp.Or(os.Getenv("GOOGLE_TOKEN_URL"), "https://oauth2.googleapis.com/token")
+	GOOGLE_USERINFO_URL = cmp.Or(os.Getenv("GOOGLE_USERINFO_URL"), "https://openidconnect.googleapis.com/v1/userinfo")
+	googleConfig        = &oauth2.Config{
+		ClientID:     GOOGLE_CLIENT_ID,
+		ClientSecret: GOOGLE_CLIENT_SECRET,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   GOOGLE_AUTH_URL,
+			TokenURL:  GOOGLE_TOKEN_URL,
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+		RedirectURL: GOOGLE_REDIRECT_URI,
+		Scopes:      []string{"openid", "email", "profile"},
+	}
+)
+
+// -------------- Structs --------------
+
+// GoogleData struct, the OpenID Connect claims for the Google account
+type GoogleData struct {
+	Sub           string `json:"sub"`
+	Name          string `json:"name"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Picture       string `json:"picture"`
+}
+
+// GetID returns the platform ID
+func (g *GoogleData) GetID() string {
+	return g.Sub
+}
+
+// GetEmail returns the platform email, unverified emails aren't trusted
+func (g *GoogleData) GetEmail() string {
+	if !g.EmailVerified {
+		return ""
+	}
+	return g.Email
+}
+
+// GetUsername returns the platform username, Google accounts only have a display name
+func (g *GoogleData) GetUsername() string {
+	return g.Name
+}
+
+// GetData returns the platform data
+func (g *GoogleData) GetData() string {
+	data, _ := json.Marshal(g)
+	return string(data)
+}
+
+// CreateLinkedAccount creates a linked account
+func (g *GoogleData) CreateLinkedAccount(userID string) *auth.LinkedAccount {
+	return auth.NewLinkedAccount(userID, auth.PlatformGoogle, g.Name, g.Sub, g)
+}
+
+// -------------- Functions --------------
+
+// GetGoogleUser gets a Google user with the given access token
+func GetGoogleUser(token *auth.OAuthToken) (*GoogleData, error) {
+	var user GoogleData
+	err := getProviderJSON(GOOGLE_USERINFO_URL, token.AccessToken, &user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -1,9 +1,59 @@
 package linking
 
 import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
 	"github.com/NeuralNexusDev/neuralnexus-api/modules/auth"
 	"github.com/goccy/go-json"
 	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+)
+
+// -------------- Global Variables --------------
+
+//goland:noinspection GoSnakeCaseUsage
+var (
+	MICROSOFT_CLIENT_ID     = os.Getenv("MICROSOFT_CLIENT_ID")
+	MICROSOFT_CLIENT_SECRET = os.Getenv("MICROSOFT_CLIENT_SECRET")
+	MICROSOFT_REDIRECT_URI  = os.Getenv("MICROSOFT_REDIRECT_URI")
+	// MICROSOFT_AUTH_URL and the URLs below can be pointed at a local server for testing
+	MICROSOFT_AUTH_URL  = cmp.Or(os.Getenv("MICROSOFT_AUTH_URL"), "https://login.microsoftonline.com/consumers/oauth2/v2.0/authorize")
+	MICROSOFT_TOKEN_URL = cmp.Or(os.Getenv("MICROSOFT_TOKEN_URL"), "https://login.microsoftonline.com/consumers/oauth2/v2.0/token")
+	XBL_AUTH_URL        = cmp.Or(os.Getenv("XBL_AUTH_URL"), "https://user.auth.xboxlive.com/user/authenticate")
+	XSTS_AUTH_URL       = cmp.Or(os.Getenv("XSTS_AUTH_URL"), "https://xsts.auth.xboxlive.com/xsts/authorize")
+	MINECRAFT_API_URL   = cmp.Or(os.Getenv("MINECRAFT_API_URL"), "https://api.minecraftservices.com")
+	microsoftConfig     = &oauth2.Config{
+		ClientID:     MICROSOFT_CLIENT_ID,
+		ClientSecret: MICROSOFT_CLIENT_SECRET,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   MICROSOFT_AUTH_URL,
+			TokenURL:  MICROSOFT_TOKEN_URL,
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+		RedirectURL: MICROSOFT_REDIRECT_URI,
+		Scopes:      []string{"XboxLive.signin", "offline_access"},
+	}
+)
+
+const (
+	// XSTS error codes for accounts that can't get a token
+	xErrNoXboxAccount = 2148916233
+	xErrRegionBlocked = 2148916235
+	xErrAdultRequired = 2148916236
+	xErrChildAccount  = 2148916238
+)
+
+var (
+	ErrNoXboxAccount        = fmt.Errorf("%w: this Microsoft account has no Xbox profile, sign in to minecraft.net once to create one", ErrPlatformAccount)
+	ErrXboxUnavailable      = fmt.Errorf("%w: Xbox Live is not available in this Microsoft account's region", ErrPlatformAccount)
+	ErrChildAccount         = fmt.Errorf("%w: this Microsoft account must be added to a family by an adult", ErrPlatformAccount)
+	ErrMinecraftNotOwned    = fmt.Errorf("%w: this Microsoft account does not own Minecraft: Java Edition", ErrPlatformAccount)
+	ErrMinecraftAuthFailure = errors.New("failed to sign in to Minecraft services")
 )
 
 // -------------- Structs --------------
@@ -26,7 +76,36 @@ type Skin struct {
 }
 
 // Cape struct
-type Cape struct{}
+type Cape struct {
+	ID    uuid.UUID `json:"id" validate:"required"`
+	State string    `json:"state" validate:"required"`
+	URL   string    `json:"url" validate:"required"`
+	Alias string    `json:"alias" validate:"required"`
+}
+
+// xboxTokenResponse response from the Xbox Live and XSTS token endpoints
+type xboxTokenResponse struct {
+	Token         string `json:"Token"`
+	DisplayClaims struct {
+		XUI []struct {
+			UHS string `json:"uhs"`
+		} `json:"xui"`
+	} `json:"DisplayClaims"`
+}
+
+// xboxErrorResponse error response from the XSTS token endpoint
+type xboxErrorResponse struct {
+	XErr    int64  `json:"XErr"`
+	Message string `json:"Message"`
+}
+
+// minecraftProfile profile from the Minecraft services API, the ID has no dashes
+type minecraftProfile struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Skins []Skin `json:"skins"`
+	Capes []Cape `json:"capes"`
+}
 
 // GetID returns the platform ID
 func (m *MinecraftData) GetID() string {
@@ -53,3 +132,156 @@ func (m *MinecraftData) GetData() string {
 func (m *MinecraftData) CreateLinkedAccount(userID string) *auth.LinkedAccount {
 	return auth.NewLinkedAccount(userID, auth.PlatformMinecraft, m.Username, m.ID.String(), m)
 }
+
+// -------------- Functions --------------
+
+// postMinecraftJSON posts a JSON body and decodes the JSON response into out, or errOut if the request failed
+func postMinecraftJSON(url string, body any, out any, errOut any) (int, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := providerClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		if errOut != nil {
+			json.NewDecoder(resp.Body).Decode(errOut)
+		}
+		return resp.StatusCode, nil
+	}
+	return resp.StatusCode, json.NewDecoder(resp.Body).Decode(out)
+}
+
+// getXboxLiveToken exchanges a Microsoft access token for an Xbox Live token and user hash
+func getXboxLiveToken(accessToken string) (token string, userHash string, err error) {
+	var res xboxTokenResponse
+	status, err := postMinecraftJSON(XBL_AUTH_URL, map[string]any{
+		"Properties": map[string]any{
+			"AuthMethod": "RPS",
+			"SiteName":   "user.auth.xboxlive.com",
+			"RpsTicket":  "d=" + accessToken,
+		},
+		"RelyingParty": "http://auth.xboxlive.com",
+		"TokenType":    "JWT",
+	}, &res, nil)
+	if err != nil {
+		return "", "", err
+	}
+	if status != http.StatusOK || res.Token == "" || len(res.DisplayClaims.XUI) == 0 {
+		return "", "", fmt.Errorf("%w: Xbox Live returned %d", ErrMinecraftAuthFailure, status)
+	}
+	return res.Token, res.DisplayClaims.XUI[0].UHS, nil
+}
+
+// getXSTSToken exchanges an Xbox Live token for an XSTS token for Minecraft services
+func getXSTSToken(xblToken string) (string, error) {
+	var res xboxTokenResponse
+	var xErr xboxErrorResponse
+	status, err := postMinecraftJSON(XSTS_AUTH_URL, map[string]any{
+		"Properties": map[string]any{
+			"SandboxId":  "RETAIL",
+			"UserTokens": []string{xblToken},
+		},
+		"RelyingParty": "rp://api.minecraftservices.com/",
+		"TokenType":    "JWT",
+	}, &res, &xErr)
+	if err != nil {
+		return "", err
+	}
+	if status == http.StatusUnauthorized {
+		switch xErr.XErr {
+		case xErrNoXboxAccount:
+			return "", ErrNoXboxAccount
+		case xErrRegionBlocked:
+			return "", ErrXboxUnavailable
+		case xErrAdultRequired, xErrChildAccount:
+			return "", ErrChildAccount
+		}
+	}
+	if status != http.StatusOK || res.Token == "" {
+		return "", fmt.Errorf("%w: XSTS returned %d", ErrMinecraftAuthFailure, status)
+	}
+	return res.Token, nil
+}
+
+// getMinecraftToken exchanges an XSTS token for a Minecraft services access token
+func getMinecraftToken(userHash string, xstsToken string) (string, error) {
+	var res struct {
+		AccessToken string `json:"access_token"`
+	}
+	status, err := postMinecraftJSON(MINECRAFT_API_URL+"/authentication/login_with_xbox", map[string]string{
+		"identityToken": "XBL3.0 x=" + userHash + ";" + xstsToken,
+	}, &res, nil)
+	if err != nil {
+		return "", err
+	}
+	if status != http.StatusOK || res.AccessToken == "" {
+		return "", fmt.Errorf("%w: Minecraft services returned %d", ErrMinecraftAuthFailure, status)
+	}
+	return res.AccessToken, nil
+}
+
+// getMinecraftProfile gets the profile of the Minecraft account that owns the access token
+func getMinecraftProfile(accessToken string) (*MinecraftData, error) {
+	req, err := http.NewRequest(http.MethodGet, MINECRAFT_API_URL+"/minecraft/profile", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+	resp, err := providerClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Accounts without a profile don't own the game
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrMinecraftNotOwned
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: Minecraft profile returned %d", ErrMinecraftAuthFailure, resp.StatusCode)
+	}
+	var profile minecraftProfile
+	err = json.NewDecoder(resp.Body).Decode(&profile)
+	if err != nil {
+		return nil, err
+	}
+	id, err := uuid.Parse(profile.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &MinecraftData{
+		ID:       id,
+		Username: profile.Name,
+		Skins:    profile.Skins,
+		Capes:    profile.Capes,
+	}, nil
+}
+
+// GetMinecraftUser gets the Minecraft: Java Edition profile owned by a Microsoft account
+// Microsoft access token -> Xbox Live token -> XSTS token -> Minecraft services token -> profile
+func GetMinecraftUser(token *auth.OAuthToken) (*MinecraftData, error) {
+	xblToken, userHash, err := getXboxLiveToken(token.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	xstsToken, err := getXSTSToken(xblToken)
+	if err != nil {
+		return nil, err
+	}
+	mcToken, err := getMinecraftToken(userHash, xstsToken)
+	if err != nil {
+		return nil, err
+	}
+	return getMinecraftProfile(mcToken)
+}
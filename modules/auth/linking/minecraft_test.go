@@ -0,0 +1,136 @@
+package linking
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/auth"
+	"github.com/goccy/go-json"
+)
+
+// minecraftServer fakes Xbox Live, XSTS and Minecraft services, checking each step is given the previous step's token
+type minecraftServer struct {
+	xstsStatus    int
+	xstsXErr      int64
+	profileStatus int
+}
+
+func (m *minecraftServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body map[string]any
+	if r.Method == http.MethodPost {
+		json.NewDecoder(r.Body).Decode(&body)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/xbl":
+		props, _ := body["Properties"].(map[string]any)
+		if props["RpsTicket"] != "d=ms-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"Token":"xbl-token","DisplayClaims":{"xui":[{"uhs":"user-hash"}]}}`))
+	case "/xsts":
+		if m.xstsStatus != 0 {
+			w.WriteHeader(m.xstsStatus)
+			json.NewEncoder(w).Encode(xboxErrorResponse{XErr: m.xstsXErr})
+			return
+		}
+		props, _ := body["Properties"].(map[string]any)
+		tokens, _ := props["UserTokens"].([]any)
+		if len(tokens) != 1 || tokens[0] != "xbl-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"Token":"xsts-token","DisplayClaims":{"xui":[{"uhs":"user-hash"}]}}`))
+	case "/authentication/login_with_xbox":
+		if body["identityToken"] != "XBL3.0 x=user-hash;xsts-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"access_token":"mc-token"}`))
+	case "/minecraft/profile":
+		if r.Header.Get("Authorization") != "Bearer mc-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if m.profileStatus != 0 {
+			w.WriteHeader(m.profileStatus)
+			return
+		}
+		w.Write([]byte(`{"id":"069a79f444e94726a5befca90e38aaf5","name":"Notch","skins":[],"capes":[]}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// useMinecraftServer points the Minecraft sign in chain at a fake server for the rest of the test
+func useMinecraftServer(t *testing.T, m *minecraftServer) {
+	t.Helper()
+	server := httptest.NewServer(m)
+	t.Cleanup(server.Close)
+
+	xbl, xsts, api := XBL_AUTH_URL, XSTS_AUTH_URL, MINECRAFT_API_URL
+	XBL_AUTH_URL, XSTS_AUTH_URL, MINECRAFT_API_URL = server.URL+"/xbl", server.URL+"/xsts", server.URL
+	t.Cleanup(func() {
+		XBL_AUTH_URL, XSTS_AUTH_URL, MINECRAFT_API_URL = xbl, xsts, api
+	})
+}
+
+func TestGetMinecraftUser(t *testing.T) {
+	useMinecraftServer(t, &minecraftServer{})
+
+	user, err := GetMinecraftUser(&auth.OAuthToken{AccessToken: "ms-token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.GetID() != "069a79f4-44e9-4726-a5be-fca90e38aaf5" {
+		t.Errorf("got ID %q, want the profile ID with dashes", user.GetID())
+	}
+	if user.GetUsername() != "Notch" {
+		t.Errorf("got username %q, want %q", user.GetUsername(), "Notch")
+	}
+	if user.GetEmail() != "" {
+		t.Errorf("got email %q, Minecraft accounts have no email", user.GetEmail())
+	}
+}
+
+func TestGetMinecraftUserErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		server *minecraftServer
+		want   error
+	}{
+		{"no xbox account", &minecraftServer{xstsStatus: http.StatusUnauthorized, xstsXErr: xErrNoXboxAccount}, ErrNoXboxAccount},
+		{"region blocked", &minecraftServer{xstsStatus: http.StatusUnauthorized, xstsXErr: xErrRegionBlocked}, ErrXboxUnavailable},
+		{"child account", &minecraftServer{xstsStatus: http.StatusUnauthorized, xstsXErr: xErrChildAccount}, ErrChildAccount},
+		{"xsts down", &minecraftServer{xstsStatus: http.StatusServiceUnavailable}, ErrMinecraftAuthFailure},
+		{"game not owned", &minecraftServer{profileStatus: http.StatusNotFound}, ErrMinecraftNotOwned},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useMinecraftServer(t, tt.server)
+
+			_, err := GetMinecraftUser(&auth.OAuthToken{AccessToken: "ms-token"})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got error %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMinecraftAccountErrorsAreShownToUsers(t *testing.T) {
+	for _, err := range []error{ErrNoXboxAccount, ErrXboxUnavailable, ErrChildAccount, ErrMinecraftNotOwned} {
+		if !errors.Is(err, ErrPlatformAccount) {
+			t.Errorf("%v should wrap ErrPlatformAccount", err)
+		}
+		if !strings.Contains(err.Error(), ": ") {
+			t.Errorf("%v should explain why the account can't be used", err)
+		}
+	}
+	if errors.Is(ErrMinecraftAuthFailure, ErrPlatformAccount) {
+		t.Error("an outage isn't a problem with the user's account")
+	}
+}
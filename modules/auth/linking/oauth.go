@@ -3,13 +3,12 @@ package linking
 import (
 	"context"
 	"errors"
+	"fmt"
 	mw "github.com/NeuralNexusDev/neuralnexus-api/middleware"
 	"github.com/NeuralNexusDev/neuralnexus-api/modules/auth"
-	"github.com/NeuralNexusDev/neuralnexus-api/modules/twitch"
 	"golang.org/x/oauth2"
 	"log"
 	"net/http"
-	"time"
 )
 
 // -------------- Structs --------------
@@ -22,19 +21,30 @@ const (
 	ModeLink  Mode = "link"
 )
 
-// OAuthState used with the OAuth state URL parameter
+var (
+	ErrNotSignedIn            = errors.New("you must be signed in to link an account")
+	ErrLinkStartedByOther     = errors.New("the link was started by a different user")
+	ErrLinkedToAnotherAccount = auth.ErrLinkedToAnotherAccount
+	ErrPlatformAlreadyLinked  = auth.ErrPlatformAlreadyLinked
+	// ErrPlatformAccount wraps errors about a platform account that can't be used, the message is meant for the user
+	ErrPlatformAccount = errors.New("platform account can't be used")
+	ErrEmailInUse      = fmt.Errorf("%w: an account already uses this email, sign in to it and link this platform instead", ErrPlatformAccount)
+)
+
+// OAuthState kept on the server for an OAuth flow, the state URL parameter only refers to it
 type OAuthState struct {
 	Platform    auth.Platform `json:"platform"`
-	Nonce       string        `json:"nonce"`
 	RedirectURI string        `json:"redirect_uri"`
 	Mode        Mode          `json:"mode"`
+	Verifier    string        `json:"verifier"`
+	UserID      string        `json:"user_id,omitempty"`
 }
 
 // -------------- Functions --------------
 
-// ExtCodeForToken exchanges the code for an access token and returns a auth.OAuthToken
-func ExtCodeForToken(config *oauth2.Config, code string) (*auth.OAuthToken, error) {
-	token, err := config.Exchange(context.Background(), code)
+// ExtCodeForToken exchanges the code and its PKCE verifier for an access token and returns a auth.OAuthToken
+func ExtCodeForToken(config *oauth2.Config, code string, verifier string) (*auth.OAuthToken, error) {
+	token, err := config.Exchange(context.Background(), code, oauth2.VerifierOption(verifier))
 	if err != nil {
 		return nil, err
 	}
@@ -42,57 +52,21 @@ func ExtCodeForToken(config *oauth2.Config, code string) (*auth.OAuthToken, erro
 		return nil, errors.New("failed to exchange code for access token")
 	}
 
-	var scopes []string
-	if rawScopes, ok := token.Extra("scope").([]interface{}); ok {
-		for _, s := range rawScopes {
-			if str, ok := s.(string); ok {
-				scopes = append(scopes, str)
-			}
-		}
-		// Discord is special and returns a single string if there's only one scope
-	} else if rawScopes, ok := token.Extra("scope").(string); ok {
-		scopes = []string{rawScopes}
-	} else {
+	scopes, ok := auth.TokenScope(token)
+	if !ok {
 		return nil, errors.New("failed to get scope from token")
 	}
-
-	var scopedToken = &auth.OAuthToken{
-		Token: token,
-		Scope: scopes,
-	}
-
-	return scopedToken, nil
+	return auth.NewOAuthToken(token, scopes), nil
 }
 
-// RefreshToken refreshes the token and returns a auth.OAuthToken
-func RefreshToken(config *oauth2.Config, token *oauth2.Token) (*auth.OAuthToken, error) {
-	newToken, err := config.TokenSource(context.Background(), token).Token()
+// saveToken keeps the platform token so it can be used and refreshed later
+func saveToken(tokens auth.OAuthTokenService, token *auth.OAuthToken, userID string, platform auth.Platform) {
+	token.UserID = userID
+	token.Platform = platform
+	err := tokens.SaveToken(token)
 	if err != nil {
-		return nil, err
-	}
-	if newToken == nil {
-		return nil, errors.New("failed to refresh token")
+		log.Println("Failed to save OAuth token:\n\t", err)
 	}
-
-	var scopes []string
-	if rawScopes, ok := newToken.Extra("scope").([]interface{}); ok {
-		for _, s := range rawScopes {
-			if str, ok := s.(string); ok {
-				scopes = append(scopes, str)
-			}
-		}
-	} else if rawScopes, ok := newToken.Extra("scope").(string); ok {
-		scopes = []string{rawScopes}
-	} else {
-		return nil, errors.New("failed to get scope from token")
-	}
-
-	var scopedToken = &auth.OAuthToken{
-		Token: newToken,
-		Scope: scopes,
-	}
-
-	return scopedToken, nil
 }
 
 // DeferStoreSession adds a session to the session service and logs an error if it fails
@@ -104,32 +78,16 @@ func DeferStoreSession(ss auth.SessionService, session *auth.Session) {
 }
 
 // ProcessOAuthLogin processes the OAuth2 code and returns a session
-func ProcessOAuthLogin(as auth.AccountService, las auth.LinkAccountStore, ss auth.SessionService, code string, state *OAuthState) (*auth.Session, error) {
-	var err error
-	var config *oauth2.Config
-	switch state.Platform {
-	case auth.PlatformDiscord:
-		config = discordConfig
-	case auth.PlatformTwitch:
-		config = twitch.Config
-	default:
-		return nil, errors.New("invalid platform")
-	}
-	var token *auth.OAuthToken
-	token, err = ExtCodeForToken(config, code)
+func ProcessOAuthLogin(r *http.Request, as auth.AccountService, las auth.LinkAccountStore, ss auth.SessionService, tokens auth.OAuthTokenService, lockout auth.LockoutService, code string, state *OAuthState) (*auth.Session, error) {
+	provider, err := GetProvider(state.Platform)
 	if err != nil {
 		return nil, err
 	}
-
-	var user auth.PlatformData
-	switch state.Platform {
-	case auth.PlatformDiscord:
-		user, err = GetDiscordUser(token)
-	case auth.PlatformTwitch:
-		user, err = twitch.GetUser(token)
-	default:
-		return nil, errors.New("invalid platform")
+	token, err := ExtCodeForToken(provider.Config(), code, state.Verifier)
+	if err != nil {
+		return nil, err
 	}
+	user, err := provider.GetUser(token)
 	if err != nil {
 		return nil, err
 	}
@@ -138,12 +96,25 @@ func ProcessOAuthLogin(as auth.AccountService, las auth.LinkAccountStore, ss aut
 	var la *auth.LinkedAccount
 	var session *auth.Session
 	la, err = las.GetLinkedAccountByPlatformID(state.Platform, user.GetID())
-	if err != nil {
-		a, err = auth.NewPasswordLessAccount(user.GetUsername(), user.GetEmail())
+	if err == nil && !la.Verified {
+		// A link made with a link code can't be used to sign in, it was only vouched for by whoever redeemed the code.
+		// Whoever just signed in to the platform account owns it, so the unverified link is dropped
+		err = las.DeleteLinkedAccount(la.UserID, la.Platform)
 		if err != nil {
 			return nil, err
 		}
-		err = as.AddAccount(a)
+		la = nil
+	}
+	if la == nil {
+		a, err = as.AddPlatformAccount(user.GetUsername(), user.GetEmail())
+		if errors.Is(err, auth.ErrEmailTaken) {
+			return nil, ErrEmailInUse
+		} else if err != nil {
+			return nil, err
+		}
+		// Link the platform account so the next login finds the same user
+		la = auth.NewLinkedAccount(a.UserID, state.Platform, user.GetUsername(), user.GetID(), user)
+		err = las.AddLinkedAccountToDB(la)
 		if err != nil {
 			return nil, err
 		}
@@ -154,70 +125,50 @@ func ProcessOAuthLogin(as auth.AccountService, las auth.LinkAccountStore, ss aut
 		}
 	}
 
-	session, err = a.NewSession(time.Now().Add(time.Hour * 24).Unix())
+	saveToken(tokens, token, a.UserID, state.Platform)
+
+	attempt := &auth.LoginAttempt{UserAgent: r.UserAgent(), RemoteAddr: mw.RemoteAddr(r.Context())}
+	err = lockout.LoginSucceeded(a, attempt, string(state.Platform))
+	if err != nil {
+		log.Println("Failed to record login:\n\t", err)
+	}
+
+	session, err = a.NewSession(auth.NewSessionExpiry())
 	if err != nil {
 		return nil, err
 	}
+	session.SetClient(r.UserAgent(), mw.RemoteAddr(r.Context()))
 
 	defer DeferStoreSession(ss, session)
 	return session, nil
 }
 
-// ProcessOAuthLink links an account to an existing user
-func ProcessOAuthLink(r *http.Request, las auth.LinkAccountStore, code string, state *OAuthState) (*auth.Session, error) {
-	var err error
-	var config *oauth2.Config
-	switch state.Platform {
-	case auth.PlatformDiscord:
-		config = discordConfig
-	case auth.PlatformTwitch:
-		config = twitch.Config
-	default:
-		return nil, errors.New("invalid platform")
-	}
-	var token *auth.OAuthToken
-	token, err = ExtCodeForToken(config, code)
-	if err != nil {
-		return nil, err
-	}
-
-	var user auth.PlatformData
-	switch state.Platform {
-	case auth.PlatformDiscord:
-		user, err = GetDiscordUser(token)
-	case auth.PlatformTwitch:
-		user, err = twitch.GetUser(token)
-	default:
-		return nil, errors.New("invalid platform")
+// ProcessOAuthLink links a platform account to the signed-in user
+func ProcessOAuthLink(session *auth.Session, las auth.LinkAccountStore, tokens auth.OAuthTokenService, code string, state *OAuthState) error {
+	if session == nil || !session.IsValid() {
+		return ErrNotSignedIn
 	}
-	if err != nil {
-		return nil, err
+	if session.UserID != state.UserID {
+		return ErrLinkStartedByOther
 	}
 
-	// Get session from request context
-	session, ok := r.Context().Value(mw.SessionKey).(*auth.Session)
-	if !ok || session == nil {
-		return nil, errors.New("session not found")
+	provider, err := GetProvider(state.Platform)
+	if err != nil {
+		return err
 	}
-	if session.IsValid() {
-		return nil, errors.New("session expired")
+	token, err := ExtCodeForToken(provider.Config(), code, state.Verifier)
+	if err != nil {
+		return err
 	}
-
-	// Check if platform account is linked to an account
-	la, err := las.GetLinkedAccountByPlatformID(state.Platform, user.GetID())
-	if err == nil {
-		// Return an error if the linked account is not the same as the current session
-		if session.UserID != la.UserID {
-			return nil, errors.New("platform account already linked to another account")
-		}
+	user, err := provider.GetUser(token)
+	if err != nil {
+		return err
 	}
 
-	// Link account
-	la = auth.NewLinkedAccount(session.UserID, state.Platform, user.GetUsername(), user.GetID(), user)
-	err = las.AddLinkedAccountToDB(la)
+	err = auth.LinkPlatformAccount(las, auth.NewLinkedAccount(session.UserID, state.Platform, user.GetUsername(), user.GetID(), user))
 	if err != nil {
-		return nil, errors.New("failed to link account")
+		return err
 	}
-
-	return session, nil
+	saveToken(tokens, token, session.UserID, state.Platform)
+	return nil
 }
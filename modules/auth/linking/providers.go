@@ -0,0 +1,130 @@
+package linking
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/auth"
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/twitch"
+	"github.com/goccy/go-json"
+	"golang.org/x/oauth2"
+)
+
+var ErrUnknownProvider = errors.New("invalid platform")
+
+// providerClient - HTTP client for provider APIs that don't have their own client library
+var providerClient = &http.Client{Timeout: 10 * time.Second}
+
+// -------------- Structs --------------
+
+// Provider an OAuth platform that users can log in with or link to their account
+type Provider interface {
+	Platform() auth.Platform
+	Config() *oauth2.Config
+	GetUser(token *auth.OAuthToken) (auth.PlatformData, error)
+}
+
+// provider - Provider built from a config and a function that fetches the platform user
+type provider struct {
+	platform auth.Platform
+	config   *oauth2.Config
+	getUser  func(token *auth.OAuthToken) (auth.PlatformData, error)
+}
+
+// NewProvider creates a provider from a config and a function that fetches the platform user
+func NewProvider(platform auth.Platform, config *oauth2.Config, getUser func(token *auth.OAuthToken) (auth.PlatformData, error)) Provider {
+	return &provider{platform, config, getUser}
+}
+
+// Platform returns the platform the provider signs in to
+func (p *provider) Platform() auth.Platform {
+	return p.platform
+}
+
+// Config returns the provider's OAuth2 config
+func (p *provider) Config() *oauth2.Config {
+	return p.config
+}
+
+// GetUser fetches the platform user that the token belongs to
+func (p *provider) GetUser(token *auth.OAuthToken) (auth.PlatformData, error) {
+	return p.getUser(token)
+}
+
+// -------------- Registry --------------
+
+// providers - Every registered provider by platform
+var providers = struct {
+	sync.RWMutex
+	byPlatform map[auth.Platform]Provider
+}{byPlatform: map[auth.Platform]Provider{}}
+
+func init() {
+	RegisterProvider(NewProvider(auth.PlatformDiscord, discordConfig, func(token *auth.OAuthToken) (auth.PlatformData, error) {
+		return GetDiscordUser(token)
+	}))
+	RegisterProvider(NewProvider(auth.PlatformTwitch, twitch.Config, func(token *auth.OAuthToken) (auth.PlatformData, error) {
+		return twitch.GetUser(token)
+	}))
+	RegisterProvider(NewProvider(auth.PlatformMinecraft, microsoftConfig, func(token *auth.OAuthToken) (auth.PlatformData, error) {
+		return GetMinecraftUser(token)
+	}))
+	RegisterProvider(NewProvider(auth.PlatformGitHub, githubConfig, func(token *auth.OAuthToken) (auth.PlatformData, error) {
+		return GetGitHubUser(token)
+	}))
+	RegisterProvider(NewProvider(auth.PlatformGoogle, googleConfig, func(token *auth.OAuthToken) (auth.PlatformData, error) {
+		return GetGoogleUser(token)
+	}))
+}
+
+// RegisterProvider adds a provider, replacing any provider already registered for its platform
+func RegisterProvider(p Provider) {
+	providers.Lock()
+	defer providers.Unlock()
+	providers.byPlatform[p.Platform()] = p
+}
+
+// GetProvider gets the provider for a platform
+func GetProvider(platform auth.Platform) (Provider, error) {
+	providers.RLock()
+	defer providers.RUnlock()
+	p, ok := providers.byPlatform[platform]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return p, nil
+}
+
+// Configs gets the OAuth2 config for each platform that can be linked with OAuth
+func Configs() map[auth.Platform]*oauth2.Config {
+	providers.RLock()
+	defer providers.RUnlock()
+	configs := map[auth.Platform]*oauth2.Config{}
+	for platform, p := range providers.byPlatform {
+		configs[platform] = p.Config()
+	}
+	return configs
+}
+
+// -------------- Functions --------------
+
+// getProviderJSON gets a provider API resource with the user's access token
+func getProviderJSON(url string, accessToken string, out any) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+	resp, err := providerClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("provider returned " + resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
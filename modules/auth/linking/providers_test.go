@@ -0,0 +1,134 @@
+package linking
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/auth"
+)
+
+// providerServer serves fixed JSON responses by path to requests made with the expected access token
+func providerServer(t *testing.T, responses map[string]string) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer platform-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, ok := responses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestGetGitHubUser(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses map[string]string
+		wantEmail string
+	}{
+		{
+			name: "public email",
+			responses: map[string]string{
+				"/user": `{"id":583231,"login":"octocat","name":"The Octocat","email":"octocat@github.com"}`,
+			},
+			wantEmail: "octocat@github.com",
+		},
+		{
+			name: "private email uses the primary verified email",
+			responses: map[string]string{
+				"/user": `{"id":583231,"login":"octocat","name":"The Octocat","email":null}`,
+				"/user/emails": `[{"email":"old@example.com","primary":false,"verified":true},` +
+					`{"email":"octocat@example.com","primary":true,"verified":true}]`,
+			},
+			wantEmail: "octocat@example.com",
+		},
+		{
+			name: "unverified primary email is not used",
+			responses: map[string]string{
+				"/user":        `{"id":583231,"login":"octocat","name":"The Octocat","email":null}`,
+				"/user/emails": `[{"email":"octocat@example.com","primary":true,"verified":false}]`,
+			},
+			wantEmail: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiURL := GITHUB_API_URL
+			GITHUB_API_URL = providerServer(t, tt.responses)
+			t.Cleanup(func() { GITHUB_API_URL = apiURL })
+
+			user, err := GetGitHubUser(&auth.OAuthToken{AccessToken: "platform-token"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.GetID() != "583231" {
+				t.Errorf("got ID %q, want %q", user.GetID(), "583231")
+			}
+			if user.GetUsername() != "octocat" {
+				t.Errorf("got username %q, want the login %q", user.GetUsername(), "octocat")
+			}
+			if user.GetEmail() != tt.wantEmail {
+				t.Errorf("got email %q, want %q", user.GetEmail(), tt.wantEmail)
+			}
+		})
+	}
+}
+
+func TestGetGoogleUser(t *testing.T) {
+	tests := []struct {
+		name      string
+		userinfo  string
+		wantEmail string
+	}{
+		{
+			name:      "verified email",
+			userinfo:  `{"sub":"110169484474386276334","name":"Jane Doe","email":"jane@example.com","email_verified":true}`,
+			wantEmail: "jane@example.com",
+		},
+		{
+			name:      "unverified email is not trusted",
+			userinfo:  `{"sub":"110169484474386276334","name":"Jane Doe","email":"jane@example.com","email_verified":false}`,
+			wantEmail: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userinfoURL := GOOGLE_USERINFO_URL
+			GOOGLE_USERINFO_URL = providerServer(t, map[string]string{"/userinfo": tt.userinfo}) + "/userinfo"
+			t.Cleanup(func() { GOOGLE_USERINFO_URL = userinfoURL })
+
+			user, err := GetGoogleUser(&auth.OAuthToken{AccessToken: "platform-token"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.GetID() != "110169484474386276334" {
+				t.Errorf("got ID %q, want the subject", user.GetID())
+			}
+			if user.GetUsername() != "Jane Doe" {
+				t.Errorf("got username %q, want the display name", user.GetUsername())
+			}
+			if user.GetEmail() != tt.wantEmail {
+				t.Errorf("got email %q, want %q", user.GetEmail(), tt.wantEmail)
+			}
+		})
+	}
+}
+
+func TestGetProviderUserRejectedToken(t *testing.T) {
+	apiURL := GITHUB_API_URL
+	GITHUB_API_URL = providerServer(t, map[string]string{"/user": `{}`})
+	t.Cleanup(func() { GITHUB_API_URL = apiURL })
+
+	_, err := GetGitHubUser(&auth.OAuthToken{AccessToken: "wrong-token"})
+	if err == nil {
+		t.Error("expected an error when the provider rejects the token")
+	}
+}
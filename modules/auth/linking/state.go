@@ -0,0 +1,116 @@
+package linking
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/auth"
+	"golang.org/x/oauth2"
+)
+
+// -------------- Global Variables --------------
+
+//goland:noinspection GoSnakeCaseUsage
+var (
+	// OAUTH_REDIRECT_ORIGINS comma separated list of origins the OAuth callback may redirect to, defaults to NN_SITE_URL
+	OAUTH_REDIRECT_ORIGINS = os.Getenv("OAUTH_REDIRECT_ORIGINS")
+)
+
+// OAuthStateTTL - How long a user has to finish signing in with the platform
+var OAuthStateTTL = 10 * time.Minute
+
+var (
+	ErrInvalidMode        = errors.New("mode must be login or link")
+	ErrInvalidState       = errors.New("invalid or expired state")
+	ErrRedirectNotAllowed = errors.New("redirect_uri is not allowed")
+)
+
+// -------------- Functions --------------
+
+// redirectOrigins gets the origins the OAuth callback may redirect to
+func redirectOrigins() []string {
+	origins := []string{auth.NN_SITE_URL}
+	if OAUTH_REDIRECT_ORIGINS != "" {
+		origins = strings.Split(OAUTH_REDIRECT_ORIGINS, ",")
+	}
+	for i, origin := range origins {
+		origins[i] = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(origin), "/"))
+	}
+	return origins
+}
+
+// ValidateRedirectURI checks that the OAuth callback may redirect to a URI and returns it as an absolute URL
+// Paths are relative to the site, anything else has to be on one of the allowed origins
+func ValidateRedirectURI(redirectURI string) (string, error) {
+	if redirectURI == "" {
+		redirectURI = "/"
+	}
+	if strings.HasPrefix(redirectURI, "/") {
+		redirectURI = strings.TrimSuffix(auth.NN_SITE_URL, "/") + redirectURI
+	}
+	u, err := url.Parse(redirectURI)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.User != nil {
+		return "", ErrRedirectNotAllowed
+	}
+	origin := strings.ToLower(u.Scheme + "://" + u.Host)
+	for _, allowed := range redirectOrigins() {
+		if origin == allowed {
+			return u.String(), nil
+		}
+	}
+	return "", ErrRedirectNotAllowed
+}
+
+// StartOAuth stores a new OAuth state and returns the platform URL to send the user to, along with the state
+// The state holds the PKCE verifier and the checked redirect, so nothing the callback trusts comes from the query string.
+// Linking is tied to the signed-in user so the callback can't link the platform account to anyone else
+func StartOAuth(store Store, platform auth.Platform, mode Mode, redirectURI string, session *auth.Session) (string, string, error) {
+	provider, err := GetProvider(platform)
+	if err != nil {
+		return "", "", err
+	}
+	state := &OAuthState{
+		Platform: platform,
+		Mode:     mode,
+		Verifier: oauth2.GenerateVerifier(),
+	}
+	switch mode {
+	case ModeLogin:
+	case ModeLink:
+		if session == nil || !session.IsValid() {
+			return "", "", ErrNotSignedIn
+		}
+		state.UserID = session.UserID
+	default:
+		return "", "", ErrInvalidMode
+	}
+	state.RedirectURI, err = ValidateRedirectURI(redirectURI)
+	if err != nil {
+		return "", "", err
+	}
+
+	stateToken, err := auth.GenerateToken()
+	if err != nil {
+		return "", "", err
+	}
+	err = store.AddOAuthState(auth.HashToken(stateToken), state, OAuthStateTTL)
+	if err != nil {
+		return "", "", err
+	}
+	return provider.Config().AuthCodeURL(stateToken, oauth2.S256ChallengeOption(state.Verifier)), stateToken, nil
+}
+
+// ConsumeOAuthState gets the OAuth state for the callback, a state can only be used once
+func ConsumeOAuthState(store Store, stateToken string) (*OAuthState, error) {
+	if stateToken == "" {
+		return nil, ErrInvalidState
+	}
+	state, err := store.ConsumeOAuthState(auth.HashToken(stateToken))
+	if err != nil {
+		return nil, ErrInvalidState
+	}
+	return state, nil
+}
@@ -0,0 +1,55 @@
+package linking
+
+import (
+	"context"
+	"github.com/goccy/go-json"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// Store interface
+type Store interface {
+	AddOAuthState(stateHash string, state *OAuthState, ttl time.Duration) error
+	ConsumeOAuthState(stateHash string) (*OAuthState, error)
+}
+
+// store - Store implementation
+type store struct {
+	rdb *redis.Client
+}
+
+// NewStore - Create a new store
+func NewStore(rdb *redis.Client) Store {
+	return &store{
+		rdb: rdb,
+	}
+}
+
+// AddOAuthState stores an OAuth state under its hash until the platform redirects back
+func (s *store) AddOAuthState(stateHash string, state *OAuthState, ttl time.Duration) error {
+	stringState, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.rdb.Set(context.Background(), "oauth_state:"+stateHash, stringState, ttl).Result()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ConsumeOAuthState gets an OAuth state and removes it so it can only be used once
+func (s *store) ConsumeOAuthState(stateHash string) (*OAuthState, error) {
+	var state OAuthState
+	stringState, err := s.rdb.GetDel(context.Background(), "oauth_state:"+stateHash).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(stringState), &state)
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/database"
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/email"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// LoginLockoutThreshold - Failed logins in a row before the account is locked
+	LoginLockoutThreshold = 5
+	// LoginLockoutBase - How long the first lockout lasts, every failure after that doubles it
+	LoginLockoutBase = time.Minute
+	// LoginLockoutMax - The longest an account is locked for at a time
+	LoginLockoutMax = time.Hour
+	// LoginFailureWindow - How long failed logins are remembered after the last one
+	LoginFailureWindow = 24 * time.Hour
+)
+
+// AuthEventType - What happened in an auth event
+type AuthEventType string
+
+const (
+	AuthEventLoginSucceeded  AuthEventType = "login_succeeded"
+	AuthEventLoginFailed     AuthEventType = "login_failed"
+	AuthEventLoginBlocked    AuthEventType = "login_blocked"
+	AuthEventAccountLocked   AuthEventType = "account_locked"
+	AuthEventAccountUnlocked AuthEventType = "account_unlocked"
+)
+
+var ErrAccountNotFound = errors.New("account not found")
+
+// -------------- Structs --------------
+
+// AuthEvent struct, a record of a login or lockout kept for auditing
+type AuthEvent struct {
+	EventID   string        `json:"event_id" xml:"event_id" db:"event_id"`
+	UserID    string        `json:"user_id" xml:"user_id" db:"user_id"`
+	Type      AuthEventType `json:"type" xml:"type" db:"type"`
+	Detail    string        `json:"detail,omitempty" xml:"detail,omitempty" db:"detail"`
+	IPAddress string        `json:"ip_address,omitempty" xml:"ip_address,omitempty" db:"ip_address"`
+	UserAgent string        `json:"user_agent,omitempty" xml:"user_agent,omitempty" db:"user_agent"`
+	CreatedAt time.Time     `json:"created_at" xml:"created_at" db:"created_at"`
+}
+
+// LoginAttempt struct describing where a login came from
+type LoginAttempt struct {
+	UserAgent  string
+	RemoteAddr string
+}
+
+// -------------- Service --------------
+
+// LockoutService - Login brute-force protection and auth event auditing interface
+type LockoutService interface {
+	LockedFor(userID string) (time.Duration, error)
+	LoginFailed(account *Account, attempt *LoginAttempt, detail string) (time.Duration, error)
+	LoginSucceeded(account *Account, attempt *LoginAttempt, detail string) error
+	LoginBlocked(account *Account, attempt *LoginAttempt)
+	Unlock(session *Session, userID string) error
+	GetAuthEvents(userID string, limit int) ([]*AuthEvent, error)
+}
+
+// lockoutService - LockoutService implementation
+type lockoutService struct {
+	as     AccountStore
+	store  LockoutStore
+	events AuthEventStore
+	sender email.Sender
+}
+
+// NewLockoutService - Create a new lockout service, the user is emailed when their account is locked if sender isn't nil
+func NewLockoutService(store Store, sender email.Sender) LockoutService {
+	return &lockoutService{
+		as:     store.Account(),
+		store:  store.Lockout(),
+		events: store.AuthEvent(),
+		sender: sender,
+	}
+}
+
+// lockoutDuration gets how long an account is locked for after a number of failed logins in a row
+func lockoutDuration(failures int) time.Duration {
+	if failures < LoginLockoutThreshold {
+		return 0
+	}
+	lock := LoginLockoutBase
+	for range failures - LoginLockoutThreshold {
+		lock *= 2
+		if lock >= LoginLockoutMax {
+			return LoginLockoutMax
+		}
+	}
+	return min(lock, LoginLockoutMax)
+}
+
+// recordEvent adds an auth event, failing to record one doesn't stop the login
+func (s *lockoutService) recordEvent(userID string, eventType AuthEventType, attempt *LoginAttempt, detail string) {
+	id, err := database.GenSnowflake()
+	if err != nil {
+		log.Println("Failed to record auth event:\n\t", err)
+		return
+	}
+	event := &AuthEvent{
+		EventID: id,
+		UserID:  userID,
+		Type:    eventType,
+		Detail:  detail,
+	}
+	if attempt != nil {
+		event.IPAddress = attempt.RemoteAddr
+		event.UserAgent = attempt.UserAgent
+	}
+	err = s.events.AddAuthEventToDB(event)
+	if err != nil {
+		log.Println("Failed to record auth event:\n\t", err)
+	}
+}
+
+// LockedFor gets how much longer an account is locked for, zero if it isn't locked
+func (s *lockoutService) LockedFor(userID string) (time.Duration, error) {
+	return s.store.GetLoginLock(userID)
+}
+
+// LoginFailed counts a failed login against the account, locking it once there have been too many in a row.
+// It returns how long the account is now locked for
+func (s *lockoutService) LoginFailed(account *Account, attempt *LoginAttempt, detail string) (time.Duration, error) {
+	s.recordEvent(account.UserID, AuthEventLoginFailed, attempt, detail)
+	failures, err := s.store.IncrementLoginFailures(account.UserID, LoginFailureWindow)
+	if err != nil {
+		return 0, err
+	}
+	lock := lockoutDuration(failures)
+	if lock == 0 {
+		return 0, nil
+	}
+	err = s.store.SetLoginLock(account.UserID, lock)
+	if err != nil {
+		return 0, err
+	}
+	s.recordEvent(account.UserID, AuthEventAccountLocked, attempt, lock.String())
+
+	// Only the first lockout is sent, so someone guessing can't flood the user's inbox
+	if failures == LoginLockoutThreshold && s.sender != nil && account.EmailVerified {
+		err = s.sender.Send(&email.Message{
+			To:      account.Email,
+			Subject: "Your NeuralNexus account was locked",
+			Body: "Hi " + account.Username + ",\n\n" +
+				"There were too many failed attempts to sign in to your account, so signing in is paused for a while.\n\n" +
+				"If this wasn't you, someone may know your username or email. You can reset your password from the sign in page at:\n\n" +
+				NN_SITE_URL + "\n",
+		})
+		if err != nil {
+			log.Println("Failed to send lockout email:\n\t", err)
+		}
+	}
+	return lock, nil
+}
+
+// LoginSucceeded clears the account's failed logins and records the login
+func (s *lockoutService) LoginSucceeded(account *Account, attempt *LoginAttempt, detail string) error {
+	s.recordEvent(account.UserID, AuthEventLoginSucceeded, attempt, detail)
+	return s.store.ClearLoginFailures(account.UserID)
+}
+
+// LoginBlocked records a login that was turned away because the account is locked
+func (s *lockoutService) LoginBlocked(account *Account, attempt *LoginAttempt) {
+	s.recordEvent(account.UserID, AuthEventLoginBlocked, attempt, "")
+}
+
+// Unlock lets an admin clear an account's lockout and failed logins
+func (s *lockoutService) Unlock(session *Session, userID string) error {
+	_, err := s.as.GetAccountByID(userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrAccountNotFound
+	} else if err != nil {
+		return err
+	}
+	err = s.store.ClearLoginFailures(userID)
+	if err != nil {
+		return err
+	}
+	s.recordEvent(userID, AuthEventAccountUnlocked, nil, "by "+session.UserID)
+	return nil
+}
+
+// GetAuthEvents gets an account's most recent auth events
+func (s *lockoutService) GetAuthEvents(userID string, limit int) ([]*AuthEvent, error) {
+	return s.events.GetAuthEventsFromDB(userID, limit)
+}
@@ -0,0 +1,279 @@
+package auth
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/encryption"
+)
+
+// -------------- Globals --------------
+
+//goland:noinspection GoSnakeCaseUsage
+var (
+	// MFA_ENCRYPTION_KEY AES key used to encrypt TOTP secrets at rest, must be 16, 24 or 32 bytes
+	MFA_ENCRYPTION_KEY = os.Getenv("MFA_ENCRYPTION_KEY")
+)
+
+const (
+	TokenPurposeMFAPending TokenPurpose = "mfa_pending"
+
+	RecoveryCodeCount = 10
+)
+
+// MFAPendingTTL - How long a user has to complete the second login step
+var MFAPendingTTL = 5 * time.Minute
+
+// MFAMaxAttempts - Wrong codes allowed for a pending token before it's used up and the user has to sign in again
+var MFAMaxAttempts = 3
+
+var (
+	ErrTOTPNotEnrolled = errors.New("totp is not enrolled")
+	ErrTOTPEnabled     = errors.New("totp is already enabled")
+	ErrInvalidMFACode  = errors.New("invalid code")
+	ErrInvalidMFAToken = errors.New("invalid or expired token")
+)
+
+// -------------- Structs --------------
+
+// TOTP struct
+type TOTP struct {
+	UserID        string    `db:"user_id"`
+	Secret        []byte    `db:"secret"`
+	Enabled       bool      `db:"enabled"`
+	RecoveryCodes []string  `db:"recovery_codes"`
+	LastUsedStep  int64     `db:"last_used_step"`
+	CreatedAt     time.Time `db:"created_at"`
+	UpdatedAt     time.Time `db:"updated_at"`
+}
+
+// TOTPEnrollment struct returned when a user starts enrolling an authenticator
+type TOTPEnrollment struct {
+	Secret string `json:"secret" xml:"secret"`
+	URI    string `json:"uri" xml:"uri"`
+}
+
+// -------------- Service --------------
+
+// MFAService - Multi-factor authentication service interface
+type MFAService interface {
+	EnrollTOTP(account *Account) (*TOTPEnrollment, error)
+	ConfirmTOTP(userID, code string) ([]string, error)
+	DisableTOTP(userID, code string) error
+	IsTOTPEnabled(userID string) bool
+	CreateMFAChallenge(userID string) (string, error)
+	GetMFAChallenge(token string) (string, error)
+	VerifyMFAChallenge(token, code string) (string, error)
+}
+
+// mfaService - MFAService implementation
+type mfaService struct {
+	store  TOTPStore
+	tokens OneTimeTokenStore
+}
+
+// NewMFAService - Create a new MFA service
+func NewMFAService(store Store) MFAService {
+	return &mfaService{
+		store:  store.TOTP(),
+		tokens: store.OneTimeToken(),
+	}
+}
+
+// EnrollTOTP generates a new secret for the account, it is not enforced until confirmed with a code
+func (s *mfaService) EnrollTOTP(account *Account) (*TOTPEnrollment, error) {
+	existing, err := s.store.GetTOTP(account.UserID)
+	if err == nil && existing.Enabled {
+		return nil, ErrTOTPEnabled
+	}
+
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := encryption.EncryptAES(secret, MFA_ENCRYPTION_KEY)
+	if err != nil {
+		return nil, err
+	}
+	err = s.store.UpsertTOTP(&TOTP{
+		UserID:        account.UserID,
+		Secret:        encrypted,
+		Enabled:       false,
+		RecoveryCodes: []string{},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	name := account.Username
+	if name == "" {
+		name = account.UserID
+	}
+	return &TOTPEnrollment{
+		Secret: EncodeTOTPSecret(secret),
+		URI:    TOTPURI(name, secret),
+	}, nil
+}
+
+// ConfirmTOTP enables TOTP once the user proves their authenticator works, returning fresh recovery codes
+func (s *mfaService) ConfirmTOTP(userID, code string) ([]string, error) {
+	totp, err := s.store.GetTOTP(userID)
+	if err != nil {
+		return nil, ErrTOTPNotEnrolled
+	}
+	if totp.Enabled {
+		return nil, ErrTOTPEnabled
+	}
+	secret, err := encryption.DecryptAES(totp.Secret, MFA_ENCRYPTION_KEY)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := ValidateTOTP(secret, code, time.Now(), totp.LastUsedStep)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	totp.Enabled = true
+	totp.LastUsedStep = step
+	totp.RecoveryCodes = hashes
+	err = s.store.UpsertTOTP(totp)
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTOTP removes TOTP from an account after checking a current or recovery code
+func (s *mfaService) DisableTOTP(userID, code string) error {
+	totp, err := s.store.GetTOTP(userID)
+	if err != nil {
+		return ErrTOTPNotEnrolled
+	}
+	if totp.Enabled {
+		err = s.verifyCode(totp, code)
+		if err != nil {
+			return err
+		}
+	}
+	return s.store.DeleteTOTP(userID)
+}
+
+// IsTOTPEnabled checks whether a user has to supply a second factor when logging in
+func (s *mfaService) IsTOTPEnabled(userID string) bool {
+	totp, err := s.store.GetTOTP(userID)
+	if err != nil {
+		return false
+	}
+	return totp.Enabled
+}
+
+// CreateMFAChallenge issues a short-lived token that stands in for the session until the second factor is checked
+func (s *mfaService) CreateMFAChallenge(userID string) (string, error) {
+	token, err := GenerateToken()
+	if err != nil {
+		return "", err
+	}
+	err = s.tokens.AddOneTimeToken(TokenPurposeMFAPending, token, userID, MFAPendingTTL)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// GetMFAChallenge gets the user ID a pending token belongs to without using it up
+func (s *mfaService) GetMFAChallenge(token string) (string, error) {
+	userID, err := s.tokens.GetOneTimeToken(TokenPurposeMFAPending, token)
+	if err != nil {
+		return "", ErrInvalidMFAToken
+	}
+	return userID, nil
+}
+
+// VerifyMFAChallenge checks a TOTP or recovery code against a pending token, returning the user ID
+// The pending token survives a wrong code so the user can retry, until MFAMaxAttempts wrong codes use it up
+func (s *mfaService) VerifyMFAChallenge(token, code string) (string, error) {
+	userID, err := s.GetMFAChallenge(token)
+	if err != nil {
+		return "", err
+	}
+	totp, err := s.store.GetTOTP(userID)
+	if err != nil || !totp.Enabled {
+		return "", ErrTOTPNotEnrolled
+	}
+	err = s.verifyCode(totp, code)
+	if errors.Is(err, ErrInvalidMFACode) {
+		failures, err := s.tokens.IncrementOneTimeTokenFailures(TokenPurposeMFAPending, token, MFAPendingTTL)
+		if err != nil || failures >= MFAMaxAttempts {
+			_, _ = s.tokens.ConsumeOneTimeToken(TokenPurposeMFAPending, token)
+		}
+		return "", ErrInvalidMFACode
+	} else if err != nil {
+		return "", err
+	}
+	_, err = s.tokens.ConsumeOneTimeToken(TokenPurposeMFAPending, token)
+	if err != nil {
+		return "", ErrInvalidMFAToken
+	}
+	return userID, nil
+}
+
+// verifyCode accepts either a TOTP code or an unused recovery code, persisting whichever was used
+func (s *mfaService) verifyCode(totp *TOTP, code string) error {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+
+	secret, err := encryption.DecryptAES(totp.Secret, MFA_ENCRYPTION_KEY)
+	if err != nil {
+		return err
+	}
+	if step, ok := ValidateTOTP(secret, code, time.Now(), totp.LastUsedStep); ok {
+		totp.LastUsedStep = step
+		return s.store.UpsertTOTP(totp)
+	}
+
+	hash := HashToken(normalizeRecoveryCode(code))
+	for i, h := range totp.RecoveryCodes {
+		if h == hash {
+			totp.RecoveryCodes = append(totp.RecoveryCodes[:i], totp.RecoveryCodes[i+1:]...)
+			return s.store.UpsertTOTP(totp)
+		}
+	}
+	return ErrInvalidMFACode
+}
+
+// -------------- Recovery Codes --------------
+
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// generateRecoveryCodes creates a set of recovery codes and their hashes for storage
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+	// rand.Int picks each character evenly, a byte modulo the alphabet's length would favour the first few
+	alphabetLength := big.NewInt(int64(len(recoveryCodeAlphabet)))
+	for i := range codes {
+		b := make([]byte, 10)
+		for j := range b {
+			n, err := rand.Int(rand.Reader, alphabetLength)
+			if err != nil {
+				return nil, nil, err
+			}
+			b[j] = recoveryCodeAlphabet[n.Int64()]
+		}
+		codes[i] = string(b[:5]) + "-" + string(b[5:])
+		hashes[i] = HashToken(normalizeRecoveryCode(codes[i]))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode strips formatting so codes can be typed loosely
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(code, "-", ""))
+}
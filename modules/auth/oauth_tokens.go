@@ -0,0 +1,263 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/encryption"
+	"golang.org/x/oauth2"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+var (
+	// OAUTH_TOKEN_KEYS Versioned AES keys that wrap the data keys encrypting platform tokens at rest,
+	// e.g. "1:base64key,2:base64key". The highest version is used for new tokens, older ones only to read
+	OAUTH_TOKEN_KEYS = os.Getenv("OAUTH_TOKEN_KEYS")
+)
+
+// oauthKeyRing - The key ring parsed from OAUTH_TOKEN_KEYS
+var oauthKeyRing = sync.OnceValues(func() (*encryption.KeyRing, error) {
+	return encryption.ParseKeyRing(OAUTH_TOKEN_KEYS)
+})
+
+// oauthRewrapBatch - How many tokens are moved to the current key at a time
+const oauthRewrapBatch = 100
+
+var (
+	// oauthRefreshInterval - How often stored platform tokens are checked for expiry
+	oauthRefreshInterval = 5 * time.Minute
+	// oauthRefreshWindow - Tokens expiring within this window are refreshed ahead of time
+	oauthRefreshWindow = 15 * time.Minute
+	// oauthRefreshLockTTL - How long an instance holds a token while refreshing it
+	oauthRefreshLockTTL = 30 * time.Second
+)
+
+var (
+	ErrOAuthTokenInvalid = errors.New("platform token is invalid, the platform has to be authorized again")
+	ErrNoOAuthConfig     = errors.New("no OAuth config for platform")
+	errRefreshLocked     = errors.New("token is being refreshed by another instance")
+)
+
+// TokenScope gets the scopes granted with a token
+func TokenScope(token *oauth2.Token) ([]string, bool) {
+	if rawScopes, ok := token.Extra("scope").([]interface{}); ok {
+		var scopes []string
+		for _, s := range rawScopes {
+			if str, ok := s.(string); ok {
+				scopes = append(scopes, str)
+			}
+		}
+		return scopes, true
+		// Discord, Microsoft and Google return a space separated string instead, GitHub separates them with commas
+	} else if rawScopes, ok := token.Extra("scope").(string); ok {
+		return strings.FieldsFunc(rawScopes, func(r rune) bool { return r == ' ' || r == ',' }), true
+	}
+	return nil, false
+}
+
+// -------------- Service --------------
+
+// OAuthTokenService - Keeps the platform tokens of linked accounts usable
+type OAuthTokenService interface {
+	SaveToken(token *OAuthToken) error
+	TokenSource(userID string, platform Platform) oauth2.TokenSource
+	DeleteToken(userID string, platform Platform) error
+	RefreshExpiringTokens()
+	RewrapTokens() (int, error)
+	StartTokenRefresher()
+}
+
+// oauthTokenService - OAuthTokenService implementation
+type oauthTokenService struct {
+	store   OAuthTokenStore
+	keys    OAuthTokenKeyStore
+	configs map[Platform]*oauth2.Config
+}
+
+// NewOAuthTokenService - Create a new OAuth token service, configs are used to refresh each platform's tokens
+func NewOAuthTokenService(store Store, configs map[Platform]*oauth2.Config) OAuthTokenService {
+	return &oauthTokenService{
+		store:   store.OAuthToken(),
+		keys:    store.OAuthTokenKey(),
+		configs: configs,
+	}
+}
+
+// SaveToken stores a token, replacing the user's existing token for the platform
+func (s *oauthTokenService) SaveToken(token *OAuthToken) error {
+	return s.store.AddOAuthTokenToDB(token)
+}
+
+// DeleteToken removes a user's token for a platform
+func (s *oauthTokenService) DeleteToken(userID string, platform Platform) error {
+	return s.store.DeleteOAuthToken(userID, platform)
+}
+
+// refresh exchanges a token's refresh token for a new access token
+// Tokens the platform refuses to refresh are marked invalid
+func (s *oauthTokenService) refresh(token *OAuthToken) (*OAuthToken, error) {
+	config, ok := s.configs[token.Platform]
+	if !ok {
+		return nil, ErrNoOAuthConfig
+	}
+	locked, err := s.store.LockOAuthTokenRefresh(token.UserID, token.Platform, oauthRefreshLockTTL)
+	if err != nil {
+		return nil, err
+	}
+	if !locked {
+		return nil, errRefreshLocked
+	}
+	defer func() {
+		err := s.store.UnlockOAuthTokenRefresh(token.UserID, token.Platform)
+		if err != nil {
+			log.Println("Failed to unlock OAuth token refresh:\n\t", err)
+		}
+	}()
+
+	// The token may have been refreshed since it was read, only the stored refresh token is still usable
+	token, err = s.store.GetOAuthTokenByUserID(token.UserID, token.Platform)
+	if err != nil {
+		return nil, err
+	}
+	if token.Invalid {
+		return nil, ErrOAuthTokenInvalid
+	}
+	if token.Expiry.After(time.Now().Add(oauthRefreshWindow)) {
+		return token, nil
+	}
+
+	// Clear the access token so the token source refreshes even if it hasn't expired yet
+	old := token.OAuth2()
+	old.AccessToken = ""
+	newToken, err := config.TokenSource(context.Background(), old).Token()
+	if err != nil {
+		var retrieveErr *oauth2.RetrieveError
+		if errors.As(err, &retrieveErr) && retrieveErr.ErrorCode == "invalid_grant" {
+			invalidateErr := s.store.InvalidateOAuthToken(token.UserID, token.Platform)
+			if invalidateErr != nil {
+				log.Println("Failed to invalidate OAuth token:\n\t", invalidateErr)
+			}
+			return nil, ErrOAuthTokenInvalid
+		}
+		return nil, err
+	}
+
+	scope, ok := TokenScope(newToken)
+	if !ok {
+		scope = token.Scope
+	}
+	refreshed := NewOAuthToken(newToken, scope)
+	refreshed.UserID = token.UserID
+	refreshed.Platform = token.Platform
+	err = s.store.UpdateOAuthToken(refreshed)
+	if err != nil {
+		return nil, err
+	}
+	return refreshed, nil
+}
+
+// RefreshExpiringTokens refreshes every token that expires soon
+func (s *oauthTokenService) RefreshExpiringTokens() {
+	tokens, err := s.store.GetExpiringOAuthTokens(time.Now().Add(oauthRefreshWindow))
+	if err != nil {
+		log.Println("Failed to get expiring OAuth tokens:\n\t", err)
+		return
+	}
+	for _, token := range tokens {
+		_, err := s.refresh(token)
+		if err != nil && !errors.Is(err, errRefreshLocked) {
+			log.Printf("Failed to refresh %s token for user %s:\n\t%v", token.Platform, token.UserID, err)
+		}
+	}
+}
+
+// RewrapTokens encrypts any tokens stored before encryption, then moves every token still wrapped by an older key to
+// the current key. Once it returns without an error the older keys can be removed from OAUTH_TOKEN_KEYS
+func (s *oauthTokenService) RewrapTokens() (int, error) {
+	total := 0
+	for _, batch := range []func(int) (int, error){s.keys.EncryptLegacyOAuthTokens, s.keys.RewrapOAuthTokens} {
+		for {
+			n, err := batch(oauthRewrapBatch)
+			total += n
+			if err != nil {
+				return total, err
+			}
+			if n < oauthRewrapBatch {
+				break
+			}
+		}
+	}
+	return total, nil
+}
+
+// StartTokenRefresher refreshes tokens in the background before they expire, and moves them to the current key
+func (s *oauthTokenService) StartTokenRefresher() {
+	go func() {
+		ticker := time.NewTicker(oauthRefreshInterval)
+		defer ticker.Stop()
+		for {
+			s.RefreshExpiringTokens()
+			n, err := s.RewrapTokens()
+			if err != nil {
+				log.Println("Failed to rewrap OAuth tokens:\n\t", err)
+			} else if n > 0 {
+				log.Printf("Rewrapped %d OAuth tokens with the current key", n)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// TokenSource gets a token source for a user's platform token, refreshing it when needed
+func (s *oauthTokenService) TokenSource(userID string, platform Platform) oauth2.TokenSource {
+	return oauth2.ReuseTokenSource(nil, &storedTokenSource{s, userID, platform})
+}
+
+// storedTokenSource - Token source backed by the token store
+type storedTokenSource struct {
+	service  *oauthTokenService
+	userID   string
+	platform Platform
+}
+
+// Token gets the stored token, refreshing it if it has expired
+func (ts *storedTokenSource) Token() (*oauth2.Token, error) {
+	token, err := ts.service.store.GetOAuthTokenByUserID(ts.userID, ts.platform)
+	if err != nil {
+		return nil, err
+	}
+	if token.Invalid {
+		return nil, ErrOAuthTokenInvalid
+	}
+	if token.OAuth2().Valid() {
+		return token.OAuth2(), nil
+	}
+
+	refreshed, err := ts.service.refresh(token)
+	if errors.Is(err, errRefreshLocked) {
+		// Another instance is refreshing it, wait for the new token to be stored
+		for range 10 {
+			time.Sleep(200 * time.Millisecond)
+			token, err = ts.service.store.GetOAuthTokenByUserID(ts.userID, ts.platform)
+			if err != nil {
+				return nil, err
+			}
+			if token.Invalid {
+				return nil, ErrOAuthTokenInvalid
+			}
+			if token.OAuth2().Valid() {
+				return token.OAuth2(), nil
+			}
+		}
+		return nil, errRefreshLocked
+	}
+	if err != nil {
+		return nil, err
+	}
+	return refreshed.OAuth2(), nil
+}
@@ -0,0 +1,275 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	mw "github.com/NeuralNexusDev/neuralnexus-api/middleware"
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/auth"
+	perms "github.com/NeuralNexusDev/neuralnexus-api/modules/auth/permissions"
+)
+
+// DeviceCodeGrantType - grant_type a device uses to poll the token endpoint (RFC 8628)
+const DeviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+const (
+	deviceStatusPending  = "pending"
+	deviceStatusApproved = "approved"
+	deviceStatusDenied   = "denied"
+
+	userCodeLength = 8
+	// userCodeAlphabet - Consonants only, so codes can't spell words and are easy to type on a game keyboard (RFC 8628 section 6.1)
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+)
+
+// newUserCode generates a random user code, formatted as XXXX-XXXX
+func newUserCode() (string, error) {
+	// rand.Int picks each character evenly, a byte modulo the alphabet's length would favour the first few
+	alphabetLength := big.NewInt(int64(len(userCodeAlphabet)))
+	b := make([]byte, userCodeLength)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, alphabetLength)
+		if err != nil {
+			return "", err
+		}
+		b[i] = userCodeAlphabet[n.Int64()]
+	}
+	return string(b[:userCodeLength/2]) + "-" + string(b[userCodeLength/2:]), nil
+}
+
+// NormalizeUserCode uppercases a user code and puts the dash back, so it can be typed with or without it
+func NormalizeUserCode(code string) string {
+	code = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(userCodeAlphabet, r) {
+			return r
+		}
+		return -1
+	}, strings.ToUpper(code))
+	if len(code) != userCodeLength {
+		return code
+	}
+	return code[:userCodeLength/2] + "-" + code[userCodeLength/2:]
+}
+
+// deviceScopes narrows the scopes a device asked for to the ones the user can grant
+// API keys aren't tied to a client, so identity scopes are left out of them
+func deviceScopes(code *DeviceCode, held []string) ([]string, []ConsentScope) {
+	scopes, _ := ParseScopes(code.Scope)
+	if code.APIKey {
+		scopes = slices.DeleteFunc(scopes, func(scope perms.Scope) bool {
+			return scope.Name == "oidc"
+		})
+	}
+	return consentScopes(scopes, held)
+}
+
+// AuthorizeDevice starts a device authorization, the device shows the user code and polls the token endpoint
+// Devices ask for an API key instead of a session with token_format=api_key, for clients that can't keep refreshing
+func (s *service) AuthorizeDevice(r *http.Request) (*DeviceAuthorization, error) {
+	err := r.ParseForm()
+	if err != nil {
+		return nil, newError("invalid_request", "invalid form body")
+	}
+	client, err := s.authenticateClient(r)
+	if err != nil {
+		return nil, err
+	}
+	_, err = ParseScopes(r.PostFormValue("scope"))
+	if err != nil {
+		return nil, newError(ErrInvalidScope.Code, err.Error())
+	}
+	var apiKey bool
+	switch r.PostFormValue("token_format") {
+	case "", "jwt":
+	case "api_key":
+		apiKey = true
+	default:
+		return nil, newError("invalid_request", "token_format must be jwt or api_key")
+	}
+
+	deviceCode, err := auth.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+	code := &DeviceCode{
+		ClientID: client.ClientID,
+		Scope:    r.PostFormValue("scope"),
+		APIKey:   apiKey,
+		Status:   deviceStatusPending,
+	}
+	for range 3 {
+		code.UserCode, err = newUserCode()
+		if err != nil {
+			return nil, err
+		}
+		added, err := s.store.AddDeviceCode(auth.HashToken(deviceCode), code, DeviceCodeTTL)
+		if err != nil {
+			return nil, err
+		}
+		if !added {
+			continue
+		}
+		verificationURI := auth.NN_SITE_URL + "/oauth/device"
+		return &DeviceAuthorization{
+			DeviceCode:              deviceCode,
+			UserCode:                code.UserCode,
+			VerificationURI:         verificationURI,
+			VerificationURIComplete: verificationURI + "?user_code=" + url.QueryEscape(code.UserCode),
+			ExpiresIn:               int64(DeviceCodeTTL.Seconds()),
+			Interval:                int64(DevicePollInterval.Seconds()),
+		}, nil
+	}
+	return nil, errors.New("failed to generate a unique user code")
+}
+
+// pendingDeviceCode gets a device code that is still waiting for the user
+func (s *service) pendingDeviceCode(userCode string) (string, *DeviceCode, error) {
+	codeHash, code, err := s.store.GetDeviceCodeByUserCode(NormalizeUserCode(userCode))
+	if err != nil || code.Status != deviceStatusPending {
+		return "", nil, ErrDeviceCodeNotFound
+	}
+	return codeHash, code, nil
+}
+
+// GetDeviceConsent gets what the site should show the user after they enter a user code
+func (s *service) GetDeviceConsent(session *auth.Session, userCode string) (*DeviceConsent, error) {
+	_, code, err := s.pendingDeviceCode(userCode)
+	if err != nil {
+		return nil, err
+	}
+	client, err := s.store.GetClient(code.ClientID)
+	if err != nil {
+		return nil, ErrDeviceCodeNotFound
+	}
+	account, err := s.as.GetAccountByID(session.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, scopes := deviceScopes(code, account.Permissions())
+	return &DeviceConsent{
+		UserCode:   code.UserCode,
+		ClientID:   client.ClientID,
+		ClientName: client.Name,
+		APIKey:     code.APIKey,
+		Scopes:     scopes,
+	}, nil
+}
+
+// DecideDevice answers a device authorization, the user can approve only some of the scopes the device asked for
+func (s *service) DecideDevice(session *auth.Session, decision *DeviceDecision) error {
+	codeHash, code, err := s.pendingDeviceCode(decision.UserCode)
+	if err != nil {
+		return err
+	}
+	code.UserID = session.UserID
+	if !decision.Approve {
+		code.Status = deviceStatusDenied
+		return s.store.UpdateDeviceCode(codeHash, code)
+	}
+
+	account, err := s.as.GetAccountByID(session.UserID)
+	if err != nil {
+		return err
+	}
+	offered, _ := deviceScopes(code, account.Permissions())
+	granted := offered
+	if decision.Scopes != nil {
+		chosen, err := ParseScopes(strings.Join(decision.Scopes, " "))
+		if err != nil {
+			return newError(ErrInvalidScope.Code, err.Error())
+		}
+		granted = []string{}
+		for _, scope := range chosen {
+			p := scope.String()
+			if !slices.Contains(offered, p) {
+				return newError(ErrInvalidScope.Code, "scope was not requested by the device: "+ScopeString(scope))
+			}
+			if !slices.Contains(granted, p) {
+				granted = append(granted, p)
+			}
+		}
+	}
+
+	code.Status = deviceStatusApproved
+	code.Scopes = granted
+	code.AuthTime = session.IssuedAt
+	return s.store.UpdateDeviceCode(codeHash, code)
+}
+
+// exchangeDeviceCode answers a device polling the token endpoint, issuing a session or API key once the user approves
+func (s *service) exchangeDeviceCode(r *http.Request, client *Client) (*TokenResponse, error) {
+	codeHash := auth.HashToken(r.PostFormValue("device_code"))
+	code, err := s.store.GetDeviceCode(codeHash)
+	if err != nil {
+		return nil, ErrExpiredToken
+	}
+	if code.ClientID != client.ClientID {
+		return nil, ErrInvalidGrant
+	}
+
+	switch code.Status {
+	case deviceStatusPending:
+		polled, err := s.store.PollDeviceCode(codeHash, DevicePollInterval)
+		if err != nil {
+			return nil, err
+		}
+		if !polled {
+			return nil, ErrSlowDown
+		}
+		return nil, ErrAuthorizationPending
+	case deviceStatusDenied:
+		_, _ = s.store.ConsumeDeviceCode(codeHash)
+		return nil, ErrAccessDenied
+	}
+
+	// Consuming the code again makes sure two polls can't both be issued tokens
+	code, err = s.store.ConsumeDeviceCode(codeHash)
+	if err != nil {
+		return nil, ErrExpiredToken
+	}
+	account, err := s.as.GetAccountByID(code.UserID)
+	if err != nil {
+		return nil, ErrInvalidGrant
+	}
+	session, err := account.NewSession(auth.NewSessionExpiry())
+	if err != nil {
+		return nil, err
+	}
+	session.Permissions = auth.GrantedPermissions(code.Scopes, account.Permissions())
+
+	if code.APIKey {
+		key, err := s.ks.CreateAPIKey(session, "Device: "+client.Name, session.Permissions, 0)
+		if err != nil {
+			return nil, err
+		}
+		return &TokenResponse{
+			AccessToken: key.Key,
+			TokenType:   "Bearer",
+			Scope:       scopeParam(key.Permissions),
+		}, nil
+	}
+
+	session.ClientID = client.ClientID
+	session.SetClient(r.UserAgent(), mw.RemoteAddr(r.Context()))
+	err = s.ss.AddSession(session)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.tokenResponse(session, true)
+	if err != nil {
+		return nil, err
+	}
+	if session.HasPermission(perms.ScopeOIDC(ScopeOpenID)) {
+		resp.IDToken, err = s.createIDToken(account, client, session, "", code.AuthTime)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,269 @@
+package oidc
+
+import (
+	"errors"
+	"github.com/goccy/go-json"
+	"github.com/jackc/pgx/v5"
+	"log"
+	"net/http"
+
+	mw "github.com/NeuralNexusDev/neuralnexus-api/middleware"
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/auth"
+	"github.com/NeuralNexusDev/neuralnexus-api/responses"
+)
+
+// sendJSON writes a JSON response that must not be cached, as required for token responses
+func sendJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+// -------------- Handlers --------------
+
+// DiscoveryHandler serves the OpenID Connect discovery document
+func DiscoveryHandler(s Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(s.Discovery())
+	}
+}
+
+// RegisterClientHandler registers a client owned by the current user
+func RegisterClientHandler(s Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, _ := mw.GetSession(r.Context())
+
+		var reg ClientRegistration
+		err := responses.DecodeStruct(r, &reg)
+		if err != nil {
+			responses.BadRequest(w, r, "Invalid request body")
+			return
+		}
+
+		client, err := s.RegisterClient(session.UserID, &reg)
+		if err != nil {
+			responses.BadRequest(w, r, err.Error())
+			return
+		}
+		responses.SendStruct(w, r, http.StatusCreated, client)
+	}
+}
+
+// GetClientsHandler lists the current user's clients
+func GetClientsHandler(s Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, _ := mw.GetSession(r.Context())
+
+		clients, err := s.GetClients(session.UserID)
+		if err != nil {
+			log.Println("Failed to get OAuth clients:\n\t", err)
+			responses.InternalServerError(w, r, "Failed to get clients")
+			return
+		}
+		responses.StructOK(w, r, Clients{clients})
+	}
+}
+
+// DeleteClientHandler deletes one of the current user's clients
+func DeleteClientHandler(s Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, _ := mw.GetSession(r.Context())
+
+		err := s.DeleteClient(session.UserID, r.PathValue("client_id"))
+		if errors.Is(err, pgx.ErrNoRows) {
+			responses.NotFound(w, r, "Client not found")
+			return
+		} else if err != nil {
+			log.Println("Failed to delete OAuth client:\n\t", err)
+			responses.InternalServerError(w, r, "Failed to delete client")
+			return
+		}
+		responses.NoContent(w, r)
+	}
+}
+
+// AuthorizeHandler validates an authorization request and returns what the consent screen should show
+// The site renders the consent screen, errors the client should see come back as a redirect instead
+func AuthorizeHandler(s Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, _ := mw.GetSession(r.Context())
+
+		consent, redirect, err := s.Authorize(session, r.URL.Query())
+		if err != nil {
+			responses.BadRequest(w, r, err.Error())
+			return
+		}
+		if redirect != nil {
+			responses.StructOK(w, r, redirect)
+			return
+		}
+		responses.StructOK(w, r, consent)
+	}
+}
+
+// ConsentHandler records the user's answer on the consent screen
+func ConsentHandler(s Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, _ := mw.GetSession(r.Context())
+
+		var decision ConsentDecision
+		err := responses.DecodeStruct(r, &decision)
+		if err != nil {
+			responses.BadRequest(w, r, "Invalid request body")
+			return
+		}
+
+		redirect, err := s.Decide(session, &decision)
+		if errors.Is(err, ErrRequestNotFound) {
+			responses.NotFound(w, r, "Authorization request not found or expired")
+			return
+		} else if err != nil {
+			log.Println("Failed to answer authorization request:\n\t", err)
+			responses.InternalServerError(w, r, "Failed to answer authorization request")
+			return
+		}
+		responses.StructOK(w, r, redirect)
+	}
+}
+
+// sendTokenError writes an RFC 6749 error from an endpoint that clients authenticate to
+func sendTokenError(w http.ResponseWriter, err error, action string) {
+	var oauthErr *Error
+	switch {
+	case errors.Is(err, ErrInvalidClient):
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		sendJSON(w, http.StatusUnauthorized, err)
+	case errors.As(err, &oauthErr):
+		sendJSON(w, http.StatusBadRequest, oauthErr)
+	default:
+		log.Println("Failed to "+action+":\n\t", err)
+		sendJSON(w, http.StatusInternalServerError, newError("server_error", ""))
+	}
+}
+
+// TokenHandler exchanges grants for tokens, responding with RFC 6749 errors
+func TokenHandler(s Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, err := s.Token(r)
+		if err != nil {
+			sendTokenError(w, err, "issue OAuth token")
+			return
+		}
+		sendJSON(w, http.StatusOK, token)
+	}
+}
+
+// IntrospectHandler tells a confidential client whether a token is still active (RFC 7662)
+func IntrospectHandler(s Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		introspection, err := s.Introspect(r)
+		if err != nil {
+			sendTokenError(w, err, "introspect token")
+			return
+		}
+		sendJSON(w, http.StatusOK, introspection)
+	}
+}
+
+// RevokeHandler revokes a token issued to a confidential client (RFC 7009)
+func RevokeHandler(s Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := s.Revoke(r)
+		if err != nil {
+			sendTokenError(w, err, "revoke token")
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// DeviceAuthorizationHandler starts a device authorization for clients that can't open a browser
+func DeviceAuthorizationHandler(s Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authorization, err := s.AuthorizeDevice(r)
+		if err != nil {
+			sendTokenError(w, err, "start device authorization")
+			return
+		}
+		sendJSON(w, http.StatusOK, authorization)
+	}
+}
+
+// DeviceConsentHandler looks up the device for the user code the user entered on the site
+func DeviceConsentHandler(s Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, _ := mw.GetSession(r.Context())
+
+		consent, err := s.GetDeviceConsent(session, r.URL.Query().Get("user_code"))
+		if errors.Is(err, ErrDeviceCodeNotFound) {
+			responses.NotFound(w, r, "Device code not found or expired")
+			return
+		} else if err != nil {
+			log.Println("Failed to get device authorization:\n\t", err)
+			responses.InternalServerError(w, r, "Failed to get device authorization")
+			return
+		}
+		responses.StructOK(w, r, consent)
+	}
+}
+
+// DeviceDecisionHandler records the user's answer for a device
+func DeviceDecisionHandler(s Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, _ := mw.GetSession(r.Context())
+
+		var decision DeviceDecision
+		err := responses.DecodeStruct(r, &decision)
+		if err != nil {
+			responses.BadRequest(w, r, "Invalid request body")
+			return
+		}
+
+		err = s.DecideDevice(session, &decision)
+		var oauthErr *Error
+		switch {
+		case errors.Is(err, ErrDeviceCodeNotFound):
+			responses.NotFound(w, r, "Device code not found or expired")
+			return
+		case errors.As(err, &oauthErr):
+			responses.BadRequest(w, r, oauthErr.Description)
+			return
+		case err != nil:
+			log.Println("Failed to answer device authorization:\n\t", err)
+			responses.InternalServerError(w, r, "Failed to answer device authorization")
+			return
+		}
+		responses.NoContent(w, r)
+	}
+}
+
+// UserInfoHandler returns the claims about the user that the access token allows
+func UserInfoHandler(s Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := r.Context().Value(mw.SessionKey).(*auth.Session)
+		if !ok || session == nil {
+			responses.Unauthorized(w, r, "")
+			return
+		}
+
+		info, err := s.UserInfo(session)
+		var oauthErr *Error
+		if errors.As(err, &oauthErr) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="`+oauthErr.Code+`"`)
+			responses.Forbidden(w, r, oauthErr.Description)
+			return
+		} else if err != nil {
+			log.Println("Failed to get user info:\n\t", err)
+			responses.InternalServerError(w, r, "Failed to get user info")
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		responses.StructOK(w, r, info)
+	}
+}
@@ -0,0 +1,676 @@
+package oidc
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	mw "github.com/NeuralNexusDev/neuralnexus-api/middleware"
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/auth"
+	perms "github.com/NeuralNexusDev/neuralnexus-api/modules/auth/permissions"
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/database"
+)
+
+var (
+	// AuthorizationRequestTTL - How long the user has to answer the consent screen
+	AuthorizationRequestTTL = 10 * time.Minute
+	// AuthorizationCodeTTL - How long a client has to redeem an authorization code
+	AuthorizationCodeTTL = time.Minute
+	// IDTokenTTL - How long an id_token is valid for
+	IDTokenTTL = time.Hour
+	// DeviceCodeTTL - How long the user has to approve a device
+	DeviceCodeTTL = 15 * time.Minute
+	// DevicePollInterval - How long a device has to wait between polls of the token endpoint
+	DevicePollInterval = 5 * time.Second
+)
+
+// Service - OpenID Connect provider service interface
+type Service interface {
+	RegisterClient(ownerID string, reg *ClientRegistration) (*NewClient, error)
+	GetClients(ownerID string) ([]*Client, error)
+	DeleteClient(ownerID, clientID string) error
+	Authorize(session *auth.Session, params url.Values) (*Consent, *ConsentRedirect, error)
+	Decide(session *auth.Session, decision *ConsentDecision) (*ConsentRedirect, error)
+	AuthorizeDevice(r *http.Request) (*DeviceAuthorization, error)
+	GetDeviceConsent(session *auth.Session, userCode string) (*DeviceConsent, error)
+	DecideDevice(session *auth.Session, decision *DeviceDecision) error
+	Token(r *http.Request) (*TokenResponse, error)
+	Introspect(r *http.Request) (*Introspection, error)
+	Revoke(r *http.Request) error
+	UserInfo(session *auth.Session) (*UserInfo, error)
+	Discovery() *Discovery
+}
+
+// service - Service implementation
+type service struct {
+	store Store
+	as    auth.AccountStore
+	ss    auth.SessionService
+	keys  auth.SigningKeyService
+	ks    auth.APIKeyService
+	sas   auth.ServiceAccountService
+}
+
+// NewService - Create a new OpenID Connect provider service
+func NewService(store Store, authStore auth.Store, ss auth.SessionService, keys auth.SigningKeyService, ks auth.APIKeyService, sas auth.ServiceAccountService) Service {
+	return &service{
+		store: store,
+		as:    authStore.Account(),
+		ss:    ss,
+		keys:  keys,
+		ks:    ks,
+		sas:   sas,
+	}
+}
+
+// -------------- Clients --------------
+
+// validateRedirectURI checks that a redirect URI is absolute and safe to send codes to
+// Plain http is only allowed for loopback addresses, which is what native apps use during development
+func validateRedirectURI(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() || u.Fragment != "" {
+		return errors.New("invalid redirect uri: " + uri)
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if host := u.Hostname(); host == "localhost" || host == "127.0.0.1" || host == "::1" {
+			return nil
+		}
+		return errors.New("redirect uri must use https: " + uri)
+	case "javascript", "data", "file":
+		return errors.New("invalid redirect uri: " + uri)
+	default:
+		// Private-use URI schemes for native apps
+		return nil
+	}
+}
+
+// RegisterClient registers a new client, confidential clients get a secret that is only shown once
+func (s *service) RegisterClient(ownerID string, reg *ClientRegistration) (*NewClient, error) {
+	reg.Name = strings.TrimSpace(reg.Name)
+	if reg.Name == "" {
+		return nil, errors.New("client name is required")
+	}
+	if len(reg.RedirectURIs) == 0 {
+		return nil, errors.New("at least one redirect uri is required")
+	}
+	for _, uri := range reg.RedirectURIs {
+		err := validateRedirectURI(uri)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	id, err := database.GenSnowflake()
+	if err != nil {
+		return nil, err
+	}
+	client := &Client{
+		ClientID:     id,
+		OwnerID:      ownerID,
+		Name:         reg.Name,
+		RedirectURIs: reg.RedirectURIs,
+		Public:       reg.Public,
+		CreatedAt:    time.Now(),
+	}
+	var secret string
+	if !reg.Public {
+		secret, err = auth.GenerateToken()
+		if err != nil {
+			return nil, err
+		}
+		client.SecretHash = auth.HashToken(secret)
+	}
+	err = s.store.AddClient(client)
+	if err != nil {
+		return nil, err
+	}
+	return &NewClient{client, secret}, nil
+}
+
+// GetClients lists the clients a user has registered
+func (s *service) GetClients(ownerID string) ([]*Client, error) {
+	return s.store.GetClientsByOwner(ownerID)
+}
+
+// DeleteClient removes one of a user's clients
+func (s *service) DeleteClient(ownerID, clientID string) error {
+	return s.store.DeleteClient(ownerID, clientID)
+}
+
+// clientCredentials reads the client ID and secret, sent with HTTP basic auth or in the form
+func clientCredentials(r *http.Request) (string, string, error) {
+	clientID, secret, ok := r.BasicAuth()
+	if ok {
+		var err error
+		if clientID, err = url.QueryUnescape(clientID); err != nil {
+			return "", "", ErrInvalidClient
+		}
+		if secret, err = url.QueryUnescape(secret); err != nil {
+			return "", "", ErrInvalidClient
+		}
+	} else {
+		clientID = r.PostFormValue("client_id")
+		secret = r.PostFormValue("client_secret")
+	}
+	if clientID == "" {
+		return "", "", ErrInvalidClient
+	}
+	return clientID, secret, nil
+}
+
+// authenticateClient identifies the client calling the token endpoint
+// Confidential clients send their secret, public clients only send their ID
+func (s *service) authenticateClient(r *http.Request) (*Client, error) {
+	clientID, secret, err := clientCredentials(r)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := s.store.GetClient(clientID)
+	if err != nil {
+		return nil, ErrInvalidClient
+	}
+	if client.Public {
+		if secret != "" {
+			return nil, ErrInvalidClient
+		}
+		return client, nil
+	}
+	if secret == "" || subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.SecretHash)) != 1 {
+		return nil, ErrInvalidClient
+	}
+	return client, nil
+}
+
+// -------------- Authorization --------------
+
+// errorRedirect builds the redirect that reports an authorization error back to the client
+func errorRedirect(redirectURI, state, code, description string) *ConsentRedirect {
+	return &ConsentRedirect{redirectWithParams(redirectURI, map[string]string{
+		"error":             code,
+		"error_description": description,
+		"state":             state,
+	})}
+}
+
+// redirectWithParams adds query parameters to a redirect URI, skipping empty ones
+func redirectWithParams(redirectURI string, params map[string]string) string {
+	u, _ := url.Parse(redirectURI)
+	q := u.Query()
+	for k, v := range params {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	q.Set("iss", auth.NN_API_URL)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// consentScopes narrows requested scopes to the ones the user can grant, users can only hand out permissions they have themselves
+func consentScopes(scopes []perms.Scope, held []string) ([]string, []ConsentScope) {
+	var granted []string
+	consent := []ConsentScope{}
+	for _, scope := range scopes {
+		p := scope.String()
+		if scope.Name != "oidc" && !perms.HasScope(held, scope) {
+			continue
+		}
+		if slices.Contains(granted, p) {
+			continue
+		}
+		granted = append(granted, p)
+		consent = append(consent, ConsentScope{
+			Scope:       ScopeString(scope),
+			Name:        scope.Name,
+			Description: scope.Description,
+			Value:       scope.Value,
+		})
+	}
+	return granted, consent
+}
+
+// Authorize validates an authorization request and stores it until the user consents
+// Problems with the client or redirect URI are returned as errors, since it isn't safe to redirect; anything
+// after that point is reported to the client through the redirect instead
+func (s *service) Authorize(session *auth.Session, params url.Values) (*Consent, *ConsentRedirect, error) {
+	client, err := s.store.GetClient(params.Get("client_id"))
+	if err != nil {
+		return nil, nil, errors.New("unknown client")
+	}
+	redirectURI := params.Get("redirect_uri")
+	if !client.HasRedirectURI(redirectURI) {
+		return nil, nil, errors.New("redirect uri is not registered for this client")
+	}
+
+	state := params.Get("state")
+	if params.Get("response_type") != "code" {
+		return nil, errorRedirect(redirectURI, state, "unsupported_response_type", "only the code response type is supported"), nil
+	}
+	if params.Get("code_challenge") == "" || params.Get("code_challenge_method") != "S256" {
+		return nil, errorRedirect(redirectURI, state, "invalid_request", "PKCE with S256 is required"), nil
+	}
+	scopes, err := ParseScopes(params.Get("scope"))
+	if err != nil {
+		return nil, errorRedirect(redirectURI, state, ErrInvalidScope.Code, err.Error()), nil
+	}
+	account, err := s.as.GetAccountByID(session.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	granted, consentScopes := consentScopes(scopes, account.Permissions())
+	consent := &Consent{
+		ClientID:   client.ClientID,
+		ClientName: client.Name,
+		Scopes:     consentScopes,
+	}
+
+	id, err := auth.GenerateToken()
+	if err != nil {
+		return nil, nil, err
+	}
+	err = s.store.AddAuthorizationRequest(&AuthorizationRequest{
+		ID:                  id,
+		ClientID:            client.ClientID,
+		UserID:              session.UserID,
+		RedirectURI:         redirectURI,
+		Scopes:              granted,
+		State:               state,
+		Nonce:               params.Get("nonce"),
+		CodeChallenge:       params.Get("code_challenge"),
+		CodeChallengeMethod: params.Get("code_challenge_method"),
+		AuthTime:            session.IssuedAt,
+	}, AuthorizationRequestTTL)
+	if err != nil {
+		return nil, nil, err
+	}
+	consent.RequestID = id
+	return consent, nil, nil
+}
+
+// Decide answers a pending authorization request, issuing a code if the user approved it
+func (s *service) Decide(session *auth.Session, decision *ConsentDecision) (*ConsentRedirect, error) {
+	req, err := s.store.ConsumeAuthorizationRequest(decision.RequestID)
+	if err != nil || req.UserID != session.UserID {
+		return nil, ErrRequestNotFound
+	}
+	if !decision.Approve {
+		return errorRedirect(req.RedirectURI, req.State, "access_denied", "the user denied the request"), nil
+	}
+
+	code, err := auth.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+	err = s.store.AddAuthorizationCode(auth.HashToken(code), &AuthorizationCode{
+		ClientID:      req.ClientID,
+		UserID:        req.UserID,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        req.Scopes,
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		AuthTime:      req.AuthTime,
+	}, AuthorizationCodeTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &ConsentRedirect{redirectWithParams(req.RedirectURI, map[string]string{
+		"code":  code,
+		"state": req.State,
+	})}, nil
+}
+
+// -------------- Tokens --------------
+
+// Token handles the token endpoint for every supported grant type
+func (s *service) Token(r *http.Request) (*TokenResponse, error) {
+	err := r.ParseForm()
+	if err != nil {
+		return nil, newError("invalid_request", "invalid form body")
+	}
+	// Service accounts aren't registered clients, so they authenticate separately
+	if r.PostFormValue("grant_type") == "client_credentials" {
+		return s.serviceAccountToken(r)
+	}
+	client, err := s.authenticateClient(r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch r.PostFormValue("grant_type") {
+	case "authorization_code":
+		return s.exchangeCode(r, client)
+	case "refresh_token":
+		return s.refresh(r, client)
+	case DeviceCodeGrantType:
+		return s.exchangeDeviceCode(r, client)
+	default:
+		return nil, ErrUnsupportedGrant
+	}
+}
+
+// verifyPKCE checks a code verifier against the S256 challenge from the authorization request
+func verifyPKCE(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(challenge)) == 1
+}
+
+// exchangeCode redeems an authorization code for a new session
+func (s *service) exchangeCode(r *http.Request, client *Client) (*TokenResponse, error) {
+	code, err := s.store.ConsumeAuthorizationCode(auth.HashToken(r.PostFormValue("code")))
+	if err != nil {
+		return nil, ErrInvalidGrant
+	}
+	if code.ClientID != client.ClientID || code.RedirectURI != r.PostFormValue("redirect_uri") {
+		return nil, ErrInvalidGrant
+	}
+	if !verifyPKCE(r.PostFormValue("code_verifier"), code.CodeChallenge) {
+		return nil, ErrInvalidGrant
+	}
+	account, err := s.as.GetAccountByID(code.UserID)
+	if err != nil {
+		return nil, ErrInvalidGrant
+	}
+
+	session, err := account.NewSession(auth.NewSessionExpiry())
+	if err != nil {
+		return nil, err
+	}
+	session.Permissions = auth.GrantedPermissions(code.Scopes, account.Permissions())
+	session.ClientID = client.ClientID
+	session.SetClient(r.UserAgent(), mw.RemoteAddr(r.Context()))
+	err = s.ss.AddSession(session)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.tokenResponse(session, true)
+	if err != nil {
+		return nil, err
+	}
+	if session.HasPermission(perms.ScopeOIDC(ScopeOpenID)) {
+		resp.IDToken, err = s.createIDToken(account, client, session, code.Nonce, code.AuthTime)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// serviceAccountToken issues a short-lived session to a service account, there is no refresh token since it can just sign in again
+func (s *service) serviceAccountToken(r *http.Request) (*TokenResponse, error) {
+	clientID, secret, err := clientCredentials(r)
+	if err != nil {
+		return nil, err
+	}
+	session, err := s.sas.NewServiceAccountSession(clientID, secret, strings.Fields(r.PostFormValue("scope")), r.UserAgent(), mw.RemoteAddr(r.Context()))
+	if errors.Is(err, auth.ErrInvalidServiceAccount) {
+		return nil, ErrInvalidClient
+	} else if errors.Is(err, auth.ErrServiceAccountScope) {
+		return nil, newError(ErrInvalidScope.Code, err.Error())
+	} else if err != nil {
+		return nil, err
+	}
+	resp, err := s.tokenResponse(session, false)
+	if err != nil {
+		return nil, err
+	}
+	resp.ExpiresIn = min(resp.ExpiresIn, int64(auth.ServiceAccountSessionTTL.Seconds()))
+	return resp, nil
+}
+
+// refresh rotates a refresh token that was issued to the client
+func (s *service) refresh(r *http.Request, client *Client) (*TokenResponse, error) {
+	// Check the token belongs to this client before redeeming it, so another client can't rotate it away.
+	// A token that can't be looked up is still redeemed so reusing an old token revokes its family
+	token := r.PostFormValue("refresh_token")
+	session, err := s.ss.GetRefreshTokenSession(token)
+	if err == nil && session.ClientID != client.ClientID {
+		return nil, ErrInvalidGrant
+	}
+	session, refreshToken, err := s.ss.RefreshSession(token)
+	if err != nil {
+		return nil, ErrInvalidGrant
+	}
+	if session.ClientID != client.ClientID {
+		return nil, ErrInvalidGrant
+	}
+	resp, err := s.tokenResponse(session, false)
+	if err != nil {
+		return nil, err
+	}
+	resp.RefreshToken = refreshToken
+	return resp, nil
+}
+
+// tokenResponse creates the access token for a session, and a refresh token if asked for
+func (s *service) tokenResponse(session *auth.Session, withRefresh bool) (*TokenResponse, error) {
+	accessToken, err := s.ss.CreateJWT(session)
+	if err != nil {
+		return nil, err
+	}
+	resp := &TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(auth.AccessTokenTTL.Seconds()),
+		Scope:       scopeParam(session.Permissions),
+	}
+	if withRefresh {
+		resp.RefreshToken, err = s.ss.CreateRefreshToken(session)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// scopeParam formats granted permissions as the space separated scope parameter
+func scopeParam(permissions []string) string {
+	var scopes []string
+	for _, p := range permissions {
+		scope, err := perms.ParseScope(p)
+		if err != nil {
+			continue
+		}
+		scopes = append(scopes, ScopeString(scope))
+	}
+	return strings.Join(scopes, " ")
+}
+
+// -------------- Introspection and Revocation --------------
+
+// authenticateConfidentialClient parses the form and identifies a client that has a secret
+func (s *service) authenticateConfidentialClient(r *http.Request) (*Client, error) {
+	err := r.ParseForm()
+	if err != nil {
+		return nil, newError("invalid_request", "invalid form body")
+	}
+	client, err := s.authenticateClient(r)
+	if err != nil {
+		return nil, err
+	}
+	if client.Public {
+		return nil, ErrNotConfidential
+	}
+	return client, nil
+}
+
+// tokenSession finds the active session behind an access or refresh token
+// JWTs are recognised by their signature, so the token_type_hint isn't needed. The claims are returned for access tokens
+func (s *service) tokenSession(token string) (*auth.Session, *auth.SessionClaims, error) {
+	var session *auth.Session
+	claims, err := s.ss.ParseJWT(token)
+	if err == nil {
+		session, err = s.ss.GetSession(claims.ID)
+		if err == nil && session.UserID != claims.Subject {
+			err = errors.New("session does not match token subject")
+		}
+	} else {
+		claims = nil
+		session, err = s.ss.GetRefreshTokenSession(token)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if !session.IsValid() {
+		return nil, nil, errors.New("session has expired")
+	}
+	return session, claims, nil
+}
+
+// Introspect tells a confidential client whether a token is still active, and what it grants
+// Clients can only introspect tokens issued to them, anyone else's are reported as inactive (RFC 7662 section 2.2)
+func (s *service) Introspect(r *http.Request) (*Introspection, error) {
+	client, err := s.authenticateConfidentialClient(r)
+	if err != nil {
+		return nil, err
+	}
+	session, claims, err := s.tokenSession(r.PostFormValue("token"))
+	if err != nil || session.ClientID != client.ClientID {
+		return &Introspection{Active: false}, nil
+	}
+
+	introspection := &Introspection{
+		Active:    true,
+		Scope:     scopeParam(session.Permissions),
+		ClientID:  session.ClientID,
+		Subject:   session.UserID,
+		ExpiresAt: session.ExpiresAt,
+		IssuedAt:  session.IssuedAt,
+		Issuer:    auth.NN_API_URL,
+	}
+	if claims != nil {
+		introspection.TokenType = "Bearer"
+		if claims.ExpiresAt != nil {
+			introspection.ExpiresAt = claims.ExpiresAt.Unix()
+		}
+		if claims.IssuedAt != nil {
+			introspection.IssuedAt = claims.IssuedAt.Unix()
+		}
+	}
+	return introspection, nil
+}
+
+// Revoke ends the session behind a token that was issued to the client
+// Unknown tokens aren't an error, the client's goal of the token being unusable is met either way (RFC 7009 section 2.2)
+func (s *service) Revoke(r *http.Request) error {
+	client, err := s.authenticateConfidentialClient(r)
+	if err != nil {
+		return err
+	}
+	session, _, err := s.tokenSession(r.PostFormValue("token"))
+	if err != nil {
+		return nil
+	}
+	if session.ClientID != client.ClientID {
+		return newError("unauthorized_client", "the token was not issued to this client")
+	}
+	return s.ss.DeleteSession(session.ID)
+}
+
+// IDTokenClaims claims carried in an id_token
+type IDTokenClaims struct {
+	AuthTime          int64  `json:"auth_time,omitempty"`
+	Nonce             string `json:"nonce,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     *bool  `json:"email_verified,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// createIDToken signs an id_token for the client with the current signing key
+func (s *service) createIDToken(account *auth.Account, client *Client, session *auth.Session, nonce string, authTime int64) (string, error) {
+	key, priv, err := s.keys.SigningKey()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := IDTokenClaims{
+		AuthTime: authTime,
+		Nonce:    nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    auth.NN_API_URL,
+			Subject:   account.UserID,
+			Audience:  jwt.ClaimStrings{client.ClientID},
+			ExpiresAt: jwt.NewNumericDate(now.Add(IDTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	info := userInfo(account, session)
+	claims.PreferredUsername = info.PreferredUsername
+	claims.Email = info.Email
+	claims.EmailVerified = info.EmailVerified
+
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = key.KID
+	return token.SignedString(priv)
+}
+
+// -------------- User Info --------------
+
+// userInfo builds the claims a session is allowed to see, first-party sessions see everything
+func userInfo(account *auth.Account, session *auth.Session) *UserInfo {
+	info := &UserInfo{Subject: account.UserID}
+	if session.ClientID == "" || session.HasPermission(perms.ScopeOIDC(ScopeProfile)) {
+		info.PreferredUsername = account.Username
+	}
+	if session.ClientID == "" || session.HasPermission(perms.ScopeOIDC(ScopeEmail)) {
+		info.Email = account.Email
+		verified := account.EmailVerified
+		info.EmailVerified = &verified
+	}
+	return info
+}
+
+// UserInfo gets the claims about the user that the session's scopes allow
+func (s *service) UserInfo(session *auth.Session) (*UserInfo, error) {
+	if session.ClientID != "" && !session.HasPermission(perms.ScopeOIDC(ScopeOpenID)) {
+		return nil, newError("insufficient_scope", "the openid scope is required")
+	}
+	account, err := s.as.GetAccountByID(session.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return userInfo(account, session), nil
+}
+
+// Discovery gets the provider's metadata
+func (s *service) Discovery() *Discovery {
+	return &Discovery{
+		Issuer:                            auth.NN_API_URL,
+		AuthorizationEndpoint:             auth.NN_SITE_URL + "/oauth/authorize",
+		TokenEndpoint:                     auth.NN_API_URL + "/api/v1/oauth/token",
+		UserInfoEndpoint:                  auth.NN_API_URL + "/api/v1/oauth/userinfo",
+		DeviceAuthorizationEndpoint:       auth.NN_API_URL + "/api/v1/oauth/device_authorization",
+		IntrospectionEndpoint:             auth.NN_API_URL + "/api/v1/oauth/introspect",
+		RevocationEndpoint:                auth.NN_API_URL + "/api/v1/oauth/revoke",
+		JWKSURI:                           auth.NN_API_URL + "/.well-known/jwks.json",
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "refresh_token", "client_credentials", DeviceCodeGrantType},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{auth.SigningAlgorithmEdDSA},
+		ScopesSupported:                   identityScopes,
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "preferred_username", "email", "email_verified"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+
+		IntrospectionEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post"},
+		RevocationEndpointAuthMethodsSupported:    []string{"client_secret_basic", "client_secret_post"},
+	}
+}
@@ -0,0 +1,253 @@
+package oidc
+
+import (
+	"context"
+	"github.com/goccy/go-json"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// Store interface
+type Store interface {
+	AddClient(client *Client) error
+	GetClient(clientID string) (*Client, error)
+	GetClientsByOwner(ownerID string) ([]*Client, error)
+	DeleteClient(ownerID, clientID string) error
+	AddAuthorizationRequest(req *AuthorizationRequest, ttl time.Duration) error
+	ConsumeAuthorizationRequest(id string) (*AuthorizationRequest, error)
+	AddAuthorizationCode(codeHash string, code *AuthorizationCode, ttl time.Duration) error
+	ConsumeAuthorizationCode(codeHash string) (*AuthorizationCode, error)
+	AddDeviceCode(codeHash string, code *DeviceCode, ttl time.Duration) (bool, error)
+	GetDeviceCode(codeHash string) (*DeviceCode, error)
+	GetDeviceCodeByUserCode(userCode string) (string, *DeviceCode, error)
+	UpdateDeviceCode(codeHash string, code *DeviceCode) error
+	ConsumeDeviceCode(codeHash string) (*DeviceCode, error)
+	PollDeviceCode(codeHash string, interval time.Duration) (bool, error)
+}
+
+// store - Store implementation
+type store struct {
+	db  *pgxpool.Pool
+	rdb *redis.Client
+}
+
+// NewStore - Create a new store
+func NewStore(db *pgxpool.Pool, rdb *redis.Client) Store {
+	return &store{
+		db:  db,
+		rdb: rdb,
+	}
+}
+
+// CREATE TABLE oauth_clients (
+//   client_id TEXT PRIMARY KEY NOT NULL,
+//   secret_hash TEXT NOT NULL DEFAULT '',
+//   owner_id BIGINT NOT NULL,
+//   name TEXT NOT NULL,
+//   redirect_uris TEXT[] NOT NULL,
+//   public BOOLEAN NOT NULL DEFAULT FALSE,
+//   created_at timestamp with time zone default current_timestamp,
+//   FOREIGN KEY (owner_id) REFERENCES accounts(user_id)
+// );
+
+// AddClient adds a client to the database
+func (s *store) AddClient(client *Client) error {
+	_, err := s.db.Exec(context.Background(),
+		"INSERT INTO oauth_clients (client_id, secret_hash, owner_id, name, redirect_uris, public) VALUES ($1, $2, $3, $4, $5, $6)",
+		client.ClientID, client.SecretHash, client.OwnerID, client.Name, client.RedirectURIs, client.Public,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetClient gets a client by ID
+func (s *store) GetClient(clientID string) (*Client, error) {
+	rows, err := s.db.Query(context.Background(), "SELECT * FROM oauth_clients WHERE client_id = $1", clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[Client])
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// GetClientsByOwner gets all the clients a user has registered
+func (s *store) GetClientsByOwner(ownerID string) ([]*Client, error) {
+	rows, err := s.db.Query(context.Background(), "SELECT * FROM oauth_clients WHERE owner_id = $1 ORDER BY created_at", ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	clients, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[Client])
+	if err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+// DeleteClient deletes one of a user's clients
+func (s *store) DeleteClient(ownerID, clientID string) error {
+	tag, err := s.db.Exec(context.Background(), "DELETE FROM oauth_clients WHERE owner_id = $1 AND client_id = $2", ownerID, clientID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// -------------- Cache Functions --------------
+
+// AddAuthorizationRequest stores an authorization request until the user consents
+func (s *store) AddAuthorizationRequest(req *AuthorizationRequest, ttl time.Duration) error {
+	stringReq, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.rdb.Set(context.Background(), "oidc:authz:"+req.ID, stringReq, ttl).Result()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ConsumeAuthorizationRequest gets an authorization request and removes it so it can only be answered once
+func (s *store) ConsumeAuthorizationRequest(id string) (*AuthorizationRequest, error) {
+	var req AuthorizationRequest
+	stringReq, err := s.rdb.GetDel(context.Background(), "oidc:authz:"+id).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(stringReq), &req)
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// AddAuthorizationCode stores an authorization code under its hash
+func (s *store) AddAuthorizationCode(codeHash string, code *AuthorizationCode, ttl time.Duration) error {
+	stringCode, err := json.Marshal(code)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.rdb.Set(context.Background(), "oidc:code:"+codeHash, stringCode, ttl).Result()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ConsumeAuthorizationCode gets an authorization code and removes it so it can only be redeemed once
+func (s *store) ConsumeAuthorizationCode(codeHash string) (*AuthorizationCode, error) {
+	var code AuthorizationCode
+	stringCode, err := s.rdb.GetDel(context.Background(), "oidc:code:"+codeHash).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(stringCode), &code)
+	if err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+// AddDeviceCode stores a device code under its hash, returning false if the user code is already in use
+func (s *store) AddDeviceCode(codeHash string, code *DeviceCode, ttl time.Duration) (bool, error) {
+	stringCode, err := json.Marshal(code)
+	if err != nil {
+		return false, err
+	}
+
+	added, err := s.rdb.SetNX(context.Background(), "oidc:device_user:"+code.UserCode, codeHash, ttl).Result()
+	if err != nil || !added {
+		return false, err
+	}
+	_, err = s.rdb.Set(context.Background(), "oidc:device:"+codeHash, stringCode, ttl).Result()
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetDeviceCode gets a device code by its hash
+func (s *store) GetDeviceCode(codeHash string) (*DeviceCode, error) {
+	var code DeviceCode
+	stringCode, err := s.rdb.Get(context.Background(), "oidc:device:"+codeHash).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(stringCode), &code)
+	if err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+// GetDeviceCodeByUserCode gets a device code and its hash from the code the user typed in
+func (s *store) GetDeviceCodeByUserCode(userCode string) (string, *DeviceCode, error) {
+	codeHash, err := s.rdb.Get(context.Background(), "oidc:device_user:"+userCode).Result()
+	if err != nil {
+		return "", nil, err
+	}
+
+	code, err := s.GetDeviceCode(codeHash)
+	if err != nil {
+		return "", nil, err
+	}
+	return codeHash, code, nil
+}
+
+// UpdateDeviceCode saves the user's answer for a device code, keeping its expiry
+func (s *store) UpdateDeviceCode(codeHash string, code *DeviceCode) error {
+	stringCode, err := json.Marshal(code)
+	if err != nil {
+		return err
+	}
+
+	updated, err := s.rdb.SetXX(context.Background(), "oidc:device:"+codeHash, stringCode, redis.KeepTTL).Result()
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return redis.Nil
+	}
+	return nil
+}
+
+// ConsumeDeviceCode gets a device code and removes it, along with its user code, so it can only be redeemed once
+func (s *store) ConsumeDeviceCode(codeHash string) (*DeviceCode, error) {
+	var code DeviceCode
+	stringCode, err := s.rdb.GetDel(context.Background(), "oidc:device:"+codeHash).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(stringCode), &code)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.rdb.Del(context.Background(), "oidc:device_user:"+code.UserCode).Result()
+	if err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+// PollDeviceCode records a poll of the token endpoint, returning false if the device polled again too soon
+func (s *store) PollDeviceCode(codeHash string, interval time.Duration) (bool, error) {
+	return s.rdb.SetNX(context.Background(), "oidc:device_poll:"+codeHash, 1, interval).Result()
+}
@@ -0,0 +1,259 @@
+package oidc
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	perms "github.com/NeuralNexusDev/neuralnexus-api/modules/auth/permissions"
+)
+
+// -------------- Scopes --------------
+
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// identityScopes - OIDC scopes that map onto oidc:<scope> permissions
+var identityScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail}
+
+// ParseScopes parses a space separated scope parameter into permission scopes
+// OIDC scopes like "profile" become oidc:profile, anything else has to be a permission scope
+func ParseScopes(scope string) ([]perms.Scope, error) {
+	var scopes []perms.Scope
+	for _, s := range strings.Fields(scope) {
+		if slices.Contains(identityScopes, s) {
+			scopes = append(scopes, perms.ScopeOIDC(s))
+			continue
+		}
+		p, err := perms.ParseScope(s)
+		if err != nil {
+			return nil, errors.New("invalid scope: " + s)
+		}
+		scopes = append(scopes, p)
+	}
+	return scopes, nil
+}
+
+// ScopeString formats a permission as it appears in the scope parameter
+func ScopeString(p perms.Scope) string {
+	if p.Name == "oidc" {
+		return p.Value
+	}
+	return p.String()
+}
+
+// -------------- Structs --------------
+
+// Client struct, a third-party app that can ask users to sign in with NeuralNexus
+type Client struct {
+	ClientID     string    `json:"client_id" xml:"client_id" db:"client_id"`
+	SecretHash   string    `json:"-" xml:"-" db:"secret_hash"`
+	OwnerID      string    `json:"owner_id" xml:"owner_id" db:"owner_id"`
+	Name         string    `json:"name" xml:"name" db:"name"`
+	RedirectURIs []string  `json:"redirect_uris" xml:"redirect_uris" db:"redirect_uris"`
+	Public       bool      `json:"public" xml:"public" db:"public"`
+	CreatedAt    time.Time `json:"created_at" xml:"created_at" db:"created_at"`
+}
+
+// HasRedirectURI checks a redirect URI against the registered ones, exact matches only
+func (c *Client) HasRedirectURI(uri string) bool {
+	return slices.Contains(c.RedirectURIs, uri)
+}
+
+// NewClient struct returned once when a client is registered, it is the only time the secret can be seen
+type NewClient struct {
+	*Client
+	ClientSecret string `json:"client_secret,omitempty" xml:"client_secret,omitempty"`
+}
+
+// AuthorizationRequest struct, an authorization request waiting for the user's consent
+type AuthorizationRequest struct {
+	ID                  string   `json:"id"`
+	ClientID            string   `json:"client_id"`
+	UserID              string   `json:"user_id"`
+	RedirectURI         string   `json:"redirect_uri"`
+	Scopes              []string `json:"scopes"`
+	State               string   `json:"state"`
+	Nonce               string   `json:"nonce"`
+	CodeChallenge       string   `json:"code_challenge"`
+	CodeChallengeMethod string   `json:"code_challenge_method"`
+	AuthTime            int64    `json:"auth_time"`
+}
+
+// AuthorizationCode struct, the grant a client swaps for tokens
+type AuthorizationCode struct {
+	ClientID      string   `json:"client_id"`
+	UserID        string   `json:"user_id"`
+	RedirectURI   string   `json:"redirect_uri"`
+	Scopes        []string `json:"scopes"`
+	Nonce         string   `json:"nonce"`
+	CodeChallenge string   `json:"code_challenge"`
+	AuthTime      int64    `json:"auth_time"`
+}
+
+// DeviceCode struct, a device authorization waiting for the user to approve it on the site
+type DeviceCode struct {
+	ClientID string   `json:"client_id"`
+	UserCode string   `json:"user_code"`
+	Scope    string   `json:"scope"`
+	APIKey   bool     `json:"api_key"`
+	Status   string   `json:"status"`
+	UserID   string   `json:"user_id,omitempty"`
+	Scopes   []string `json:"scopes,omitempty"`
+	AuthTime int64    `json:"auth_time,omitempty"`
+}
+
+// DeviceAuthorization struct returned by the device authorization endpoint (RFC 8628 section 3.2)
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+// DeviceConsent struct, everything the site needs to show the user when they enter a user code
+type DeviceConsent struct {
+	UserCode   string         `json:"user_code" xml:"user_code"`
+	ClientID   string         `json:"client_id" xml:"client_id"`
+	ClientName string         `json:"client_name" xml:"client_name"`
+	APIKey     bool           `json:"api_key" xml:"api_key"`
+	Scopes     []ConsentScope `json:"scopes" xml:"scopes"`
+}
+
+// DeviceDecision struct, the user's answer for a device, they can approve fewer scopes than the device asked for
+type DeviceDecision struct {
+	UserCode string   `json:"user_code" xml:"user_code" validate:"required"`
+	Approve  bool     `json:"approve" xml:"approve"`
+	Scopes   []string `json:"scopes,omitempty" xml:"scopes,omitempty"`
+}
+
+// ConsentScope struct, a scope shown to the user on the consent screen
+type ConsentScope struct {
+	Scope       string `json:"scope" xml:"scope"`
+	Name        string `json:"name" xml:"name"`
+	Description string `json:"description" xml:"description"`
+	Value       string `json:"value" xml:"value"`
+}
+
+// Consent struct, everything the site needs to render the consent screen
+type Consent struct {
+	RequestID  string         `json:"request_id" xml:"request_id"`
+	ClientID   string         `json:"client_id" xml:"client_id"`
+	ClientName string         `json:"client_name" xml:"client_name"`
+	Scopes     []ConsentScope `json:"scopes" xml:"scopes"`
+}
+
+// ConsentDecision struct, the user's answer on the consent screen
+type ConsentDecision struct {
+	RequestID string `json:"request_id" xml:"request_id" validate:"required"`
+	Approve   bool   `json:"approve" xml:"approve"`
+}
+
+// ConsentRedirect struct, where the site should send the user after they decide
+type ConsentRedirect struct {
+	RedirectURI string `json:"redirect_uri" xml:"redirect_uri"`
+}
+
+// ClientRegistration struct for registering a client
+type ClientRegistration struct {
+	Name         string   `json:"name" xml:"name" validate:"required"`
+	RedirectURIs []string `json:"redirect_uris" xml:"redirect_uris" validate:"required"`
+	Public       bool     `json:"public" xml:"public"`
+}
+
+// Clients struct for listing clients
+type Clients struct {
+	Clients []*Client `json:"clients" xml:"clients"`
+}
+
+// TokenResponse struct returned by the token endpoint
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope"`
+}
+
+// Introspection struct returned by the introspection endpoint (RFC 7662), inactive tokens only have the active flag
+type Introspection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+}
+
+// UserInfo struct returned by the userinfo endpoint
+type UserInfo struct {
+	Subject           string `json:"sub"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     *bool  `json:"email_verified,omitempty"`
+}
+
+// Discovery struct served at /.well-known/openid-configuration
+type Discovery struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+
+	IntrospectionEndpointAuthMethodsSupported []string `json:"introspection_endpoint_auth_methods_supported"`
+	RevocationEndpointAuthMethodsSupported    []string `json:"revocation_endpoint_auth_methods_supported"`
+}
+
+// -------------- Errors --------------
+
+// Error struct, an OAuth 2.0 error response (RFC 6749 section 5.2)
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// Error returns the error code
+func (e *Error) Error() string {
+	return e.Code
+}
+
+// newError creates an OAuth error
+func newError(code, description string) *Error {
+	return &Error{code, description}
+}
+
+var (
+	ErrInvalidClient    = newError("invalid_client", "client authentication failed")
+	ErrInvalidGrant     = newError("invalid_grant", "the grant is invalid, expired or was issued to another client")
+	ErrUnsupportedGrant = newError("unsupported_grant_type", "")
+	ErrInvalidScope     = newError("invalid_scope", "")
+	ErrNotConfidential  = newError("unauthorized_client", "only confidential clients can use this endpoint")
+	ErrRequestNotFound  = errors.New("authorization request not found")
+
+	ErrAuthorizationPending = newError("authorization_pending", "")
+	ErrSlowDown             = newError("slow_down", "")
+	ErrAccessDenied         = newError("access_denied", "the user denied the request")
+	ErrExpiredToken         = newError("expired_token", "the device code has expired")
+	ErrDeviceCodeNotFound   = errors.New("device code not found")
+)
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/email"
+)
+
+const (
+	TokenPurposeResetPassword TokenPurpose = "reset_password"
+)
+
+// PasswordResetTTL - How long a password reset link stays valid
+var PasswordResetTTL = time.Hour
+
+// ErrInvalidPassword - The supplied current password was wrong
+var ErrInvalidPassword = errors.New("invalid password")
+
+// PasswordService - Password management service interface
+type PasswordService interface {
+	ChangePassword(session *Session, oldPassword, newPassword string) error
+	RequestPasswordReset(email string) error
+	ResetPassword(token, newPassword string) error
+}
+
+// passwordService - PasswordService implementation
+type passwordService struct {
+	as     AccountStore
+	tokens OneTimeTokenStore
+	ss     SessionService
+	sender email.Sender
+}
+
+// NewPasswordService - Create a new password service
+func NewPasswordService(store Store, ss SessionService, sender email.Sender) PasswordService {
+	return &passwordService{
+		as:     store.Account(),
+		tokens: store.OneTimeToken(),
+		ss:     ss,
+		sender: sender,
+	}
+}
+
+// ChangePassword re-validates the current password, sets the new one and revokes the user's other sessions
+func (s *passwordService) ChangePassword(session *Session, oldPassword, newPassword string) error {
+	err := ValidatePassword(newPassword)
+	if err != nil {
+		return err
+	}
+	account, err := s.as.GetAccountByID(session.UserID)
+	if err != nil {
+		return err
+	}
+	if !account.ValidateUser(oldPassword) {
+		return ErrInvalidPassword
+	}
+	err = account.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	err = s.as.UpdateAccountInDB(account)
+	if err != nil {
+		return err
+	}
+	return s.ss.DeleteUserSessions(account.UserID, session.ID)
+}
+
+// RequestPasswordReset emails a single-use reset token if the address belongs to an account
+func (s *passwordService) RequestPasswordReset(address string) error {
+	account, err := s.as.GetAccountByEmail(address)
+	if err != nil {
+		return err
+	}
+	token, err := GenerateToken()
+	if err != nil {
+		return err
+	}
+	err = s.tokens.AddOneTimeToken(TokenPurposeResetPassword, token, account.UserID, PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+	return s.sender.Send(&email.Message{
+		To:      account.Email,
+		Subject: "Reset your NeuralNexus password",
+		Body: "Hi " + account.Username + ",\n\n" +
+			"Someone asked to reset the password for your account. Open the link below to choose a new one:\n\n" +
+			NN_SITE_URL + "/reset-password?token=" + token + "\n\n" +
+			"This link expires in 1 hour. If you did not request a reset you can ignore this email.\n",
+	})
+}
+
+// ResetPassword redeems a reset token, sets the new password and revokes all of the user's sessions
+func (s *passwordService) ResetPassword(token, newPassword string) error {
+	err := ValidatePassword(newPassword)
+	if err != nil {
+		return err
+	}
+	userID, err := s.tokens.ConsumeOneTimeToken(TokenPurposeResetPassword, token)
+	if err != nil {
+		return errors.New("invalid or expired token")
+	}
+	account, err := s.as.GetAccountByID(userID)
+	if err != nil {
+		return err
+	}
+	err = account.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	// The reset link was delivered to the account's inbox, so the address is proven
+	account.EmailVerified = true
+	err = s.as.UpdateAccountInDB(account)
+	if err != nil {
+		return err
+	}
+	return s.ss.DeleteUserSessions(account.UserID, "")
+}
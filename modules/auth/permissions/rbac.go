@@ -1,69 +1,75 @@
 package perms
 
-import "errors"
+import (
+	"errors"
+	"sync"
+)
 
 // -------------- Structs --------------
 
+// Scope struct, see scope.go for how scopes are written and matched
 type Scope struct {
 	Name        string
 	Description string
 	Value       string
+	Verb        Verb
 }
 
 var (
-	ScopeAdminBeeNameGenerator = Scope{
-		Name:        "beenamegenerator",
-		Description: "Bee name generator",
-		Value:       "*",
-	}
-
-	ScopeAdminPetPictures = ScopePetPictures("*")
-
-	ScopeAdminRateLimit = Scope{
-		Name:        "ratelimit",
-		Description: "Rate limit",
-		Value:       "1000",
-	}
-
-	ScopeAdminDataStore   = ScopeDataStore("*")
-	ScopeAdminNumberStore = ScopeNumberStore("*")
-	ScopeAdminUsers       = ScopeUsers("*")
+	ScopeAdminBeeNameGenerator = ScopeBeeNameGenerator(Wildcard)
+	ScopeAdminPetPictures      = ScopePetPictures(Wildcard)
+	ScopeAdminRateLimit        = newScope("ratelimit", "1000")
+	ScopeAdminDataStore        = ScopeDataStore(Wildcard)
+	ScopeAdminNumberStore      = ScopeNumberStore(Wildcard)
+	ScopeAdminUsers            = ScopeUsers(Wildcard)
+	ScopeAdminRoles            = ScopeRoles(Wildcard)
+	ScopeAdminLinks            = ScopeLinks(Wildcard)
+	ScopeAdminServiceAccounts  = ScopeServiceAccounts(Wildcard)
 )
 
+// ScopeBeeNameGenerator -- Bee name generator
+func ScopeBeeNameGenerator(value string) Scope {
+	return newScope("beenamegenerator", value)
+}
+
 // ScopePetPictures -- Pet pictures
 func ScopePetPictures(value string) Scope {
-	return Scope{
-		Name:        "petpictures",
-		Description: "Pet pictures",
-		Value:       value,
-	}
+	return newScope("petpictures", value)
 }
 
 // ScopeDataStore -- Data store
 func ScopeDataStore(value string) Scope {
-	return Scope{
-		Name:        "datastore",
-		Description: "Data store",
-		Value:       value,
-	}
+	return newScope("datastore", value)
 }
 
 // ScopeNumberStore -- Number store
 func ScopeNumberStore(value string) Scope {
-	return Scope{
-		Name:        "numberstore",
-		Description: "Number store",
-		Value:       value,
-	}
+	return newScope("numberstore", value)
 }
 
 // ScopeUsers -- Admin users
 func ScopeUsers(value string) Scope {
-	return Scope{
-		Name:        "users",
-		Description: "Users",
-		Value:       value,
-	}
+	return newScope("users", value)
+}
+
+// ScopeRoles -- Roles and the permissions they grant
+func ScopeRoles(value string) Scope {
+	return newScope("roles", value)
+}
+
+// ScopeLinks -- Linking platform accounts to users, by platform
+func ScopeLinks(value string) Scope {
+	return newScope("links", value)
+}
+
+// ScopeServiceAccounts -- Service accounts that sign in with the client credentials grant
+func ScopeServiceAccounts(value string) Scope {
+	return newScope("serviceaccounts", value)
+}
+
+// ScopeOIDC -- OpenID Connect identity claims shared with a third-party app
+func ScopeOIDC(value string) Scope {
+	return newScope("oidc", value)
 }
 
 type Role struct {
@@ -83,6 +89,9 @@ var (
 			ScopeAdminDataStore,
 			ScopeAdminNumberStore,
 			ScopeAdminUsers,
+			ScopeAdminRoles,
+			ScopeAdminLinks,
+			ScopeAdminServiceAccounts,
 		},
 	}
 
@@ -96,12 +105,40 @@ var (
 			ScopeAdminDataStore,
 			ScopeAdminNumberStore,
 			ScopeAdminUsers,
+			ScopeAdminRoles,
+			ScopeAdminLinks,
+			ScopeAdminServiceAccounts,
 		},
 	}
 )
 
 // -------------- Functions --------------
 
+// roles - Roles loaded from the database, kept up to date by the auth role service
+var roles = struct {
+	sync.RWMutex
+	byName map[string]Role
+}{byName: map[string]Role{}}
+
+// IsBuiltinRole checks if a role is defined in code, built-in roles can't be changed through the API
+func IsBuiltinRole(name string) bool {
+	return name == RoleSystem.Name || name == RoleOwner.Name
+}
+
+// SetRoles replaces the cached roles, built-in roles are defined in code and can't be replaced
+func SetRoles(rs []Role) {
+	byName := make(map[string]Role, len(rs))
+	for _, r := range rs {
+		if IsBuiltinRole(r.Name) {
+			continue
+		}
+		byName[r.Name] = r
+	}
+	roles.Lock()
+	defer roles.Unlock()
+	roles.byName = byName
+}
+
 // GetRoleByName gets a role by name
 func GetRoleByName(name string) (Role, error) {
 	switch name {
@@ -109,7 +146,11 @@ func GetRoleByName(name string) (Role, error) {
 		return RoleSystem, nil
 	case RoleOwner.Name:
 		return RoleOwner, nil
-	default:
-		return Role{}, errors.New("role not found")
 	}
+	roles.RLock()
+	defer roles.RUnlock()
+	if role, ok := roles.byName[name]; ok {
+		return role, nil
+	}
+	return Role{}, errors.New("role not found")
 }
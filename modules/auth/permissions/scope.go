@@ -0,0 +1,171 @@
+package perms
+
+import (
+	"errors"
+	"strings"
+)
+
+// Scopes are written as resource[:id[:verb]], for example "datastore:123:read".
+//
+//   - A scope grants everything below it, so "datastore:123" grants both "datastore:123:read" and "datastore:123:write".
+//   - "*" matches any single segment, and as the last segment it matches everything below it, so "petpictures:*"
+//     grants "petpictures:Bella:write".
+//   - The write verb also grants read.
+//
+// The old name|value form is still parsed so permissions stored before the grammar existed keep working.
+
+// Verb - What a scope allows to be done to a resource
+type Verb string
+
+const (
+	VerbRead  Verb = "read"
+	VerbWrite Verb = "write"
+)
+
+// Wildcard - Matches any segment
+const Wildcard = "*"
+
+const (
+	scopeSeparator  = ":"
+	legacySeparator = "|"
+)
+
+var ErrInvalidScope = errors.New("invalid scope")
+
+// resources - Descriptions for every resource a scope can refer to
+var resources = map[string]string{
+	"beenamegenerator": "Bee name generator",
+	"ratelimit":        "Rate limit",
+	"petpictures":      "Pet pictures",
+	"datastore":        "Data store",
+	"numberstore":      "Number store",
+	"users":            "Users",
+	"roles":            "Roles",
+	"oidc":             "OpenID Connect",
+	"links":            "Account linking",
+	"serviceaccounts":  "Service accounts",
+}
+
+// newScope builds a scope for a known resource
+func newScope(name, value string) Scope {
+	return Scope{
+		Name:        name,
+		Description: resources[name],
+		Value:       value,
+	}
+}
+
+// WithVerb narrows a scope to a single verb
+func (s Scope) WithVerb(verb Verb) Scope {
+	s.Verb = verb
+	return s
+}
+
+// String formats a scope in resource:id:verb form, this is how permissions are stored
+func (s Scope) String() string {
+	return strings.Join(s.segments(), scopeSeparator)
+}
+
+// segments splits a scope into the parts that are matched one by one
+func (s Scope) segments() []string {
+	segments := []string{s.Name}
+	if s.Value != "" || s.Verb != "" {
+		value := s.Value
+		if value == "" {
+			value = Wildcard
+		}
+		segments = append(segments, value)
+	}
+	if s.Verb != "" {
+		segments = append(segments, string(s.Verb))
+	}
+	return segments
+}
+
+// Grants checks if holding this scope allows what the required scope asks for
+func (s Scope) Grants(required Scope) bool {
+	held := s.segments()
+	want := required.segments()
+	if len(held) > len(want) {
+		return false
+	}
+	for i, segment := range held {
+		if segment == Wildcard {
+			if i == len(held)-1 {
+				return true
+			}
+			continue
+		}
+		if segment == want[i] {
+			continue
+		}
+		if i == 2 && Verb(segment) == VerbWrite && Verb(want[i]) == VerbRead {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// ParseScope parses a permission string, accepting both resource:id:verb and the legacy name|value form
+func ParseScope(permission string) (Scope, error) {
+	if name, value, ok := strings.Cut(permission, legacySeparator); ok {
+		if _, known := resources[name]; !known || value == "" {
+			return Scope{}, ErrInvalidScope
+		}
+		return newScope(name, value), nil
+	}
+
+	segments := strings.Split(permission, scopeSeparator)
+	if _, known := resources[segments[0]]; !known {
+		return Scope{}, ErrInvalidScope
+	}
+	scope := newScope(segments[0], "")
+	if len(segments) == 1 {
+		return scope, nil
+	}
+	// IDs may contain the separator themselves, so only a recognised verb at the end is treated as one
+	last := Verb(segments[len(segments)-1])
+	if len(segments) > 2 && (last == VerbRead || last == VerbWrite) {
+		scope.Verb = last
+		segments = segments[:len(segments)-1]
+	}
+	scope.Value = strings.Join(segments[1:], scopeSeparator)
+	if scope.Value == "" {
+		return Scope{}, ErrInvalidScope
+	}
+	return scope, nil
+}
+
+// Normalize rewrites a permission string into resource:id:verb form
+func Normalize(permission string) (string, error) {
+	scope, err := ParseScope(permission)
+	if err != nil {
+		return "", err
+	}
+	return scope.String(), nil
+}
+
+// HasScope checks if any of the held permissions grants the required scope
+// This is the single place permissions are matched, unparseable permissions never grant anything
+func HasScope(permissions []string, required Scope) bool {
+	for _, p := range permissions {
+		scope, err := ParseScope(p)
+		if err != nil {
+			continue
+		}
+		if scope.Grants(required) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission checks if the held permissions grant a required permission string
+func HasPermission(permissions []string, required string) bool {
+	scope, err := ParseScope(required)
+	if err != nil {
+		return false
+	}
+	return HasScope(permissions, scope)
+}
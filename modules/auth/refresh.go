@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// AccessTokenTTL - How long a JWT is valid for before it has to be refreshed
+	AccessTokenTTL = 15 * time.Minute
+	// RefreshTokenTTL - How long a session lives without being refreshed, each refresh slides it forward
+	RefreshTokenTTL = 30 * 24 * time.Hour
+	// SessionMaxAge - How long a session can be kept alive by refreshing before the user has to log in again
+	SessionMaxAge = 90 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+// RefreshToken struct, the token itself is only ever stored as a hash
+// Every token issued for a session shares the session ID, which makes up the token family
+type RefreshToken struct {
+	TokenHash string    `db:"token_hash"`
+	SessionID string    `db:"session_id"`
+	UserID    string    `db:"user_id"`
+	Used      bool      `db:"used"`
+	ExpiresAt int64     `db:"expires_at"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// NewSessionExpiry gets the expiry for a newly created session
+func NewSessionExpiry() int64 {
+	return time.Now().Add(RefreshTokenTTL).Unix()
+}
+
+// CreateRefreshToken issues a new refresh token for a session
+func (s *sessionService) CreateRefreshToken(session *Session) (string, error) {
+	token, err := GenerateToken()
+	if err != nil {
+		return "", err
+	}
+	err = s.refresh.AddRefreshToken(&RefreshToken{
+		TokenHash: HashToken(token),
+		SessionID: session.ID,
+		UserID:    session.UserID,
+		ExpiresAt: session.ExpiresAt,
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RefreshSession redeems a refresh token, sliding the session's expiry forward and rotating the token.
+// The session's permissions are worked out again so role changes apply, OIDC sessions keep only the granted scopes
+// Presenting a token that has already been used revokes the whole family, since either the
+// legitimate client or an attacker is holding a stolen copy
+func (s *sessionService) RefreshSession(refreshToken string) (*Session, string, error) {
+	rt, err := s.refresh.UseRefreshToken(HashToken(refreshToken))
+	if err != nil {
+		return nil, "", ErrInvalidRefreshToken
+	}
+	if rt.Used {
+		err = s.DeleteSession(rt.SessionID)
+		if err != nil {
+			return nil, "", err
+		}
+		return nil, "", ErrRefreshTokenReused
+	}
+	if rt.ExpiresAt != 0 && time.Now().Unix() >= rt.ExpiresAt {
+		return nil, "", ErrInvalidRefreshToken
+	}
+
+	session, err := s.GetSession(rt.SessionID)
+	if err != nil || session.UserID != rt.UserID {
+		return nil, "", ErrInvalidRefreshToken
+	}
+	account, err := s.accounts.GetAccountByID(session.UserID)
+	if err != nil {
+		return nil, "", ErrInvalidRefreshToken
+	}
+	if session.ClientID != "" {
+		session.Permissions = GrantedPermissions(session.Permissions, account.Permissions())
+	} else {
+		session.Permissions = account.Permissions()
+	}
+	now := time.Now()
+	session.LastUsedAt = now.Unix()
+	if session.ExpiresAt != 0 {
+		session.ExpiresAt = min(now.Add(RefreshTokenTTL).Unix(), time.Unix(session.IssuedAt, 0).Add(SessionMaxAge).Unix())
+	}
+	err = s.UpdateSession(session)
+	if err != nil {
+		return nil, "", err
+	}
+
+	token, err := s.CreateRefreshToken(session)
+	if err != nil {
+		return nil, "", err
+	}
+	return session, token, nil
+}
+
+// GetRefreshTokenSession gets the session a refresh token belongs to without rotating it
+// Used tokens don't count, only the latest token in a family can still be redeemed
+func (s *sessionService) GetRefreshTokenSession(refreshToken string) (*Session, error) {
+	rt, err := s.refresh.GetRefreshToken(HashToken(refreshToken))
+	if err != nil || rt.Used {
+		return nil, ErrInvalidRefreshToken
+	}
+	if rt.ExpiresAt != 0 && time.Now().Unix() >= rt.ExpiresAt {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	session, err := s.GetSession(rt.SessionID)
+	if err != nil || session.UserID != rt.UserID {
+		return nil, ErrInvalidRefreshToken
+	}
+	return session, nil
+}
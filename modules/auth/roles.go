@@ -0,0 +1,250 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"regexp"
+	"slices"
+	"time"
+
+	perms "github.com/NeuralNexusDev/neuralnexus-api/modules/auth/permissions"
+	"github.com/jackc/pgx/v5"
+)
+
+// roleRefresh - How often roles are reloaded in case an invalidation message was missed
+var roleRefresh = 5 * time.Minute
+
+var roleNameRegex = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+var (
+	ErrRoleBuiltin    = errors.New("built-in roles cannot be changed")
+	ErrRoleExists     = errors.New("role already exists")
+	ErrRoleNotFound   = errors.New("role not found")
+	ErrInvalidRole    = errors.New("role names must be 1-32 lowercase letters, numbers, dashes or underscores")
+	ErrRolePermission = errors.New("invalid permission")
+)
+
+// -------------- Structs --------------
+
+// Role struct, a named set of permissions that can be given to accounts
+type Role struct {
+	Name        string    `json:"name" xml:"name" db:"name" validate:"required"`
+	Description string    `json:"description" xml:"description" db:"description"`
+	Permissions []string  `json:"permissions" xml:"permissions" db:"permissions"`
+	Builtin     bool      `json:"builtin" xml:"builtin" db:"-"`
+	CreatedAt   time.Time `json:"created_at" xml:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" xml:"updated_at" db:"updated_at"`
+}
+
+// builtinRole converts a role defined in code so it can be listed with the rest
+func builtinRole(r perms.Role) *Role {
+	var permissions []string
+	for _, p := range r.Permissions {
+		permissions = append(permissions, p.String())
+	}
+	return &Role{
+		Name:        r.Name,
+		Description: r.Description,
+		Permissions: permissions,
+		Builtin:     true,
+	}
+}
+
+// toPerms converts a role into the form the permissions package caches
+func (r *Role) toPerms() (perms.Role, error) {
+	role := perms.Role{
+		Name:        r.Name,
+		Description: r.Description,
+	}
+	for _, p := range r.Permissions {
+		scope, err := perms.ParseScope(p)
+		if err != nil {
+			return perms.Role{}, ErrRolePermission
+		}
+		role.Permissions = append(role.Permissions, scope)
+	}
+	return role, nil
+}
+
+// -------------- Service --------------
+
+// RoleService - Role service interface
+type RoleService interface {
+	GetRoles() ([]*Role, error)
+	GetRole(name string) (*Role, error)
+	CreateRole(role *Role) error
+	UpdateRole(role *Role) error
+	DeleteRole(name string) error
+	LoadRoles() error
+	StartRoleSync()
+}
+
+// roleService - RoleService implementation
+type roleService struct {
+	store RoleStore
+}
+
+// NewRoleService - Create a new role service
+func NewRoleService(store Store) RoleService {
+	return &roleService{
+		store: store.Role(),
+	}
+}
+
+// GetRoles lists the built-in roles followed by the ones in the database
+func (s *roleService) GetRoles() ([]*Role, error) {
+	roles, err := s.store.GetRolesFromDB()
+	if err != nil {
+		return nil, err
+	}
+	all := []*Role{builtinRole(perms.RoleSystem), builtinRole(perms.RoleOwner)}
+	for _, r := range roles {
+		if !perms.IsBuiltinRole(r.Name) {
+			all = append(all, r)
+		}
+	}
+	return all, nil
+}
+
+// GetRole gets a role by name
+func (s *roleService) GetRole(name string) (*Role, error) {
+	if perms.IsBuiltinRole(name) {
+		role, _ := perms.GetRoleByName(name)
+		return builtinRole(role), nil
+	}
+	role, err := s.store.GetRoleFromDB(name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrRoleNotFound
+	}
+	return role, err
+}
+
+// validateRole checks a role's name and permissions before it is written
+func validateRole(role *Role) error {
+	if perms.IsBuiltinRole(role.Name) {
+		return ErrRoleBuiltin
+	}
+	if !roleNameRegex.MatchString(role.Name) {
+		return ErrInvalidRole
+	}
+	permissions := []string{}
+	for _, p := range role.Permissions {
+		normalized, err := perms.Normalize(p)
+		if err != nil {
+			return ErrRolePermission
+		}
+		permissions = append(permissions, normalized)
+	}
+	slices.Sort(permissions)
+	role.Permissions = slices.Compact(permissions)
+	return nil
+}
+
+// CreateRole adds a new role
+func (s *roleService) CreateRole(role *Role) error {
+	err := validateRole(role)
+	if err != nil {
+		return err
+	}
+	_, err = s.store.GetRoleFromDB(role.Name)
+	if err == nil {
+		return ErrRoleExists
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	err = s.store.AddRoleToDB(role)
+	if err != nil {
+		return err
+	}
+	return s.invalidate()
+}
+
+// UpdateRole replaces a role's description and permissions
+func (s *roleService) UpdateRole(role *Role) error {
+	err := validateRole(role)
+	if err != nil {
+		return err
+	}
+	err = s.store.UpdateRoleInDB(role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrRoleNotFound
+	} else if err != nil {
+		return err
+	}
+	return s.invalidate()
+}
+
+// DeleteRole removes a role, accounts that still have it simply stop getting its permissions
+func (s *roleService) DeleteRole(name string) error {
+	if perms.IsBuiltinRole(name) {
+		return ErrRoleBuiltin
+	}
+	err := s.store.DeleteRoleFromDB(name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrRoleNotFound
+	} else if err != nil {
+		return err
+	}
+	return s.invalidate()
+}
+
+// invalidate reloads the local cache and tells the other instances to do the same
+func (s *roleService) invalidate() error {
+	err := s.LoadRoles()
+	if err != nil {
+		return err
+	}
+	err = s.store.PublishRolesChanged()
+	if err != nil {
+		log.Println("Failed to publish role change:\n\t", err)
+	}
+	return nil
+}
+
+// LoadRoles reads the roles from the database into the permissions cache
+func (s *roleService) LoadRoles() error {
+	roles, err := s.store.GetRolesFromDB()
+	if err != nil {
+		return err
+	}
+	var cached []perms.Role
+	for _, r := range roles {
+		if perms.IsBuiltinRole(r.Name) {
+			log.Printf("Skipping role %s, it is built-in and can't be changed in the database", r.Name)
+			continue
+		}
+		role, err := r.toPerms()
+		if err != nil {
+			log.Printf("Skipping role %s with an invalid permission", r.Name)
+			continue
+		}
+		cached = append(cached, role)
+	}
+	perms.SetRoles(cached)
+	return nil
+}
+
+// StartRoleSync loads the roles and keeps them up to date when any instance changes them
+func (s *roleService) StartRoleSync() {
+	err := s.LoadRoles()
+	if err != nil {
+		log.Println("Failed to load roles:\n\t", err)
+	}
+	go func() {
+		sub := s.store.SubscribeRolesChanged()
+		defer sub.Close()
+		ticker := time.NewTicker(roleRefresh)
+		defer ticker.Stop()
+		messages := sub.Channel()
+		for {
+			select {
+			case <-messages:
+			case <-ticker.C:
+			}
+			err := s.LoadRoles()
+			if err != nil {
+				log.Println("Failed to reload roles:\n\t", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	perms "github.com/NeuralNexusDev/neuralnexus-api/modules/auth/permissions"
+)
+
+// memRoleStore - RoleStore that only lists roles, any write fails the test
+type memRoleStore struct {
+	RoleStore
+	t     *testing.T
+	roles []*Role
+}
+
+func (s *memRoleStore) GetRolesFromDB() ([]*Role, error) {
+	return s.roles, nil
+}
+
+func (s *memRoleStore) GetRoleFromDB(name string) (*Role, error) {
+	s.t.Fatalf("role %s should not be looked up in the database", name)
+	return nil, nil
+}
+
+func (s *memRoleStore) UpdateRoleInDB(role *Role) error {
+	s.t.Fatalf("role %s should not be written to the database", role.Name)
+	return nil
+}
+
+func (s *memRoleStore) DeleteRoleFromDB(name string) error {
+	s.t.Fatalf("role %s should not be deleted from the database", name)
+	return nil
+}
+
+func TestBuiltinRolesCannotBeChanged(t *testing.T) {
+	s := &roleService{store: &memRoleStore{t: t}}
+	for _, name := range []string{perms.RoleSystem.Name, perms.RoleOwner.Name} {
+		if err := s.CreateRole(&Role{Name: name}); !errors.Is(err, ErrRoleBuiltin) {
+			t.Errorf("creating %s got error %v, want %v", name, err, ErrRoleBuiltin)
+		}
+		if err := s.UpdateRole(&Role{Name: name}); !errors.Is(err, ErrRoleBuiltin) {
+			t.Errorf("updating %s got error %v, want %v", name, err, ErrRoleBuiltin)
+		}
+		if err := s.DeleteRole(name); !errors.Is(err, ErrRoleBuiltin) {
+			t.Errorf("deleting %s got error %v, want %v", name, err, ErrRoleBuiltin)
+		}
+	}
+}
+
+func TestGetRolesIgnoresBuiltinRows(t *testing.T) {
+	s := &roleService{store: &memRoleStore{t: t, roles: []*Role{
+		{Name: perms.RoleOwner.Name, Permissions: []string{"users:read"}},
+		{Name: "moderator", Permissions: []string{"users:read"}},
+	}}}
+
+	roles, err := s.GetRoles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, r := range roles {
+		names = append(names, r.Name)
+		if r.Name == perms.RoleOwner.Name && !r.Builtin {
+			t.Error("the owner role should come from code, not the database")
+		}
+	}
+	if len(names) != 3 || names[2] != "moderator" {
+		t.Errorf("got roles %v, want system, owner and moderator", names)
+	}
+}
@@ -0,0 +1,102 @@
+package authroutes
+
+import (
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"log"
+	"net/http"
+
+	mw "github.com/NeuralNexusDev/neuralnexus-api/middleware"
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/auth"
+	"github.com/NeuralNexusDev/neuralnexus-api/responses"
+)
+
+// APIKeyRequest struct for creating an API key
+type APIKeyRequest struct {
+	Name        string   `json:"name" xml:"name" validate:"required"`
+	Permissions []string `json:"permissions" xml:"permissions"`
+	ExpiresAt   int64    `json:"exp" xml:"exp"`
+}
+
+// APIKeys struct for listing API keys
+type APIKeys struct {
+	APIKeys []*auth.APIKey `json:"api_keys" xml:"api_keys"`
+}
+
+// CreateAPIKeyHandler creates an API key for the current user
+func CreateAPIKeyHandler(keys auth.APIKeyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := r.Context().Value(mw.SessionKey).(*auth.Session)
+		if !ok || session == nil {
+			responses.Unauthorized(w, r, "")
+			return
+		}
+		if _, ok := r.Context().Value(mw.APIKeyKey).(*auth.APIKey); ok {
+			responses.Forbidden(w, r, "API keys cannot be used to create API keys")
+			return
+		}
+
+		var req APIKeyRequest
+		err := responses.DecodeStruct(r, &req)
+		if err != nil {
+			responses.BadRequest(w, r, "Invalid request body")
+			return
+		}
+
+		key, err := keys.CreateAPIKey(session, req.Name, req.Permissions, req.ExpiresAt)
+		switch {
+		case errors.Is(err, auth.ErrAPIKeyNameRequired), errors.Is(err, auth.ErrAPIKeyExpiryInPast):
+			responses.BadRequest(w, r, err.Error())
+			return
+		case errors.Is(err, auth.ErrAPIKeyPermission):
+			responses.Forbidden(w, r, "API keys can only be given permissions you already have")
+			return
+		case err != nil:
+			log.Println("Failed to create API key:\n\t", err)
+			responses.InternalServerError(w, r, "Failed to create API key")
+			return
+		}
+		responses.SendStruct(w, r, http.StatusCreated, key)
+	}
+}
+
+// GetAPIKeysHandler lists the current user's API keys
+func GetAPIKeysHandler(keys auth.APIKeyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := r.Context().Value(mw.SessionKey).(*auth.Session)
+		if !ok || session == nil {
+			responses.Unauthorized(w, r, "")
+			return
+		}
+
+		apiKeys, err := keys.GetAPIKeys(session.UserID)
+		if err != nil {
+			log.Println("Failed to get API keys:\n\t", err)
+			responses.InternalServerError(w, r, "Failed to get API keys")
+			return
+		}
+		responses.StructOK(w, r, APIKeys{apiKeys})
+	}
+}
+
+// DeleteAPIKeyHandler revokes one of the current user's API keys
+func DeleteAPIKeyHandler(keys auth.APIKeyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := r.Context().Value(mw.SessionKey).(*auth.Session)
+		if !ok || session == nil {
+			responses.Unauthorized(w, r, "")
+			return
+		}
+
+		err := keys.DeleteAPIKey(session.UserID, r.PathValue("key_id"))
+		if errors.Is(err, pgx.ErrNoRows) {
+			responses.NotFound(w, r, "API key not found")
+			return
+		} else if err != nil {
+			log.Println("Failed to delete API key:\n\t", err)
+			responses.InternalServerError(w, r, "Failed to delete API key")
+			return
+		}
+		responses.NoContent(w, r)
+	}
+}
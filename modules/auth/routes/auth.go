@@ -1,10 +1,12 @@
 package authroutes
 
 import (
-	"encoding/base64"
+	"crypto/subtle"
+	"errors"
 	"github.com/goccy/go-json"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	mw "github.com/NeuralNexusDev/neuralnexus-api/middleware"
@@ -22,11 +24,28 @@ type Login struct {
 
 // ReturnedJWT struct for JWT session
 type ReturnedJWT struct {
-	Session string `json:"session" xml:"session"`
+	Session      string `json:"session" xml:"session"`
+	RefreshToken string `json:"refresh_token,omitempty" xml:"refresh_token,omitempty"`
+}
+
+// RefreshRequest struct for refresh request
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" xml:"refresh_token"`
+}
+
+// MFAChallenge struct returned instead of a session when a second factor is required
+type MFAChallenge struct {
+	MFARequired bool   `json:"mfa_required" xml:"mfa_required"`
+	MFAToken    string `json:"mfa_token" xml:"mfa_token"`
+}
+
+// retryAfter rounds a lockout up to whole seconds for the Retry-After header
+func retryAfter(lock time.Duration) int {
+	return int((lock + time.Second - 1) / time.Second)
 }
 
 // LoginHandler handles the login route
-func LoginHandler(as auth.AccountService, ss auth.SessionService) http.HandlerFunc {
+func LoginHandler(as auth.AccountService, ss auth.SessionService, mfa auth.MFAService, lockout auth.LockoutService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var login Login
 		err := responses.DecodeStruct(r, &login)
@@ -46,40 +65,417 @@ func LoginHandler(as auth.AccountService, ss auth.SessionService) http.HandlerFu
 			return
 		}
 
+		// Locked accounts are turned away before the password is checked, so guessing can't go on in the meantime
+		attempt := &auth.LoginAttempt{UserAgent: r.UserAgent(), RemoteAddr: mw.RemoteAddr(r.Context())}
+		lock, err := lockout.LockedFor(account.UserID)
+		if err != nil {
+			log.Println("Failed to check login lockout:\n\t", err)
+			responses.InternalServerError(w, r, "Authentication failed")
+			return
+		}
+		if lock > 0 {
+			lockout.LoginBlocked(account, attempt)
+			responses.TooManyRequests(w, r, retryAfter(lock), "Too many failed logins, try again later")
+			return
+		}
+
 		if !account.ValidateUser(login.Password) {
+			lock, err = lockout.LoginFailed(account, attempt, "invalid password")
+			if err != nil {
+				log.Println("Failed to record failed login:\n\t", err)
+			}
+			if lock > 0 {
+				responses.TooManyRequests(w, r, retryAfter(lock), "Too many failed logins, try again later")
+				return
+			}
 			responses.BadRequest(w, r, "Invalid username or password")
 			return
 		}
 
-		session, err := account.NewSession(time.Now().Add(time.Hour * 24).Unix())
+		if !account.EmailVerified {
+			responses.Forbidden(w, r, "Email address has not been verified")
+			return
+		}
+
+		if mfa.IsTOTPEnabled(account.UserID) {
+			token, err := mfa.CreateMFAChallenge(account.UserID)
+			if err != nil {
+				log.Println("Failed to create MFA challenge:\n\t", err)
+				responses.InternalServerError(w, r, "Authentication failed")
+				return
+			}
+			// The login is only recorded, and the failures cleared, once the second factor is checked
+			responses.StructOK(w, r, MFAChallenge{MFARequired: true, MFAToken: token})
+			return
+		}
+
+		err = lockout.LoginSucceeded(account, attempt, "password")
 		if err != nil {
-			log.Println("Failed to create session:\n\t", err)
-			responses.InternalServerError(w, r, "Authentication failed")
+			log.Println("Failed to record login:\n\t", err)
+		}
+		IssueSession(w, r, ss, account)
+	}
+}
+
+// IssueSession creates a session for an authenticated account and responds with its JWT and refresh token
+func IssueSession(w http.ResponseWriter, r *http.Request, ss auth.SessionService, account *auth.Account) {
+	session, err := account.NewSession(auth.NewSessionExpiry())
+	if err != nil {
+		log.Println("Failed to create session:\n\t", err)
+		responses.InternalServerError(w, r, "Authentication failed")
+		return
+	}
+	session.SetClient(r.UserAgent(), mw.RemoteAddr(r.Context()))
+
+	jwt, err := ss.CreateJWT(session)
+	if err != nil {
+		log.Println("Failed to create JWT:\n\t", err)
+		responses.InternalServerError(w, r, "Authentication failed")
+		return
+	}
+
+	err = ss.AddSession(session)
+	if err != nil {
+		log.Println("Failed to add session:\n\t", err)
+		responses.InternalServerError(w, r, "Authentication failed")
+		return
+	}
+
+	refreshToken, err := ss.CreateRefreshToken(session)
+	if err != nil {
+		log.Println("Failed to create refresh token:\n\t", err)
+		responses.InternalServerError(w, r, "Authentication failed")
+		return
+	}
+	responses.StructOK(w, r, ReturnedJWT{jwt, refreshToken})
+}
+
+// RefreshHandler swaps a refresh token for a new JWT and a rotated refresh token
+func RefreshHandler(ss auth.SessionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req RefreshRequest
+		err := responses.DecodeStruct(r, &req)
+		fromCookie := false
+		if err != nil || req.RefreshToken == "" {
+			cookie, cookieErr := r.Cookie("refresh_token")
+			if cookieErr != nil || cookie.Value == "" {
+				responses.BadRequest(w, r, "Invalid request body")
+				return
+			}
+			req.RefreshToken = cookie.Value
+			fromCookie = true
+		}
+
+		// Refresh tokens given to OIDC clients are redeemed at the OIDC token endpoint
+		session, err := ss.GetRefreshTokenSession(req.RefreshToken)
+		if err == nil && session.ClientID != "" {
+			responses.Unauthorized(w, r, "Invalid or expired refresh token")
+			return
+		}
+		session, refreshToken, err := ss.RefreshSession(req.RefreshToken)
+		if err == nil && session.ClientID != "" {
+			err = auth.ErrInvalidRefreshToken
+		}
+		if errors.Is(err, auth.ErrInvalidRefreshToken) || errors.Is(err, auth.ErrRefreshTokenReused) {
+			responses.Unauthorized(w, r, "Invalid or expired refresh token")
+			return
+		} else if err != nil {
+			log.Println("Failed to refresh session:\n\t", err)
+			responses.InternalServerError(w, r, "Failed to refresh session")
 			return
 		}
 
 		jwt, err := ss.CreateJWT(session)
 		if err != nil {
 			log.Println("Failed to create JWT:\n\t", err)
-			responses.InternalServerError(w, r, "Authentication failed")
+			responses.InternalServerError(w, r, "Failed to refresh session")
 			return
 		}
+		if fromCookie {
+			err = setSessionCookies(w, session, jwt, refreshToken)
+			if err != nil {
+				log.Println("Failed to set session cookies:\n\t", err)
+				responses.InternalServerError(w, r, "Failed to refresh session")
+				return
+			}
+		}
+		responses.StructOK(w, r, ReturnedJWT{jwt, refreshToken})
+	}
+}
+
+// cookieDomain - Domain the site's cookies are shared on, so the API and the site both get them
+const cookieDomain = ".neuralnexus.dev"
 
-		err = ss.AddSession(session)
+// setSessionCookies sets the cookies used by the site after an OAuth login
+// The session cookie authenticates API calls from the site, the CSRF cookie is readable by the site so it can
+// send it back in the X-CSRF-Token header
+func setSessionCookies(w http.ResponseWriter, session *auth.Session, jwt, refreshToken string) error {
+	csrfToken, err := auth.GenerateToken()
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     mw.SessionCookie,
+		Value:    jwt,
+		Domain:   cookieDomain,
+		Path:     "/",
+		Expires:  time.Unix(session.ExpiresAt, 0),
+		Secure:   true,
+		HttpOnly: true,
+		// Lax so the cookie is still sent when an OAuth provider redirects back to link an account
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     "refresh_token",
+		Value:    refreshToken,
+		Domain:   cookieDomain,
+		Path:     "/api/v1/auth/refresh",
+		Expires:  time.Unix(session.ExpiresAt, 0),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     mw.CSRFCookie,
+		Value:    csrfToken,
+		Domain:   cookieDomain,
+		Path:     "/",
+		Expires:  time.Unix(session.ExpiresAt, 0),
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return nil
+}
+
+// clearSessionCookies removes the site's session cookies on logout
+func clearSessionCookies(w http.ResponseWriter) {
+	for name, path := range map[string]string{
+		mw.SessionCookie: "/",
+		"refresh_token":  "/api/v1/auth/refresh",
+		mw.CSRFCookie:    "/",
+	} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Domain:   cookieDomain,
+			Path:     path,
+			MaxAge:   -1,
+			Secure:   true,
+			HttpOnly: name != mw.CSRFCookie,
+		})
+	}
+}
+
+// Registration struct for register request
+type Registration struct {
+	Username string `json:"username" xml:"username" validate:"required"`
+	Email    string `json:"email" xml:"email" validate:"required"`
+	Password string `json:"password" xml:"password" validate:"required"`
+}
+
+// RegisterHandler handles the register route
+func RegisterHandler(as auth.AccountService, vs auth.VerificationService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var reg Registration
+		err := responses.DecodeStruct(r, &reg)
 		if err != nil {
-			log.Println("Failed to add session:\n\t", err)
-			responses.InternalServerError(w, r, "Authentication failed")
+			responses.BadRequest(w, r, "Invalid request body")
+			return
+		}
+		reg.Email = strings.TrimSpace(reg.Email)
+
+		if err = auth.ValidateUsername(reg.Username); err != nil {
+			responses.BadRequest(w, r, err.Error())
+			return
+		}
+		if err = auth.ValidateEmail(reg.Email); err != nil {
+			responses.BadRequest(w, r, err.Error())
+			return
+		}
+		if err = auth.ValidatePassword(reg.Password); err != nil {
+			responses.BadRequest(w, r, err.Error())
+			return
+		}
+
+		if _, err = as.GetAccountByUsername(reg.Username); err == nil {
+			responses.Conflict(w, r, "Username is already taken")
+			return
+		}
+		if _, err = as.GetAccountByEmail(reg.Email); err == nil {
+			responses.Conflict(w, r, "Email is already registered")
+			return
+		}
+
+		account, err := auth.NewAccount(reg.Username, reg.Email, reg.Password)
+		if err != nil {
+			log.Println("Failed to create account:\n\t", err)
+			responses.InternalServerError(w, r, "Registration failed")
+			return
+		}
+		err = as.AddAccount(account)
+		if err != nil {
+			log.Println("Failed to add account:\n\t", err)
+			responses.Conflict(w, r, "Username or email is already registered")
 			return
 		}
-		responses.StructOK(w, r, ReturnedJWT{jwt})
+
+		err = vs.SendVerificationEmail(account)
+		if err != nil {
+			log.Println("Failed to send verification email:\n\t", err)
+		}
+		responses.SendStruct(w, r, http.StatusCreated, account)
+	}
+}
+
+// EmailVerification struct for verify email request
+type EmailVerification struct {
+	Token string `json:"token" xml:"token" validate:"required"`
+}
+
+// VerifyEmailHandler handles the verify email route
+func VerifyEmailHandler(vs auth.VerificationService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var verification EmailVerification
+		err := responses.DecodeStruct(r, &verification)
+		if err != nil || verification.Token == "" {
+			responses.BadRequest(w, r, "Invalid request body")
+			return
+		}
+
+		account, err := vs.VerifyEmail(verification.Token)
+		if err != nil {
+			log.Println("Failed to verify email:\n\t", err)
+			responses.BadRequest(w, r, "Invalid or expired token")
+			return
+		}
+		responses.StructOK(w, r, account)
+	}
+}
+
+// ResendVerification struct for resend verification request
+type ResendVerification struct {
+	Email string `json:"email" xml:"email" validate:"required"`
+}
+
+// ResendVerificationHandler handles the resend verification email route
+func ResendVerificationHandler(as auth.AccountService, vs auth.VerificationService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var resend ResendVerification
+		err := responses.DecodeStruct(r, &resend)
+		if err != nil || resend.Email == "" {
+			responses.BadRequest(w, r, "Invalid request body")
+			return
+		}
+
+		// Always respond the same way so that registered emails can't be enumerated
+		account, err := as.GetAccountByEmail(strings.TrimSpace(resend.Email))
+		if err == nil && !account.EmailVerified {
+			err = vs.SendVerificationEmail(account)
+			if err != nil {
+				log.Println("Failed to send verification email:\n\t", err)
+			}
+		}
+		responses.NoContent(w, r)
+	}
+}
+
+// PasswordChange struct for change password request
+type PasswordChange struct {
+	OldPassword string `json:"old_password" xml:"old_password" validate:"required"`
+	NewPassword string `json:"new_password" xml:"new_password" validate:"required"`
+}
+
+// ChangePasswordHandler handles the change password route
+func ChangePasswordHandler(ps auth.PasswordService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := r.Context().Value(mw.SessionKey).(*auth.Session)
+		if !ok || session == nil {
+			responses.Unauthorized(w, r, "")
+			return
+		}
+
+		var change PasswordChange
+		err := responses.DecodeStruct(r, &change)
+		if err != nil {
+			responses.BadRequest(w, r, "Invalid request body")
+			return
+		}
+		if err = auth.ValidatePassword(change.NewPassword); err != nil {
+			responses.BadRequest(w, r, err.Error())
+			return
+		}
+
+		err = ps.ChangePassword(session, change.OldPassword, change.NewPassword)
+		if errors.Is(err, auth.ErrInvalidPassword) {
+			responses.BadRequest(w, r, "Invalid password")
+			return
+		} else if err != nil {
+			log.Println("Failed to change password:\n\t", err)
+			responses.InternalServerError(w, r, "Failed to change password")
+			return
+		}
+		responses.NoContent(w, r)
+	}
+}
+
+// ForgotPassword struct for forgot password request
+type ForgotPassword struct {
+	Email string `json:"email" xml:"email" validate:"required"`
+}
+
+// ForgotPasswordHandler handles the forgot password route
+func ForgotPasswordHandler(ps auth.PasswordService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var forgot ForgotPassword
+		err := responses.DecodeStruct(r, &forgot)
+		if err != nil || forgot.Email == "" {
+			responses.BadRequest(w, r, "Invalid request body")
+			return
+		}
+
+		// Always respond the same way so that registered emails can't be enumerated
+		err = ps.RequestPasswordReset(strings.TrimSpace(forgot.Email))
+		if err != nil {
+			log.Println("Failed to request password reset:\n\t", err)
+		}
+		responses.NoContent(w, r)
+	}
+}
+
+// PasswordReset struct for reset password request
+type PasswordReset struct {
+	Token       string `json:"token" xml:"token" validate:"required"`
+	NewPassword string `json:"new_password" xml:"new_password" validate:"required"`
+}
+
+// ResetPasswordHandler handles the reset password route
+func ResetPasswordHandler(ps auth.PasswordService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var reset PasswordReset
+		err := responses.DecodeStruct(r, &reset)
+		if err != nil || reset.Token == "" {
+			responses.BadRequest(w, r, "Invalid request body")
+			return
+		}
+		if err = auth.ValidatePassword(reset.NewPassword); err != nil {
+			responses.BadRequest(w, r, err.Error())
+			return
+		}
+
+		err = ps.ResetPassword(reset.Token, reset.NewPassword)
+		if err != nil {
+			log.Println("Failed to reset password:\n\t", err)
+			responses.BadRequest(w, r, "Invalid or expired token")
+			return
+		}
+		responses.NoContent(w, r)
 	}
 }
 
 // LogoutHandler handles the logout route
 func LogoutHandler(ss auth.SessionService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		session := r.Context().Value(mw.SessionKey).(*auth.Session)
-		if session == nil {
+		session, ok := mw.GetSession(r.Context())
+		if !ok {
 			responses.BadRequest(w, r, "Invalid session")
 			return
 		}
@@ -89,12 +485,53 @@ func LogoutHandler(ss auth.SessionService) http.HandlerFunc {
 			responses.InternalServerError(w, r, "Failed to delete session")
 			return
 		}
+		clearSessionCookies(w)
 		responses.NoContent(w, r)
 	}
 }
 
+// oauthStateCookie - Cookie that ties an OAuth flow to the browser that started it
+const oauthStateCookie = "oauth_state"
+
+// StartOAuthHandler starts logging in with or linking a platform, redirecting the user to the platform
+func StartOAuthHandler(states linking.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		// Only the user's own session can start linking, not API keys or tokens issued to other apps
+		session, _ := mw.FirstPartySession(r)
+		authURL, state, err := linking.StartOAuth(states, auth.Platform(r.PathValue("platform")), linking.Mode(query.Get("mode")), query.Get("redirect_uri"), session)
+		switch {
+		case errors.Is(err, linking.ErrUnknownProvider):
+			responses.NotFound(w, r, "Unknown platform")
+			return
+		case errors.Is(err, linking.ErrNotSignedIn):
+			responses.Unauthorized(w, r, err.Error())
+			return
+		case errors.Is(err, linking.ErrInvalidMode), errors.Is(err, linking.ErrRedirectNotAllowed):
+			responses.BadRequest(w, r, err.Error())
+			return
+		case err != nil:
+			log.Println("Failed to start OAuth:\n\t", err)
+			responses.InternalServerError(w, r, "Failed to start OAuth")
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     oauthStateCookie,
+			Value:    state,
+			Path:     "/api/oauth",
+			MaxAge:   int(linking.OAuthStateTTL.Seconds()),
+			Secure:   true,
+			HttpOnly: true,
+			// Lax so the cookie is sent when the platform redirects back
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, authURL, http.StatusSeeOther)
+	}
+}
+
 // OAuthHandler handles the OAuth route
-func OAuthHandler(as auth.AccountService, las auth.LinkAccountStore, ss auth.SessionService) http.HandlerFunc {
+func OAuthHandler(as auth.AccountService, las auth.LinkAccountStore, ss auth.SessionService, tokens auth.OAuthTokenService, lockout auth.LockoutService, states linking.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var err error
 
@@ -105,75 +542,102 @@ func OAuthHandler(as auth.AccountService, las auth.LinkAccountStore, ss auth.Ses
 			return
 		}
 
-		stateB64 := r.URL.Query().Get("state")
-		if stateB64 == "" {
-			log.Println("No state provided")
-			responses.BadRequest(w, r, "Invalid request")
-			return
-		}
-		stateBytes, err := base64.URLEncoding.DecodeString(stateB64)
-		if err != nil {
-			log.Println("Failed to decode state:\n\t", err)
-			responses.BadRequest(w, r, "Invalid state")
-			return
-		}
-		var state linking.OAuthState
-		err = json.Unmarshal(stateBytes, &state)
-		if err != nil {
-			log.Println("Failed to unmarshal state:\n\t", err)
+		// The state must be the one this browser was given when it started the flow
+		stateToken := r.URL.Query().Get("state")
+		cookie, err := r.Cookie(oauthStateCookie)
+		if err != nil || stateToken == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(stateToken)) != 1 {
+			log.Println("State does not match")
 			responses.BadRequest(w, r, "Invalid state")
 			return
 		}
-		if state.Platform == "" || state.Nonce == "" || state.RedirectURI == "" || state.Mode == "" {
-			log.Println("Invalid state")
-			responses.BadRequest(w, r, "Invalid state")
-			return
-		}
-
-		// Verify that the nonce matches the value in the browser's cookie
-		cookie, err := r.Cookie("nonce")
+		http.SetCookie(w, &http.Cookie{
+			Name:     oauthStateCookie,
+			Path:     "/api/oauth",
+			MaxAge:   -1,
+			Secure:   true,
+			HttpOnly: true,
+		})
+		state, err := linking.ConsumeOAuthState(states, stateToken)
 		if err != nil {
-			log.Println("Failed to get nonce cookie:\n\t", err)
-			responses.BadRequest(w, r, "Invalid state")
-			return
-		}
-		if cookie.Value != state.Nonce {
-			log.Println("Nonce does not match")
-			responses.BadRequest(w, r, "Invalid state")
+			responses.BadRequest(w, r, "Invalid or expired state")
 			return
 		}
 
 		var session *auth.Session
 		switch state.Mode {
 		case linking.ModeLogin:
-			session, err = linking.ProcessOAuthLogin(as, las, ss, code, &state)
+			session, err = linking.ProcessOAuthLogin(r, as, las, ss, tokens, lockout, code, state)
+		case linking.ModeLink:
+			// The callback is a browser redirect, only the user's own session from the cookie can link accounts
+			session, _ = mw.FirstPartySession(r)
+			err = linking.ProcessOAuthLink(session, las, tokens, code, state)
+			switch {
+			case errors.Is(err, linking.ErrNotSignedIn):
+				responses.Unauthorized(w, r, err.Error())
+			case errors.Is(err, linking.ErrLinkStartedByOther):
+				responses.Forbidden(w, r, err.Error())
+			case errors.Is(err, linking.ErrLinkedToAnotherAccount), errors.Is(err, linking.ErrPlatformAlreadyLinked):
+				responses.Conflict(w, r, err.Error())
+			case errors.Is(err, linking.ErrPlatformAccount):
+				responses.BadRequest(w, r, err.Error())
+			case err != nil:
+				log.Println("Failed to link account:\n\t", err)
+				responses.InternalServerError(w, r, "Failed to link account")
+			default:
+				http.Redirect(w, r, state.RedirectURI, http.StatusSeeOther)
+			}
+			return
 		default:
 			log.Println("Invalid mode")
 			responses.BadRequest(w, r, "Invalid state")
+			return
 		}
 
-		if err != nil {
+		if errors.Is(err, linking.ErrPlatformAccount) {
+			responses.BadRequest(w, r, err.Error())
+			return
+		} else if err != nil {
 			log.Println("Failed to process OAuth:\n\t", err)
 			responses.InternalServerError(w, r, "Authentication failed")
 			return
 		}
 
-		// Set the session cookie and redirect the user
+		// Set the session cookies and redirect the user
 		jwtString, err := ss.CreateJWT(session)
 		if err != nil {
 			log.Println("Failed to create JWT:\n\t", err)
 			responses.InternalServerError(w, r, "Authentication failed")
 			return
 		}
-		http.SetCookie(w, &http.Cookie{
-			Name:    "session",
-			Value:   jwtString,
-			Domain:  ".neuralnexus.dev",
-			Path:    "/",
-			Expires: time.Unix(session.ExpiresAt, 0),
-			Secure:  true,
-		})
+		refreshToken, err := ss.CreateRefreshToken(session)
+		if err != nil {
+			log.Println("Failed to create refresh token:\n\t", err)
+			responses.InternalServerError(w, r, "Authentication failed")
+			return
+		}
+		err = setSessionCookies(w, session, jwtString, refreshToken)
+		if err != nil {
+			log.Println("Failed to set session cookies:\n\t", err)
+			responses.InternalServerError(w, r, "Authentication failed")
+			return
+		}
 
 		http.Redirect(w, r, state.RedirectURI, http.StatusSeeOther)
 	}
 }
+
+// JWKSHandler publishes the public keys that session JWTs are signed with
+func JWKSHandler(keys auth.SigningKeyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jwks, err := keys.JWKS()
+		if err != nil {
+			log.Println("Failed to get JWKS:\n\t", err)
+			responses.InternalServerError(w, r, "Failed to get signing keys")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(jwks)
+	}
+}
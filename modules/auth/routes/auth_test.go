@@ -0,0 +1,245 @@
+package authroutes
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/auth"
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/email"
+	"github.com/jackc/pgx/v5"
+)
+
+// memStore - auth.Store backed by memory, only the stores used by registration are implemented
+type memStore struct {
+	auth.Store
+	accounts *memAccountStore
+	tokens   *memTokenStore
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		accounts: &memAccountStore{accounts: map[string]*auth.Account{}},
+		tokens:   &memTokenStore{tokens: map[string]string{}},
+	}
+}
+
+func (s *memStore) Account() auth.AccountStore {
+	return s.accounts
+}
+
+func (s *memStore) OneTimeToken() auth.OneTimeTokenStore {
+	return s.tokens
+}
+
+// memAccountStore - auth.AccountStore backed by memory
+type memAccountStore struct {
+	mu       sync.Mutex
+	accounts map[string]*auth.Account
+}
+
+func (s *memAccountStore) find(match func(*auth.Account) bool) (*auth.Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range s.accounts {
+		if match(a) {
+			account := *a
+			return &account, nil
+		}
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (s *memAccountStore) AddAccountToDB(account *auth.Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range s.accounts {
+		if a.Username == account.Username {
+			return auth.ErrUsernameTaken
+		}
+		if a.Email == account.Email {
+			return auth.ErrEmailTaken
+		}
+	}
+	stored := *account
+	s.accounts[account.UserID] = &stored
+	return nil
+}
+
+func (s *memAccountStore) GetAccountByID(userID string) (*auth.Account, error) {
+	return s.find(func(a *auth.Account) bool { return a.UserID == userID })
+}
+
+func (s *memAccountStore) GetAccountByUsername(username string) (*auth.Account, error) {
+	return s.find(func(a *auth.Account) bool { return a.Username == username })
+}
+
+func (s *memAccountStore) GetAccountByEmail(email string) (*auth.Account, error) {
+	return s.find(func(a *auth.Account) bool { return a.Email == email })
+}
+
+func (s *memAccountStore) UpdateAccountInDB(account *auth.Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.accounts[account.UserID]; !ok {
+		return pgx.ErrNoRows
+	}
+	stored := *account
+	s.accounts[account.UserID] = &stored
+	return nil
+}
+
+func (s *memAccountStore) DeleteAccountFromDB(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.accounts, userID)
+	return nil
+}
+
+func (s *memAccountStore) MergeAccountsInDB(intoID string, fromID string) ([]string, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *memAccountStore) GetAccountRedirect(userID string) (string, error) {
+	return "", pgx.ErrNoRows
+}
+
+// memTokenStore - auth.OneTimeTokenStore backed by memory, tokens don't expire
+type memTokenStore struct {
+	mu       sync.Mutex
+	tokens   map[string]string
+	failures map[string]int
+}
+
+func (s *memTokenStore) AddOneTimeToken(purpose auth.TokenPurpose, token string, userID string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[string(purpose)+":"+token] = userID
+	return nil
+}
+
+func (s *memTokenStore) GetOneTimeToken(purpose auth.TokenPurpose, token string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	userID, ok := s.tokens[string(purpose)+":"+token]
+	if !ok {
+		return "", errors.New("token not found")
+	}
+	return userID, nil
+}
+
+func (s *memTokenStore) ConsumeOneTimeToken(purpose auth.TokenPurpose, token string) (string, error) {
+	userID, err := s.GetOneTimeToken(purpose, token)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, string(purpose)+":"+token)
+	return userID, nil
+}
+
+func (s *memTokenStore) IncrementOneTimeTokenFailures(purpose auth.TokenPurpose, token string, ttl time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures == nil {
+		s.failures = map[string]int{}
+	}
+	s.failures[string(purpose)+":"+token]++
+	return s.failures[string(purpose)+":"+token], nil
+}
+
+// verificationToken gets the token from the link in a verification email
+func verificationToken(t *testing.T, msg *email.Message) string {
+	t.Helper()
+	_, link, ok := strings.Cut(msg.Body, "/verify-email?token=")
+	if !ok {
+		t.Fatalf("verification email has no link:\n%s", msg.Body)
+	}
+	token, _, _ := strings.Cut(link, "\n")
+	return token
+}
+
+func post(handler http.HandlerFunc, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestRegisterAndVerifyEmail(t *testing.T) {
+	store := newMemStore()
+	sender := email.NewCaptureSender()
+	as := auth.NewAccountService(store)
+	vs := auth.NewVerificationService(store, sender)
+
+	w := post(RegisterHandler(as, vs), `{"username":"steve","email":"steve@example.com","password":"correct horse battery"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register returned %d: %s", w.Code, w.Body.String())
+	}
+	account, err := as.GetAccountByEmail("steve@example.com")
+	if err != nil {
+		t.Fatal("registered account not stored:", err)
+	}
+	if account.EmailVerified {
+		t.Error("new account should not be verified yet")
+	}
+
+	msg := sender.Last("steve@example.com")
+	if msg == nil {
+		t.Fatal("no verification email was sent")
+	}
+	token := verificationToken(t, msg)
+
+	w = post(VerifyEmailHandler(vs), `{"token":"`+token+`"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("verify returned %d: %s", w.Code, w.Body.String())
+	}
+	account, err = as.GetAccountByID(account.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !account.EmailVerified {
+		t.Error("account should be verified")
+	}
+
+	// The link can only be used once
+	w = post(VerifyEmailHandler(vs), `{"token":"`+token+`"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("reusing the token returned %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestRegisterRejectsTakenEmail(t *testing.T) {
+	store := newMemStore()
+	sender := email.NewCaptureSender()
+	as := auth.NewAccountService(store)
+	vs := auth.NewVerificationService(store, sender)
+
+	w := post(RegisterHandler(as, vs), `{"username":"steve","email":"steve@example.com","password":"correct horse battery"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register returned %d: %s", w.Code, w.Body.String())
+	}
+	w = post(RegisterHandler(as, vs), `{"username":"alex","email":"steve@example.com","password":"correct horse battery"}`)
+	if w.Code != http.StatusConflict {
+		t.Errorf("registering a taken email returned %d, want %d", w.Code, http.StatusConflict)
+	}
+	if len(sender.Messages) != 1 {
+		t.Errorf("sent %d emails, want 1", len(sender.Messages))
+	}
+}
+
+func TestVerifyEmailRejectsUnknownToken(t *testing.T) {
+	store := newMemStore()
+	vs := auth.NewVerificationService(store, email.NewCaptureSender())
+
+	w := post(VerifyEmailHandler(vs), `{"token":"not-a-token"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown token returned %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
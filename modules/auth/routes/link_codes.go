@@ -0,0 +1,96 @@
+package authroutes
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	mw "github.com/NeuralNexusDev/neuralnexus-api/middleware"
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/auth"
+	"github.com/NeuralNexusDev/neuralnexus-api/responses"
+	"github.com/google/uuid"
+)
+
+// MinecraftLinkRequest struct, sent by the server plugin for a player
+type MinecraftLinkRequest struct {
+	Code     string `json:"code,omitempty" xml:"code,omitempty"`
+	UUID     string `json:"uuid" xml:"uuid" validate:"required"`
+	Username string `json:"username" xml:"username" validate:"required"`
+}
+
+// linkCodeError sends the response for a link code service error
+func linkCodeError(w http.ResponseWriter, r *http.Request, err error, action string) {
+	switch {
+	case errors.Is(err, auth.ErrLinkCodeInvalid):
+		responses.BadRequest(w, r, err.Error())
+	case errors.Is(err, auth.ErrLinkCodeRateLimited):
+		responses.TooManyRequests(w, r, mw.RetryAfter, err.Error())
+	case errors.Is(err, auth.ErrLinkedToAnotherAccount), errors.Is(err, auth.ErrPlatformAlreadyLinked):
+		responses.Conflict(w, r, err.Error())
+	default:
+		log.Println("Failed to "+action+":\n\t", err)
+		responses.InternalServerError(w, r, "Failed to "+action)
+	}
+}
+
+// decodeMinecraftLinkRequest reads the player from the request, the UUID is normalized so it matches OAuth links
+func decodeMinecraftLinkRequest(r *http.Request) (*MinecraftLinkRequest, error) {
+	var req MinecraftLinkRequest
+	err := responses.DecodeStruct(r, &req)
+	if err != nil {
+		return nil, err
+	}
+	id, err := uuid.Parse(req.UUID)
+	if err != nil || req.Username == "" {
+		return nil, errors.New("invalid player")
+	}
+	req.UUID = id.String()
+	return &req, nil
+}
+
+// CreateUserLinkCodeHandler - Create a code the user can type in game to link their Minecraft account
+func CreateUserLinkCodeHandler(codes auth.LinkCodeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		linkCode, err := codes.CreateUserCode(r.PathValue("user_id"))
+		if err != nil {
+			linkCodeError(w, r, err, "create link code")
+			return
+		}
+		responses.SendStruct(w, r, http.StatusCreated, linkCode)
+	}
+}
+
+// MinecraftLinkHandler - Redeem a user's link code for the player who typed it in game
+func MinecraftLinkHandler(codes auth.LinkCodeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, err := decodeMinecraftLinkRequest(r)
+		if err != nil || req.Code == "" {
+			responses.BadRequest(w, r, "Invalid request body")
+			return
+		}
+		apiKey, _ := r.Context().Value(mw.APIKeyKey).(*auth.APIKey)
+		la, err := codes.RedeemUserCode(req.Code, "apikey:"+apiKey.ID, auth.PlatformMinecraft, req.UUID, req.Username)
+		if err != nil {
+			linkCodeError(w, r, err, "link account")
+			return
+		}
+		responses.SendStruct(w, r, http.StatusCreated, la)
+	}
+}
+
+// MinecraftLinkCodeHandler - Create a code for a player to type where they are signed in, e.g. Twitch chat
+func MinecraftLinkCodeHandler(codes auth.LinkCodeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, err := decodeMinecraftLinkRequest(r)
+		if err != nil {
+			responses.BadRequest(w, r, "Invalid request body")
+			return
+		}
+		linkCode, err := codes.CreatePlatformCode(auth.PlatformMinecraft, req.UUID, req.Username)
+		if err != nil {
+			linkCodeError(w, r, err, "create link code")
+			return
+		}
+		responses.SendStruct(w, r, http.StatusCreated, linkCode)
+	}
+}
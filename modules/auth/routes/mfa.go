@@ -0,0 +1,189 @@
+package authroutes
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	mw "github.com/NeuralNexusDev/neuralnexus-api/middleware"
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/auth"
+	"github.com/NeuralNexusDev/neuralnexus-api/responses"
+)
+
+// MFACode struct for requests that carry a TOTP or recovery code
+type MFACode struct {
+	Code string `json:"code" xml:"code" validate:"required"`
+}
+
+// MFALogin struct for the second login step
+type MFALogin struct {
+	MFAToken string `json:"mfa_token" xml:"mfa_token" validate:"required"`
+	Code     string `json:"code" xml:"code" validate:"required"`
+}
+
+// RecoveryCodes struct returned once TOTP is confirmed
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes" xml:"recovery_codes"`
+}
+
+// MFALoginHandler handles the second login step, swapping an MFA pending token for a session
+// Wrong codes count towards the account's lockout the same as wrong passwords
+func MFALoginHandler(as auth.AccountService, ss auth.SessionService, mfa auth.MFAService, lockout auth.LockoutService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var login MFALogin
+		err := responses.DecodeStruct(r, &login)
+		if err != nil || login.MFAToken == "" || login.Code == "" {
+			responses.BadRequest(w, r, "Invalid request body")
+			return
+		}
+
+		userID, err := mfa.GetMFAChallenge(login.MFAToken)
+		if err != nil {
+			responses.BadRequest(w, r, "Invalid or expired token")
+			return
+		}
+		account, err := as.GetAccountByID(userID)
+		if err != nil {
+			log.Println("Failed to get account:\n\t", err)
+			responses.InternalServerError(w, r, "Authentication failed")
+			return
+		}
+
+		attempt := &auth.LoginAttempt{UserAgent: r.UserAgent(), RemoteAddr: mw.RemoteAddr(r.Context())}
+		lock, err := lockout.LockedFor(account.UserID)
+		if err != nil {
+			log.Println("Failed to check login lockout:\n\t", err)
+			responses.InternalServerError(w, r, "Authentication failed")
+			return
+		}
+		if lock > 0 {
+			lockout.LoginBlocked(account, attempt)
+			responses.TooManyRequests(w, r, retryAfter(lock), "Too many failed logins, try again later")
+			return
+		}
+
+		_, err = mfa.VerifyMFAChallenge(login.MFAToken, login.Code)
+		if errors.Is(err, auth.ErrInvalidMFACode) {
+			lock, err = lockout.LoginFailed(account, attempt, "invalid second factor")
+			if err != nil {
+				log.Println("Failed to record failed login:\n\t", err)
+			}
+			if lock > 0 {
+				responses.TooManyRequests(w, r, retryAfter(lock), "Too many failed logins, try again later")
+				return
+			}
+			responses.BadRequest(w, r, "Invalid code")
+			return
+		} else if errors.Is(err, auth.ErrInvalidMFAToken) || errors.Is(err, auth.ErrTOTPNotEnrolled) {
+			responses.BadRequest(w, r, "Invalid or expired token")
+			return
+		} else if err != nil {
+			log.Println("Failed to verify MFA code:\n\t", err)
+			responses.InternalServerError(w, r, "Authentication failed")
+			return
+		}
+
+		err = lockout.LoginSucceeded(account, attempt, "password and second factor")
+		if err != nil {
+			log.Println("Failed to record login:\n\t", err)
+		}
+		IssueSession(w, r, ss, account)
+	}
+}
+
+// EnrollTOTPHandler starts TOTP enrolment for the current user
+func EnrollTOTPHandler(as auth.AccountService, mfa auth.MFAService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := r.Context().Value(mw.SessionKey).(*auth.Session)
+		if !ok || session == nil {
+			responses.Unauthorized(w, r, "")
+			return
+		}
+
+		account, err := as.GetAccountByID(session.UserID)
+		if err != nil {
+			responses.NotFound(w, r, "User not found")
+			return
+		}
+
+		enrollment, err := mfa.EnrollTOTP(account)
+		if errors.Is(err, auth.ErrTOTPEnabled) {
+			responses.Conflict(w, r, "Two-factor authentication is already enabled")
+			return
+		} else if err != nil {
+			log.Println("Failed to enroll TOTP:\n\t", err)
+			responses.InternalServerError(w, r, "Failed to enroll two-factor authentication")
+			return
+		}
+		responses.StructOK(w, r, enrollment)
+	}
+}
+
+// ConfirmTOTPHandler enables TOTP once the first code checks out
+func ConfirmTOTPHandler(mfa auth.MFAService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := r.Context().Value(mw.SessionKey).(*auth.Session)
+		if !ok || session == nil {
+			responses.Unauthorized(w, r, "")
+			return
+		}
+
+		var code MFACode
+		err := responses.DecodeStruct(r, &code)
+		if err != nil || code.Code == "" {
+			responses.BadRequest(w, r, "Invalid request body")
+			return
+		}
+
+		codes, err := mfa.ConfirmTOTP(session.UserID, code.Code)
+		switch {
+		case errors.Is(err, auth.ErrInvalidMFACode):
+			responses.BadRequest(w, r, "Invalid code")
+			return
+		case errors.Is(err, auth.ErrTOTPNotEnrolled):
+			responses.BadRequest(w, r, "Two-factor authentication has not been enrolled")
+			return
+		case errors.Is(err, auth.ErrTOTPEnabled):
+			responses.Conflict(w, r, "Two-factor authentication is already enabled")
+			return
+		case err != nil:
+			log.Println("Failed to confirm TOTP:\n\t", err)
+			responses.InternalServerError(w, r, "Failed to confirm two-factor authentication")
+			return
+		}
+		responses.StructOK(w, r, RecoveryCodes{codes})
+	}
+}
+
+// DisableTOTPHandler removes TOTP from the current user
+func DisableTOTPHandler(mfa auth.MFAService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := r.Context().Value(mw.SessionKey).(*auth.Session)
+		if !ok || session == nil {
+			responses.Unauthorized(w, r, "")
+			return
+		}
+
+		var code MFACode
+		err := responses.DecodeStruct(r, &code)
+		if err != nil {
+			responses.BadRequest(w, r, "Invalid request body")
+			return
+		}
+
+		err = mfa.DisableTOTP(session.UserID, code.Code)
+		switch {
+		case errors.Is(err, auth.ErrInvalidMFACode):
+			responses.BadRequest(w, r, "Invalid code")
+			return
+		case errors.Is(err, auth.ErrTOTPNotEnrolled):
+			responses.NotFound(w, r, "Two-factor authentication has not been enrolled")
+			return
+		case err != nil:
+			log.Println("Failed to disable TOTP:\n\t", err)
+			responses.InternalServerError(w, r, "Failed to disable two-factor authentication")
+			return
+		}
+		responses.NoContent(w, r)
+	}
+}
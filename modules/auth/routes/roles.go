@@ -0,0 +1,105 @@
+package authroutes
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/auth"
+	"github.com/NeuralNexusDev/neuralnexus-api/responses"
+)
+
+// Roles struct for listing roles
+type Roles struct {
+	Roles []*auth.Role `json:"roles" xml:"roles"`
+}
+
+// roleError sends the response for a role service error
+func roleError(w http.ResponseWriter, r *http.Request, err error, action string) {
+	switch {
+	case errors.Is(err, auth.ErrRoleNotFound):
+		responses.NotFound(w, r, "Role not found")
+	case errors.Is(err, auth.ErrRoleExists):
+		responses.Conflict(w, r, "Role already exists")
+	case errors.Is(err, auth.ErrRoleBuiltin):
+		responses.Forbidden(w, r, "Built-in roles cannot be changed")
+	case errors.Is(err, auth.ErrInvalidRole), errors.Is(err, auth.ErrRolePermission):
+		responses.BadRequest(w, r, err.Error())
+	default:
+		log.Println("Failed to "+action+":\n\t", err)
+		responses.InternalServerError(w, r, "Failed to "+action)
+	}
+}
+
+// GetRolesHandler - List every role
+func GetRolesHandler(roles auth.RoleService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		all, err := roles.GetRoles()
+		if err != nil {
+			roleError(w, r, err, "get roles")
+			return
+		}
+		responses.StructOK(w, r, Roles{all})
+	}
+}
+
+// GetRoleHandler - Get a role
+func GetRoleHandler(roles auth.RoleService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		role, err := roles.GetRole(r.PathValue("name"))
+		if err != nil {
+			roleError(w, r, err, "get role")
+			return
+		}
+		responses.StructOK(w, r, role)
+	}
+}
+
+// CreateRoleHandler - Create a role
+func CreateRoleHandler(roles auth.RoleService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var role auth.Role
+		err := responses.DecodeStruct(r, &role)
+		if err != nil {
+			responses.BadRequest(w, r, "Invalid request body")
+			return
+		}
+		err = roles.CreateRole(&role)
+		if err != nil {
+			roleError(w, r, err, "create role")
+			return
+		}
+		responses.SendStruct(w, r, http.StatusCreated, role)
+	}
+}
+
+// UpdateRoleHandler - Update a role's description and permissions
+func UpdateRoleHandler(roles auth.RoleService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var role auth.Role
+		err := responses.DecodeStruct(r, &role)
+		if err != nil {
+			responses.BadRequest(w, r, "Invalid request body")
+			return
+		}
+		role.Name = r.PathValue("name")
+		err = roles.UpdateRole(&role)
+		if err != nil {
+			roleError(w, r, err, "update role")
+			return
+		}
+		responses.StructOK(w, r, role)
+	}
+}
+
+// DeleteRoleHandler - Delete a role
+func DeleteRoleHandler(roles auth.RoleService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := roles.DeleteRole(r.PathValue("name"))
+		if err != nil {
+			roleError(w, r, err, "delete role")
+			return
+		}
+		responses.NoContent(w, r)
+	}
+}
@@ -0,0 +1,111 @@
+package authroutes
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	mw "github.com/NeuralNexusDev/neuralnexus-api/middleware"
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/auth"
+	"github.com/NeuralNexusDev/neuralnexus-api/responses"
+)
+
+// ServiceAccountRequest struct for creating a service account or changing its roles
+type ServiceAccountRequest struct {
+	Name  string   `json:"name,omitempty" xml:"name,omitempty"`
+	Roles []string `json:"roles" xml:"roles"`
+}
+
+// ServiceAccounts struct for listing service accounts
+type ServiceAccounts struct {
+	ServiceAccounts []*auth.ServiceAccount `json:"service_accounts" xml:"service_accounts"`
+}
+
+// serviceAccountError sends the response for a service account service error
+func serviceAccountError(w http.ResponseWriter, r *http.Request, err error, action string) {
+	switch {
+	case errors.Is(err, auth.ErrServiceAccountNotFound):
+		responses.NotFound(w, r, "Service account not found")
+	case errors.Is(err, auth.ErrServiceAccountNameRequired):
+		responses.BadRequest(w, r, err.Error())
+	case errors.Is(err, auth.ErrServiceAccountRole):
+		responses.Forbidden(w, r, "Service accounts can only be given roles whose permissions you already have")
+	default:
+		log.Println("Failed to "+action+":\n\t", err)
+		responses.InternalServerError(w, r, "Failed to "+action)
+	}
+}
+
+// GetServiceAccountsHandler - List every service account
+func GetServiceAccountsHandler(serviceAccounts auth.ServiceAccountService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		all, err := serviceAccounts.GetServiceAccounts()
+		if err != nil {
+			serviceAccountError(w, r, err, "get service accounts")
+			return
+		}
+		responses.StructOK(w, r, ServiceAccounts{all})
+	}
+}
+
+// GetServiceAccountHandler - Get a service account
+func GetServiceAccountHandler(serviceAccounts auth.ServiceAccountService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		account, err := serviceAccounts.GetServiceAccount(r.PathValue("client_id"))
+		if err != nil {
+			serviceAccountError(w, r, err, "get service account")
+			return
+		}
+		responses.StructOK(w, r, account)
+	}
+}
+
+// CreateServiceAccountHandler - Create a service account, the secret is only returned this once
+func CreateServiceAccountHandler(serviceAccounts auth.ServiceAccountService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, _ := r.Context().Value(mw.SessionKey).(*auth.Session)
+		var req ServiceAccountRequest
+		err := responses.DecodeStruct(r, &req)
+		if err != nil {
+			responses.BadRequest(w, r, "Invalid request body")
+			return
+		}
+		account, err := serviceAccounts.CreateServiceAccount(session, req.Name, req.Roles)
+		if err != nil {
+			serviceAccountError(w, r, err, "create service account")
+			return
+		}
+		responses.SendStruct(w, r, http.StatusCreated, account)
+	}
+}
+
+// UpdateServiceAccountHandler - Replace a service account's roles
+func UpdateServiceAccountHandler(serviceAccounts auth.ServiceAccountService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, _ := r.Context().Value(mw.SessionKey).(*auth.Session)
+		var req ServiceAccountRequest
+		err := responses.DecodeStruct(r, &req)
+		if err != nil {
+			responses.BadRequest(w, r, "Invalid request body")
+			return
+		}
+		account, err := serviceAccounts.UpdateServiceAccountRoles(session, r.PathValue("client_id"), req.Roles)
+		if err != nil {
+			serviceAccountError(w, r, err, "update service account")
+			return
+		}
+		responses.StructOK(w, r, account)
+	}
+}
+
+// DeleteServiceAccountHandler - Delete a service account and end its sessions
+func DeleteServiceAccountHandler(serviceAccounts auth.ServiceAccountService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := serviceAccounts.DeleteServiceAccount(r.PathValue("client_id"))
+		if err != nil {
+			serviceAccountError(w, r, err, "delete service account")
+			return
+		}
+		responses.NoContent(w, r)
+	}
+}
@@ -0,0 +1,61 @@
+package authroutes
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/auth"
+	"github.com/NeuralNexusDev/neuralnexus-api/responses"
+)
+
+// UserSessions struct for listing a user's sessions
+type UserSessions struct {
+	Sessions []*auth.Session `json:"sessions" xml:"sessions"`
+}
+
+// GetUserSessionsHandler - List a user's active sessions
+func GetUserSessionsHandler(ss auth.SessionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.PathValue("user_id")
+		sessions, err := ss.GetUserSessions(userID)
+		if err != nil {
+			log.Println("Failed to get sessions:\n\t", err)
+			responses.InternalServerError(w, r, "Failed to get sessions")
+			return
+		}
+		responses.StructOK(w, r, UserSessions{sessions})
+	}
+}
+
+// DeleteUserSessionHandler - Revoke one of a user's sessions
+func DeleteUserSessionHandler(ss auth.SessionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.PathValue("user_id")
+		target, err := ss.GetSession(r.PathValue("session_id"))
+		if err != nil || target.UserID != userID {
+			responses.NotFound(w, r, "Session not found")
+			return
+		}
+		err = ss.DeleteSession(target.ID)
+		if err != nil {
+			log.Println("Failed to delete session:\n\t", err)
+			responses.InternalServerError(w, r, "Failed to delete session")
+			return
+		}
+		responses.NoContent(w, r)
+	}
+}
+
+// DeleteUserSessionsHandler - Revoke all of a user's sessions, logging them out everywhere
+func DeleteUserSessionsHandler(ss auth.SessionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.PathValue("user_id")
+		err := ss.DeleteUserSessions(userID, "")
+		if err != nil {
+			log.Println("Failed to delete sessions:\n\t", err)
+			responses.InternalServerError(w, r, "Failed to delete sessions")
+			return
+		}
+		responses.NoContent(w, r)
+	}
+}
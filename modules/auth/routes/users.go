@@ -1,14 +1,21 @@
 package authroutes
 
 import (
-	"github.com/NeuralNexusDev/neuralnexus-api/modules/auth"
+	"errors"
+	"log"
 	"net/http"
 
 	mw "github.com/NeuralNexusDev/neuralnexus-api/middleware"
-	perms "github.com/NeuralNexusDev/neuralnexus-api/modules/auth/permissions"
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/auth"
 	"github.com/NeuralNexusDev/neuralnexus-api/responses"
+	"github.com/jackc/pgx/v5"
 )
 
+// LinkedAccounts struct for listing a user's linked accounts
+type LinkedAccounts struct {
+	LinkedAccounts []*auth.LinkedAccount `json:"linked_accounts" xml:"linked_accounts"`
+}
+
 // GetUserHandler - Get a user
 func GetUserHandler(service auth.UserService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -25,11 +32,6 @@ func GetUserHandler(service auth.UserService) http.HandlerFunc {
 // GetUserFromPlatformHandler - Get a user from a platform
 func GetUserFromPlatformHandler(service auth.UserService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		session := r.Context().Value(mw.SessionKey).(*auth.Session)
-		if !session.HasPermission(perms.ScopeAdminUsers) {
-			responses.Forbidden(w, r, "You do not have permission to get users")
-			return
-		}
 		platform := auth.Platform(r.PathValue("platform"))
 		platformID := r.PathValue("platform_id")
 		user, err := service.GetUserFromPlatform(platform, platformID)
@@ -44,12 +46,7 @@ func GetUserFromPlatformHandler(service auth.UserService) http.HandlerFunc {
 // GetUserPermissionsHandler - Get a user's permissions
 func GetUserPermissionsHandler(service auth.UserService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		session := r.Context().Value(mw.SessionKey).(*auth.Session)
 		userID := r.PathValue("user_id")
-		if session.UserID != userID && !session.HasPermission(perms.ScopeAdminUsers) {
-			responses.Forbidden(w, r, "You do not have permission to get user permissions")
-			return
-		}
 		permissions, err := service.GetUserPermissions(userID)
 		if err != nil {
 			responses.NotFound(w, r, "User not found")
@@ -62,11 +59,6 @@ func GetUserPermissionsHandler(service auth.UserService) http.HandlerFunc {
 // UpdateUserHandler - Update a user
 func UpdateUserHandler(service auth.UserService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		session := r.Context().Value(mw.SessionKey).(*auth.Session)
-		if !session.HasPermission(perms.ScopeAdminUsers) {
-			responses.Forbidden(w, r, "You do not have permission to update users")
-			return
-		}
 		userID := r.PathValue("user_id")
 		var user auth.Account
 		err := responses.DecodeStruct(r, &user)
@@ -87,11 +79,6 @@ func UpdateUserHandler(service auth.UserService) http.HandlerFunc {
 // UpdateUserFromPlatformHandler - Update a user from a platform
 func UpdateUserFromPlatformHandler(service auth.UserService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		session := r.Context().Value(mw.SessionKey).(*auth.Session)
-		if !session.HasPermission(perms.ScopeAdminUsers) {
-			responses.Forbidden(w, r, "You do not have permission to update users")
-			return
-		}
 		platform := auth.Platform(r.PathValue("platform"))
 		platformID := r.PathValue("platform_id")
 		var data auth.PlatformData
@@ -112,11 +99,6 @@ func UpdateUserFromPlatformHandler(service auth.UserService) http.HandlerFunc {
 // DeleteUserHandler - Delete a user
 func DeleteUserHandler(service auth.UserService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		session := r.Context().Value(mw.SessionKey).(*auth.Session)
-		if !session.HasPermission(perms.ScopeAdminUsers) {
-			responses.Forbidden(w, r, "You do not have permission to delete users")
-			return
-		}
 		userID := r.PathValue("user_id")
 		err := service.DeleteUser(userID)
 		if err != nil {
@@ -126,3 +108,120 @@ func DeleteUserHandler(service auth.UserService) http.HandlerFunc {
 		responses.NoContent(w, r)
 	}
 }
+
+// GetUserLinksHandler - Get the platform accounts linked to a user
+func GetUserLinksHandler(service auth.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		linked, err := service.GetLinkedAccounts(r.PathValue("user_id"))
+		if err != nil {
+			log.Println("Failed to get linked accounts:\n\t", err)
+			responses.InternalServerError(w, r, "Failed to get linked accounts")
+			return
+		}
+		if linked == nil {
+			linked = []*auth.LinkedAccount{}
+		}
+		responses.StructOK(w, r, LinkedAccounts{linked})
+	}
+}
+
+// DeleteUserLinkHandler - Unlink a platform account from a user
+func DeleteUserLinkHandler(service auth.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := service.UnlinkAccount(r.PathValue("user_id"), auth.Platform(r.PathValue("platform")))
+		switch {
+		case err == nil:
+			responses.NoContent(w, r)
+		case errors.Is(err, pgx.ErrNoRows):
+			responses.NotFound(w, r, "Linked account not found")
+		case errors.Is(err, auth.ErrLastLoginMethod):
+			responses.Conflict(w, r, "Add a password, passkey or another login platform before unlinking this account")
+		default:
+			log.Println("Failed to unlink account:\n\t", err)
+			responses.InternalServerError(w, r, "Failed to unlink account")
+		}
+	}
+}
+
+// MergeUserRequest struct
+type MergeUserRequest struct {
+	// Token - An access token for the account being merged, proving the caller can sign in to it too
+	Token string `json:"token" xml:"token" validate:"required"`
+}
+
+// MergeUserHandler - Merge another account the caller has signed in to into this one
+func MergeUserHandler(service auth.UserService, ss auth.SessionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, _ := mw.GetSession(r.Context())
+		if session.UserID != r.PathValue("user_id") {
+			responses.Forbidden(w, r, "Accounts can only be merged by their owner")
+			return
+		}
+
+		var req MergeUserRequest
+		err := responses.DecodeStruct(r, &req)
+		if err != nil || req.Token == "" {
+			responses.BadRequest(w, r, "Invalid request body")
+			return
+		}
+		other, err := ss.ReadJWT(req.Token)
+		if err != nil || other.ClientID != "" {
+			responses.Unauthorized(w, r, "Sign in to the account to merge first")
+			return
+		}
+
+		account, err := service.MergeUsers(session.UserID, other.UserID)
+		switch {
+		case err == nil:
+			responses.StructOK(w, r, account)
+		case errors.Is(err, auth.ErrMergeSameAccount):
+			responses.BadRequest(w, r, err.Error())
+		case errors.Is(err, auth.ErrMergePlatformConflict), errors.Is(err, auth.ErrAccountMerged):
+			responses.Conflict(w, r, err.Error())
+		default:
+			log.Println("Failed to merge accounts:\n\t", err)
+			responses.InternalServerError(w, r, "Failed to merge accounts")
+		}
+	}
+}
+
+// AuthEvents struct for listing a user's auth events
+type AuthEvents struct {
+	AuthEvents []*auth.AuthEvent `json:"auth_events" xml:"auth_events"`
+}
+
+// authEventsLimit - How many of a user's most recent auth events are listed
+const authEventsLimit = 100
+
+// GetUserAuthEventsHandler - Get a user's most recent logins and lockouts
+func GetUserAuthEventsHandler(lockout auth.LockoutService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		events, err := lockout.GetAuthEvents(r.PathValue("user_id"), authEventsLimit)
+		if err != nil {
+			log.Println("Failed to get auth events:\n\t", err)
+			responses.InternalServerError(w, r, "Failed to get auth events")
+			return
+		}
+		if events == nil {
+			events = []*auth.AuthEvent{}
+		}
+		responses.StructOK(w, r, AuthEvents{events})
+	}
+}
+
+// UnlockUserHandler - Clear a user's login lockout and failed logins
+func UnlockUserHandler(lockout auth.LockoutService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, _ := mw.GetSession(r.Context())
+		err := lockout.Unlock(session, r.PathValue("user_id"))
+		switch {
+		case err == nil:
+			responses.NoContent(w, r)
+		case errors.Is(err, auth.ErrAccountNotFound):
+			responses.NotFound(w, r, "User not found")
+		default:
+			log.Println("Failed to unlock user:\n\t", err)
+			responses.InternalServerError(w, r, "Failed to unlock user")
+		}
+	}
+}
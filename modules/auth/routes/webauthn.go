@@ -0,0 +1,178 @@
+package authroutes
+
+import (
+	"errors"
+	"github.com/goccy/go-json"
+	"github.com/jackc/pgx/v5"
+	"log"
+	"net/http"
+
+	mw "github.com/NeuralNexusDev/neuralnexus-api/middleware"
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/auth"
+	"github.com/NeuralNexusDev/neuralnexus-api/responses"
+)
+
+// WebAuthnRegistration struct for finishing passkey registration
+type WebAuthnRegistration struct {
+	ChallengeID string          `json:"challenge_id" validate:"required"`
+	Name        string          `json:"name"`
+	Credential  json.RawMessage `json:"credential" validate:"required"`
+}
+
+// WebAuthnLogin struct for finishing a passkey login
+type WebAuthnLogin struct {
+	ChallengeID string          `json:"challenge_id" validate:"required"`
+	Credential  json.RawMessage `json:"credential" validate:"required"`
+}
+
+// WebAuthnCredentials struct for listing passkeys
+type WebAuthnCredentials struct {
+	Credentials []*auth.WebAuthnCredential `json:"credentials" xml:"credentials"`
+}
+
+// BeginWebAuthnRegistrationHandler starts registering a passkey for the current user
+func BeginWebAuthnRegistrationHandler(as auth.AccountService, wa auth.WebAuthnService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := r.Context().Value(mw.SessionKey).(*auth.Session)
+		if !ok || session == nil {
+			responses.Unauthorized(w, r, "")
+			return
+		}
+
+		account, err := as.GetAccountByID(session.UserID)
+		if err != nil {
+			responses.NotFound(w, r, "User not found")
+			return
+		}
+
+		challenge, err := wa.BeginRegistration(account)
+		if err != nil {
+			log.Println("Failed to begin WebAuthn registration:\n\t", err)
+			responses.InternalServerError(w, r, "Failed to begin passkey registration")
+			return
+		}
+		responses.StructOK(w, r, challenge)
+	}
+}
+
+// FinishWebAuthnRegistrationHandler stores the passkey once the browser has created it
+func FinishWebAuthnRegistrationHandler(as auth.AccountService, wa auth.WebAuthnService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := r.Context().Value(mw.SessionKey).(*auth.Session)
+		if !ok || session == nil {
+			responses.Unauthorized(w, r, "")
+			return
+		}
+
+		var reg WebAuthnRegistration
+		err := json.NewDecoder(r.Body).Decode(&reg)
+		if err != nil || reg.ChallengeID == "" || len(reg.Credential) == 0 {
+			responses.BadRequest(w, r, "Invalid request body")
+			return
+		}
+
+		account, err := as.GetAccountByID(session.UserID)
+		if err != nil {
+			responses.NotFound(w, r, "User not found")
+			return
+		}
+
+		cred, err := wa.FinishRegistration(account, reg.ChallengeID, reg.Name, reg.Credential)
+		switch {
+		case errors.Is(err, auth.ErrWebAuthnChallenge), errors.Is(err, auth.ErrWebAuthnCredential):
+			responses.BadRequest(w, r, "Invalid or expired passkey registration")
+			return
+		case errors.Is(err, auth.ErrWebAuthnCredentialUsed):
+			responses.Conflict(w, r, "Passkey is already registered")
+			return
+		case err != nil:
+			log.Println("Failed to finish WebAuthn registration:\n\t", err)
+			responses.InternalServerError(w, r, "Failed to register passkey")
+			return
+		}
+		responses.SendStruct(w, r, http.StatusCreated, cred)
+	}
+}
+
+// GetWebAuthnCredentialsHandler lists the current user's passkeys
+func GetWebAuthnCredentialsHandler(wa auth.WebAuthnService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := r.Context().Value(mw.SessionKey).(*auth.Session)
+		if !ok || session == nil {
+			responses.Unauthorized(w, r, "")
+			return
+		}
+
+		creds, err := wa.GetCredentials(session.UserID)
+		if err != nil {
+			log.Println("Failed to get WebAuthn credentials:\n\t", err)
+			responses.InternalServerError(w, r, "Failed to get passkeys")
+			return
+		}
+		responses.StructOK(w, r, WebAuthnCredentials{creds})
+	}
+}
+
+// DeleteWebAuthnCredentialHandler removes one of the current user's passkeys
+func DeleteWebAuthnCredentialHandler(wa auth.WebAuthnService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := r.Context().Value(mw.SessionKey).(*auth.Session)
+		if !ok || session == nil {
+			responses.Unauthorized(w, r, "")
+			return
+		}
+
+		err := wa.DeleteCredential(session.UserID, r.PathValue("credential_id"))
+		if errors.Is(err, pgx.ErrNoRows) {
+			responses.NotFound(w, r, "Passkey not found")
+			return
+		} else if err != nil {
+			log.Println("Failed to delete WebAuthn credential:\n\t", err)
+			responses.InternalServerError(w, r, "Failed to delete passkey")
+			return
+		}
+		responses.NoContent(w, r)
+	}
+}
+
+// BeginWebAuthnLoginHandler starts a passkey login
+func BeginWebAuthnLoginHandler(wa auth.WebAuthnService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		challenge, err := wa.BeginLogin()
+		if err != nil {
+			log.Println("Failed to begin WebAuthn login:\n\t", err)
+			responses.InternalServerError(w, r, "Failed to begin passkey login")
+			return
+		}
+		responses.StructOK(w, r, challenge)
+	}
+}
+
+// FinishWebAuthnLoginHandler checks the passkey assertion and issues a session
+func FinishWebAuthnLoginHandler(ss auth.SessionService, wa auth.WebAuthnService, lockout auth.LockoutService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var login WebAuthnLogin
+		err := json.NewDecoder(r.Body).Decode(&login)
+		if err != nil || login.ChallengeID == "" || len(login.Credential) == 0 {
+			responses.BadRequest(w, r, "Invalid request body")
+			return
+		}
+
+		account, err := wa.FinishLogin(login.ChallengeID, login.Credential)
+		if errors.Is(err, auth.ErrWebAuthnChallenge) || errors.Is(err, auth.ErrWebAuthnCredential) {
+			responses.BadRequest(w, r, "Invalid passkey")
+			return
+		} else if err != nil {
+			log.Println("Failed to finish WebAuthn login:\n\t", err)
+			responses.InternalServerError(w, r, "Authentication failed")
+			return
+		}
+
+		attempt := &auth.LoginAttempt{UserAgent: r.UserAgent(), RemoteAddr: mw.RemoteAddr(r.Context())}
+		err = lockout.LoginSucceeded(account, attempt, "passkey")
+		if err != nil {
+			log.Println("Failed to record login:\n\t", err)
+		}
+		IssueSession(w, r, ss, account)
+	}
+}
@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	perms "github.com/NeuralNexusDev/neuralnexus-api/modules/auth/permissions"
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/database"
+	"github.com/jackc/pgx/v5"
+)
+
+// ServiceAccountSessionTTL - How long a service account session lasts, service accounts sign in again with their secret
+var ServiceAccountSessionTTL = 15 * time.Minute
+
+var (
+	ErrServiceAccountNotFound     = errors.New("service account not found")
+	ErrServiceAccountNameRequired = errors.New("service account name is required")
+	ErrServiceAccountRole         = errors.New("service accounts can only be given roles whose permissions you already have")
+	ErrServiceAccountScope        = errors.New("the service account was not given this scope")
+	ErrInvalidServiceAccount      = errors.New("invalid service account credentials")
+)
+
+// -------------- Structs --------------
+
+// ServiceAccount struct, a non-human principal that signs in with the client credentials grant
+// It has no account row, its roles are the only thing deciding what its sessions can do
+type ServiceAccount struct {
+	ClientID   string    `json:"client_id" xml:"client_id" db:"client_id"`
+	Name       string    `json:"name" xml:"name" db:"name"`
+	SecretHash string    `json:"-" xml:"-" db:"secret_hash"`
+	Roles      []string  `json:"roles" xml:"roles" db:"roles"`
+	CreatedBy  string    `json:"created_by" xml:"created_by" db:"created_by"`
+	LastUsedAt int64     `json:"lua" xml:"lua" db:"last_used_at"`
+	CreatedAt  time.Time `json:"created_at" xml:"created_at" db:"created_at"`
+}
+
+// Permissions resolves the service account's roles into permissions
+func (a *ServiceAccount) Permissions() []string {
+	return rolePermissions(a.Roles)
+}
+
+// NewServiceAccount struct returned once when a service account is created, it is the only time the secret can be seen
+type NewServiceAccount struct {
+	*ServiceAccount
+	ClientSecret string `json:"client_secret" xml:"client_secret"`
+}
+
+// -------------- Service --------------
+
+// ServiceAccountService - Service account service interface
+type ServiceAccountService interface {
+	CreateServiceAccount(session *Session, name string, roles []string) (*NewServiceAccount, error)
+	GetServiceAccounts() ([]*ServiceAccount, error)
+	GetServiceAccount(clientID string) (*ServiceAccount, error)
+	UpdateServiceAccountRoles(session *Session, clientID string, roles []string) (*ServiceAccount, error)
+	DeleteServiceAccount(clientID string) error
+	NewServiceAccountSession(clientID string, secret string, scopes []string, userAgent string, remoteAddr string) (*Session, error)
+}
+
+// serviceAccountService - ServiceAccountService implementation
+type serviceAccountService struct {
+	store ServiceAccountStore
+	ss    SessionStore
+}
+
+// NewServiceAccountService - Create a new service account service
+func NewServiceAccountService(store Store) ServiceAccountService {
+	return &serviceAccountService{
+		store: store.ServiceAccount(),
+		ss:    store.Session(),
+	}
+}
+
+// checkRoles makes sure every role exists and that the admin holds all of its permissions,
+// so nobody can create a service account more powerful than themselves
+func checkRoles(session *Session, roles []string) ([]string, error) {
+	checked := []string{}
+	for _, name := range roles {
+		role, err := perms.GetRoleByName(name)
+		if err != nil {
+			return nil, ErrServiceAccountRole
+		}
+		for _, p := range role.Permissions {
+			if !perms.HasPermission(session.Permissions, p.String()) {
+				return nil, ErrServiceAccountRole
+			}
+		}
+		checked = append(checked, role.Name)
+	}
+	slices.Sort(checked)
+	return slices.Compact(checked), nil
+}
+
+// CreateServiceAccount creates a service account with the given roles
+func (s *serviceAccountService) CreateServiceAccount(session *Session, name string, roles []string) (*NewServiceAccount, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrServiceAccountNameRequired
+	}
+	roles, err := checkRoles(session, roles)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := database.GenSnowflake()
+	if err != nil {
+		return nil, err
+	}
+	secret, err := GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+	account := &ServiceAccount{
+		ClientID:   id,
+		Name:       name,
+		SecretHash: HashToken(secret),
+		Roles:      roles,
+		CreatedBy:  session.UserID,
+		CreatedAt:  time.Now(),
+	}
+	err = s.store.AddServiceAccountToDB(account)
+	if err != nil {
+		return nil, err
+	}
+	return &NewServiceAccount{account, secret}, nil
+}
+
+// GetServiceAccounts lists every service account
+func (s *serviceAccountService) GetServiceAccounts() ([]*ServiceAccount, error) {
+	return s.store.GetServiceAccountsFromDB()
+}
+
+// GetServiceAccount gets a service account by client ID
+func (s *serviceAccountService) GetServiceAccount(clientID string) (*ServiceAccount, error) {
+	account, err := s.store.GetServiceAccountFromDB(clientID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrServiceAccountNotFound
+	}
+	return account, err
+}
+
+// UpdateServiceAccountRoles replaces a service account's roles, sessions it already has keep their permissions until they expire
+func (s *serviceAccountService) UpdateServiceAccountRoles(session *Session, clientID string, roles []string) (*ServiceAccount, error) {
+	roles, err := checkRoles(session, roles)
+	if err != nil {
+		return nil, err
+	}
+	err = s.store.UpdateServiceAccountRolesInDB(clientID, roles)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrServiceAccountNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return s.GetServiceAccount(clientID)
+}
+
+// DeleteServiceAccount deletes a service account and ends its sessions
+func (s *serviceAccountService) DeleteServiceAccount(clientID string) error {
+	err := s.store.DeleteServiceAccountFromDB(clientID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrServiceAccountNotFound
+	} else if err != nil {
+		return err
+	}
+
+	ids, err := s.store.PopServiceAccountSessions(clientID)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		s.ss.DeleteSessionFromCache(id)
+	}
+	return nil
+}
+
+// NewServiceAccountSession checks a service account's secret and starts a short-lived session for it
+// The session gets the requested scopes, or everything the service account's roles grant if none were asked for.
+// Service accounts have no account row, so their sessions are only kept in the cache
+func (s *serviceAccountService) NewServiceAccountSession(clientID string, secret string, scopes []string, userAgent string, remoteAddr string) (*Session, error) {
+	account, err := s.store.GetServiceAccountFromDB(clientID)
+	if err != nil {
+		return nil, ErrInvalidServiceAccount
+	}
+	if subtle.ConstantTimeCompare([]byte(HashToken(secret)), []byte(account.SecretHash)) != 1 {
+		return nil, ErrInvalidServiceAccount
+	}
+
+	held := account.Permissions()
+	permissions := held
+	if len(scopes) > 0 {
+		permissions = []string{}
+		for _, p := range scopes {
+			if !perms.HasPermission(held, p) {
+				return nil, ErrServiceAccountScope
+			}
+			p, _ = perms.Normalize(p)
+			if !slices.Contains(permissions, p) {
+				permissions = append(permissions, p)
+			}
+		}
+	}
+	if permissions == nil {
+		permissions = []string{}
+	}
+
+	id, err := database.GenSnowflake()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	session := &Session{
+		ID:          id,
+		UserID:      account.ClientID,
+		Permissions: permissions,
+		IssuedAt:    now.Unix(),
+		LastUsedAt:  now.Unix(),
+		ExpiresAt:   now.Add(ServiceAccountSessionTTL).Unix(),
+		ClientID:    account.ClientID,
+		Machine:     true,
+	}
+	session.SetClient(userAgent, remoteAddr)
+	err = s.ss.AddSessionToCache(session)
+	if err != nil {
+		return nil, err
+	}
+	err = s.store.AddServiceAccountSession(account.ClientID, session.ID, ServiceAccountSessionTTL)
+	if err != nil {
+		return nil, err
+	}
+	err = s.store.UpdateServiceAccountLastUsed(account.ClientID, now.Unix())
+	if err != nil {
+		log.Println("Failed to update service account last used:\n\t", err)
+	}
+	return session, nil
+}
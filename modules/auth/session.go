@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
+	"log"
+	"net"
 	"os"
 	"time"
 
@@ -28,6 +30,11 @@ type Session struct {
 	IssuedAt    int64    `json:"iat" xml:"iat" db:"iat"`
 	LastUsedAt  int64    `json:"lua" xml:"lua" db:"lua"`
 	ExpiresAt   int64    `json:"exp" xml:"exp" db:"exp"`
+	UserAgent   string   `json:"user_agent" xml:"user_agent" db:"user_agent"`
+	IPAddress   string   `json:"ip_address" xml:"ip_address" db:"ip_address"`
+	ClientID    string   `json:"client_id,omitempty" xml:"client_id,omitempty" db:"client_id"`
+	// Machine marks a service account session, which only lives in the cache
+	Machine bool `json:"machine,omitempty" xml:"machine,omitempty" db:"-"`
 }
 
 // ToProto converts a session to a protobuf message
@@ -42,14 +49,18 @@ func (s *Session) ToProto() proto.Message {
 	}
 }
 
+// SetClient records the client a session was created from
+func (s *Session) SetClient(userAgent, remoteAddr string) {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		remoteAddr = host
+	}
+	s.UserAgent = userAgent
+	s.IPAddress = remoteAddr
+}
+
 // HasPermission checks if a session has a permission
 func (s *Session) HasPermission(permission perms.Scope) bool {
-	for _, p := range s.Permissions {
-		if p == permission.Name+"|"+permission.Value {
-			return true
-		}
-	}
-	return false
+	return perms.HasScope(s.Permissions, permission)
 }
 
 // IsValid checks if a session is expired
@@ -66,21 +77,33 @@ func (s *Session) IsValid() bool {
 type SessionService interface {
 	AddSession(session *Session) error
 	GetSession(id string) (*Session, error)
+	GetUserSessions(userID string) ([]*Session, error)
 	UpdateSession(session *Session) error
 	DeleteSession(id string) error
+	DeleteUserSessions(userID string, exceptID string) error
 	CreateJWT(*Session) (string, error)
 	ReadJWT(token string) (*Session, error)
+	ParseJWT(token string) (*SessionClaims, error)
+	CreateRefreshToken(session *Session) (string, error)
+	RefreshSession(refreshToken string) (*Session, string, error)
+	GetRefreshTokenSession(refreshToken string) (*Session, error)
 }
 
 // sessionService - SessionService implementation
 type sessionService struct {
-	store SessionStore
+	store    SessionStore
+	refresh  RefreshTokenStore
+	accounts AccountStore
+	keys     SigningKeyService
 }
 
 // NewSessionService - Create a new session userService
-func NewSessionService(store Store) SessionService {
+func NewSessionService(store Store, keys SigningKeyService) SessionService {
 	return &sessionService{
-		store: store.Session(),
+		store:    store.Session(),
+		refresh:  store.RefreshToken(),
+		accounts: store.Account(),
+		keys:     keys,
 	}
 }
 
@@ -107,6 +130,11 @@ func (s *sessionService) GetSession(id string) (*Session, error) {
 	return session, nil
 }
 
+// GetUserSessions gets every active session belonging to a user
+func (s *sessionService) GetUserSessions(userID string) ([]*Session, error) {
+	return s.store.GetUserSessionsFromDB(userID)
+}
+
 // UpdateSession updates a session
 func (s *sessionService) UpdateSession(session *Session) error {
 	err := s.store.UpdateSessionInDB(session)
@@ -127,68 +155,128 @@ func (s *sessionService) DeleteSession(id string) error {
 	return nil
 }
 
+// DeleteUserSessions deletes every session belonging to a user, except for exceptID if it is set
+func (s *sessionService) DeleteUserSessions(userID string, exceptID string) error {
+	ids, err := s.store.DeleteUserSessionsInDB(userID, exceptID)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		s.store.DeleteSessionFromCache(id)
+	}
+	return nil
+}
+
 // SessionClaims custom JWT claims for session
 type SessionClaims struct {
 	Scope []string `json:"scope"`
 	jwt.RegisteredClaims
 }
 
-// CreateJWT creates a JWT for a session
+// CreateJWT creates a short-lived JWT for a session, it never outlives the session itself
+// Tokens are signed with the active EdDSA key, falling back to HS256 only when no key is available and legacy tokens are enabled
 func (s *sessionService) CreateJWT(session *Session) (string, error) {
-	return jwt.NewWithClaims(jwt.SigningMethodHS256, SessionClaims{
+	now := time.Now()
+	expiresAt := now.Add(AccessTokenTTL)
+	if session.ExpiresAt != 0 && session.ExpiresAt < expiresAt.Unix() {
+		expiresAt = time.Unix(session.ExpiresAt, 0)
+	}
+	claims := SessionClaims{
 		session.Permissions,
 		jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Unix(session.ExpiresAt, 0)),
-			IssuedAt:  jwt.NewNumericDate(time.Unix(session.IssuedAt, 0)),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
 			Issuer:    NN_API_URL,
 			Subject:   session.UserID,
 			Audience:  validAudiences,
 			ID:        session.ID,
 		},
-	}).SignedString(JWT_SECRET)
+	}
+
+	key, priv, err := s.keys.SigningKey()
+	if err != nil {
+		if !JWT_LEGACY_HS256 {
+			return "", err
+		}
+		log.Println("Failed to get signing key, falling back to HS256:\n\t", err)
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(JWT_SECRET)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = key.KID
+	return token.SignedString(priv)
 }
 
-// ReadJWT reads a JWT and returns the session
-func (s *sessionService) ReadJWT(tokenStr string) (*Session, error) {
-	token, err := jwt.ParseWithClaims(tokenStr, &SessionClaims{}, func(token *jwt.Token) (interface{}, error) {
+// verificationKey picks the key a token should be checked against from its header
+func (s *sessionService) verificationKey(token *jwt.Token) (interface{}, error) {
+	switch token.Method.Alg() {
+	case jwt.SigningMethodEdDSA.Alg():
+		kid, ok := token.Header["kid"].(string)
+		if !ok {
+			return nil, errors.New("missing kid")
+		}
+		return s.keys.VerificationKey(kid)
+	case jwt.SigningMethodHS256.Alg():
+		if !JWT_LEGACY_HS256 {
+			return nil, errors.New("legacy tokens are disabled")
+		}
 		return JWT_SECRET, nil
-	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	default:
+		return nil, errors.New("unexpected signing method")
+	}
+}
+
+// ParseJWT verifies a JWT's signature, expiry and audience without checking that its session still exists
+func (s *sessionService) ParseJWT(tokenStr string) (*SessionClaims, error) {
+	methods := []string{jwt.SigningMethodEdDSA.Alg()}
+	if JWT_LEGACY_HS256 {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	token, err := jwt.ParseWithClaims(tokenStr, &SessionClaims{}, s.verificationKey, jwt.WithValidMethods(methods))
 	if err != nil {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*SessionClaims); ok {
-		// Validate audience
-		for _, aud := range claims.Audience {
-			valid := false
-			for _, validAud := range validAudiences {
-				if aud == validAud {
-					valid = true
-					break
-				}
-			}
-			if !valid {
-				return nil, fmt.Errorf("invalid audience: %s", aud)
+	claims, ok := token.Claims.(*SessionClaims)
+	if !ok {
+		return nil, errors.New("invalid token claims")
+	}
+	// Validate audience
+	for _, aud := range claims.Audience {
+		valid := false
+		for _, validAud := range validAudiences {
+			if aud == validAud {
+				valid = true
+				break
 			}
 		}
-
-		// Populate session
-		session := &Session{
-			ID:          claims.ID,
-			UserID:      claims.Subject,
-			Permissions: claims.Scope,
-			IssuedAt:    claims.IssuedAt.Unix(),
-			LastUsedAt:  time.Now().Unix(),
-			ExpiresAt:   claims.ExpiresAt.Unix(),
+		if !valid {
+			return nil, fmt.Errorf("invalid audience: %s", aud)
 		}
+	}
+	return claims, nil
+}
 
-		err = s.UpdateSession(session)
-		if err != nil {
-			return nil, err
-		}
+// ReadJWT reads a JWT and returns the session
+func (s *sessionService) ReadJWT(tokenStr string) (*Session, error) {
+	claims, err := s.ParseJWT(tokenStr)
+	if err != nil {
+		return nil, err
+	}
 
-		return session, nil
-	} else {
-		return nil, errors.New("invalid token claims")
+	// The session must still exist, otherwise it has been revoked
+	session, err := s.GetSession(claims.ID)
+	if err != nil {
+		return nil, errors.New("session not found")
+	}
+	if session.UserID != claims.Subject {
+		return nil, errors.New("session does not match token subject")
 	}
+	session.LastUsedAt = time.Now().Unix()
+
+	err = s.UpdateSession(session)
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
 }
@@ -0,0 +1,293 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/encryption"
+)
+
+// -------------- Globals --------------
+
+//goland:noinspection GoSnakeCaseUsage
+var (
+	// JWT_KEY_ENCRYPTION_KEY AES key used to encrypt signing keys at rest, must be 16, 24 or 32 bytes
+	JWT_KEY_ENCRYPTION_KEY = os.Getenv("JWT_KEY_ENCRYPTION_KEY")
+	// JWT_KEY_ROTATION_INTERVAL how long a signing key is used before a new one replaces it
+	JWT_KEY_ROTATION_INTERVAL = durationEnv("JWT_KEY_ROTATION_INTERVAL", 30*24*time.Hour)
+	// JWT_KEY_GRACE_PERIOD how long a replaced key is still accepted and published, must outlive AccessTokenTTL
+	JWT_KEY_GRACE_PERIOD = durationEnv("JWT_KEY_GRACE_PERIOD", 24*time.Hour)
+	// JWT_LEGACY_HS256 whether tokens signed with JWT_SECRET are still accepted, defaults to on when JWT_SECRET is set
+	JWT_LEGACY_HS256 = os.Getenv("JWT_LEGACY_HS256") != "false" && len(JWT_SECRET) > 0
+)
+
+const (
+	SigningAlgorithmEdDSA = "EdDSA"
+)
+
+// signingKeyRefresh - How often other instances' rotations are picked up
+var signingKeyRefresh = time.Minute
+
+var ErrNoSigningKey = errors.New("no signing key available")
+
+// durationEnv reads a duration from the environment, falling back to the default if it is unset or invalid
+func durationEnv(name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("Invalid duration for %s, using %s:\n\t%v", name, def, err)
+		return def
+	}
+	return d
+}
+
+// -------------- Structs --------------
+
+// SigningKey struct, the private key is encrypted in the database and decrypted when loaded
+type SigningKey struct {
+	KID        string `db:"kid"`
+	Algorithm  string `db:"algorithm"`
+	PublicKey  []byte `db:"public_key"`
+	PrivateKey []byte `db:"private_key"`
+	CreatedAt  int64  `db:"created_at"`
+	RetiredAt  int64  `db:"retired_at"`
+	ExpiresAt  int64  `db:"expires_at"`
+}
+
+// IsActive checks if a key can still be used for signing
+func (k *SigningKey) IsActive() bool {
+	return k.RetiredAt == 0
+}
+
+// JWK struct, a public key in JSON Web Key format
+type JWK struct {
+	KTY string `json:"kty"`
+	CRV string `json:"crv"`
+	X   string `json:"x"`
+	KID string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+}
+
+// JWKS struct, the set of keys published at /.well-known/jwks.json
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// -------------- Service --------------
+
+// SigningKeyService - JWT signing key service interface
+type SigningKeyService interface {
+	SigningKey() (*SigningKey, ed25519.PrivateKey, error)
+	VerificationKey(kid string) (ed25519.PublicKey, error)
+	JWKS() (*JWKS, error)
+	RotateKeys(force bool) error
+	StartKeyRotation()
+}
+
+// signingKeyService - SigningKeyService implementation
+type signingKeyService struct {
+	store    SigningKeyStore
+	mu       sync.RWMutex
+	keys     []*SigningKey
+	active   ed25519.PrivateKey
+	loadedAt time.Time
+}
+
+// NewSigningKeyService - Create a new signing key service
+func NewSigningKeyService(store Store) SigningKeyService {
+	return &signingKeyService{
+		store: store.SigningKey(),
+	}
+}
+
+// load reads the current keys from the database and decrypts the active one
+func (s *signingKeyService) load() error {
+	keys, err := s.store.GetSigningKeys(time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	var active ed25519.PrivateKey
+	for _, k := range keys {
+		if k.IsActive() {
+			priv, err := encryption.DecryptAES(k.PrivateKey, JWT_KEY_ENCRYPTION_KEY)
+			if err != nil {
+				return err
+			}
+			active = priv
+			break
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+	s.active = active
+	s.loadedAt = time.Now()
+	return nil
+}
+
+// ensureLoaded reloads the keys when the cache is stale
+func (s *signingKeyService) ensureLoaded() error {
+	s.mu.RLock()
+	stale := time.Since(s.loadedAt) > signingKeyRefresh
+	s.mu.RUnlock()
+	if !stale {
+		return nil
+	}
+	return s.load()
+}
+
+// SigningKey gets the key new tokens are signed with, creating one if none exists yet
+func (s *signingKeyService) SigningKey() (*SigningKey, ed25519.PrivateKey, error) {
+	err := s.ensureLoaded()
+	if err != nil {
+		return nil, nil, err
+	}
+	key, priv := s.activeKey()
+	if key == nil {
+		err = s.RotateKeys(false)
+		if err != nil {
+			return nil, nil, err
+		}
+		key, priv = s.activeKey()
+		if key == nil {
+			return nil, nil, ErrNoSigningKey
+		}
+	}
+	return key, priv, nil
+}
+
+// activeKey gets the cached active key
+func (s *signingKeyService) activeKey() (*SigningKey, ed25519.PrivateKey) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, k := range s.keys {
+		if k.IsActive() && s.active != nil {
+			return k, s.active
+		}
+	}
+	return nil, nil
+}
+
+// VerificationKey gets the public key for a kid, reloading once if it isn't known yet
+func (s *signingKeyService) VerificationKey(kid string) (ed25519.PublicKey, error) {
+	err := s.ensureLoaded()
+	if err != nil {
+		return nil, err
+	}
+	if key := s.findKey(kid); key != nil {
+		return key, nil
+	}
+	// The key may have just been created by another instance
+	err = s.load()
+	if err != nil {
+		return nil, err
+	}
+	if key := s.findKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, errors.New("unknown signing key")
+}
+
+// findKey looks up a cached public key that is still within its grace window
+func (s *signingKeyService) findKey(kid string) ed25519.PublicKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	now := time.Now().Unix()
+	for _, k := range s.keys {
+		if k.KID == kid && (k.ExpiresAt == 0 || now < k.ExpiresAt) {
+			return k.PublicKey
+		}
+	}
+	return nil
+}
+
+// JWKS gets the public keys that tokens may currently be signed with
+func (s *signingKeyService) JWKS() (*JWKS, error) {
+	err := s.ensureLoaded()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	jwks := &JWKS{Keys: []JWK{}}
+	now := time.Now().Unix()
+	for _, k := range s.keys {
+		if k.ExpiresAt != 0 && now >= k.ExpiresAt {
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, JWK{
+			KTY: "OKP",
+			CRV: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(k.PublicKey),
+			KID: k.KID,
+			Use: "sig",
+			Alg: k.Algorithm,
+		})
+	}
+	return jwks, nil
+}
+
+// RotateKeys replaces the active key once it is older than the rotation interval, or straight away when forced
+// Replaced keys keep verifying for the grace period so tokens already handed out stay valid
+func (s *signingKeyService) RotateKeys(force bool) error {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	encrypted, err := encryption.EncryptAES(priv, JWT_KEY_ENCRYPTION_KEY)
+	if err != nil {
+		return err
+	}
+	kid := make([]byte, 8)
+	_, err = rand.Read(kid)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	rotateBefore := now.Add(-JWT_KEY_ROTATION_INTERVAL).Unix()
+	if force {
+		rotateBefore = now.Unix() + 1
+	}
+	rotated, err := s.store.RotateSigningKey(&SigningKey{
+		KID:        hex.EncodeToString(kid),
+		Algorithm:  SigningAlgorithmEdDSA,
+		PublicKey:  pub,
+		PrivateKey: encrypted,
+		CreatedAt:  now.Unix(),
+	}, rotateBefore, now.Add(JWT_KEY_GRACE_PERIOD).Unix())
+	if err != nil {
+		return err
+	}
+	if rotated {
+		log.Println("Rotated JWT signing key")
+	}
+	return s.load()
+}
+
+// StartKeyRotation checks whether the signing key is due to be rotated every hour
+func (s *signingKeyService) StartKeyRotation() {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			err := s.RotateKeys(false)
+			if err != nil {
+				log.Println("Failed to rotate JWT signing key:\n\t", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
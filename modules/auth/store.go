@@ -3,8 +3,10 @@ package auth
 import (
 	"context"
 	"errors"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/goccy/go-json"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
 	"golang.org/x/oauth2"
@@ -19,6 +21,18 @@ type Store interface {
 	LinkAccount() LinkAccountStore
 	RateLimit() RateLimitStore
 	OAuthToken() OAuthTokenStore
+	OneTimeToken() OneTimeTokenStore
+	TOTP() TOTPStore
+	WebAuthn() WebAuthnStore
+	RefreshToken() RefreshTokenStore
+	APIKey() APIKeyStore
+	SigningKey() SigningKeyStore
+	Role() RoleStore
+	LinkCode() LinkCodeStore
+	ServiceAccount() ServiceAccountStore
+	OAuthTokenKey() OAuthTokenKeyStore
+	Lockout() LockoutStore
+	AuthEvent() AuthEventStore
 }
 
 // store - primary store for auth
@@ -60,6 +74,66 @@ func (s *store) OAuthToken() OAuthTokenStore {
 	return OAuthTokenStore(s)
 }
 
+// OneTimeToken gets the one-time token store
+func (s *store) OneTimeToken() OneTimeTokenStore {
+	return OneTimeTokenStore(s)
+}
+
+// TOTP gets the TOTP store
+func (s *store) TOTP() TOTPStore {
+	return TOTPStore(s)
+}
+
+// WebAuthn gets the WebAuthn store
+func (s *store) WebAuthn() WebAuthnStore {
+	return WebAuthnStore(s)
+}
+
+// RefreshToken gets the refresh token store
+func (s *store) RefreshToken() RefreshTokenStore {
+	return RefreshTokenStore(s)
+}
+
+// APIKey gets the API key store
+func (s *store) APIKey() APIKeyStore {
+	return APIKeyStore(s)
+}
+
+// SigningKey gets the JWT signing key store
+func (s *store) SigningKey() SigningKeyStore {
+	return SigningKeyStore(s)
+}
+
+// Role gets the role store
+func (s *store) Role() RoleStore {
+	return RoleStore(s)
+}
+
+// LinkCode gets the link code store
+func (s *store) LinkCode() LinkCodeStore {
+	return LinkCodeStore(s)
+}
+
+// ServiceAccount gets the service account store
+func (s *store) ServiceAccount() ServiceAccountStore {
+	return ServiceAccountStore(s)
+}
+
+// OAuthTokenKey gets the store that moves OAuth tokens between encryption keys
+func (s *store) OAuthTokenKey() OAuthTokenKeyStore {
+	return OAuthTokenKeyStore(s)
+}
+
+// Lockout gets the login lockout store
+func (s *store) Lockout() LockoutStore {
+	return LockoutStore(s)
+}
+
+// AuthEvent gets the auth event store
+func (s *store) AuthEvent() AuthEventStore {
+	return AuthEventStore(s)
+}
+
 //CREATE TRIGGER update_accounts_modtime
 //BEFORE UPDATE ON accounts
 //FOR EACH ROW
@@ -72,11 +146,39 @@ func (s *store) OAuthToken() OAuthTokenStore {
 // 	hashed_secret BYTEA,
 // 	salt BYTEA,
 // 	roles TEXT[],
+//  email_verified BOOLEAN NOT NULL DEFAULT FALSE,
 //  updated_at timestamp with time zone default current_timestamp,
-//  CONSTRAINT email_unique CHECK (email IS NOT NULL),
-//  CONSTRAINT password_enforced CHECK (email IS NOT NULL OR hashed_secret IS NOT NULL)
+//  CONSTRAINT password_enforced CHECK (hashed_secret IS NULL OR email IS NOT NULL)
 // );
 
+// Accounts made before emails were verified are trusted, so they keep getting account emails and report a verified email:
+// ALTER TABLE accounts ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+// UPDATE accounts SET email_verified = TRUE;
+
+// Accounts made by signing in with a platform can have no username or email, they're stored as NULL so they don't collide:
+// ALTER TABLE accounts DROP CONSTRAINT email_unique;
+// ALTER TABLE accounts DROP CONSTRAINT password_enforced;
+// ALTER TABLE accounts ADD CONSTRAINT password_enforced CHECK (hashed_secret IS NULL OR email IS NOT NULL);
+// UPDATE accounts SET username = NULLIF(username, ''), email = NULLIF(email, '');
+
+// accountColumns - The accounts columns, with a missing username or email read back as ""
+const accountColumns = "user_id, COALESCE(username, '') AS username, COALESCE(email, '') AS email, hashed_secret, salt, roles, email_verified, updated_at"
+
+// accountConflict maps a unique violation on accounts to the username or email that is taken
+func accountConflict(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "23505" {
+		return err
+	}
+	switch pgErr.ConstraintName {
+	case "accounts_username_key":
+		return ErrUsernameTaken
+	case "accounts_email_key":
+		return ErrEmailTaken
+	}
+	return err
+}
+
 // AccountStore interface
 type AccountStore interface {
 	AddAccountToDB(account *Account) error
@@ -85,23 +187,25 @@ type AccountStore interface {
 	GetAccountByEmail(email string) (*Account, error)
 	UpdateAccountInDB(account *Account) error
 	DeleteAccountFromDB(userID string) error
+	MergeAccountsInDB(intoID string, fromID string) ([]string, error)
+	GetAccountRedirect(userID string) (string, error)
 }
 
 // AddAccountToDB creates an account in the database
 func (s *store) AddAccountToDB(account *Account) error {
 	_, err := s.db.Exec(context.Background(),
-		"INSERT INTO accounts (user_id, username, email, hashed_secret, salt, roles) VALUES ($1, $2, $3, $4, $5, $6)",
-		account.UserID, account.Username, account.Email, account.HashedSecret, account.Salt, account.Roles,
+		"INSERT INTO accounts (user_id, username, email, hashed_secret, salt, roles, email_verified) VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, $5, $6, $7)",
+		account.UserID, account.Username, account.Email, account.HashedSecret, account.Salt, account.Roles, account.EmailVerified,
 	)
 	if err != nil {
-		return err
+		return accountConflict(err)
 	}
 	return nil
 }
 
 // GetAccountByID gets an account by ID
 func (s *store) GetAccountByID(userID string) (*Account, error) {
-	rows, err := s.db.Query(context.Background(), "SELECT * FROM accounts WHERE user_id = $1", userID)
+	rows, err := s.db.Query(context.Background(), "SELECT "+accountColumns+" FROM accounts WHERE user_id = $1", userID)
 	if err != nil {
 		return nil, err
 	}
@@ -115,7 +219,7 @@ func (s *store) GetAccountByID(userID string) (*Account, error) {
 
 // GetAccountByUsername gets an account by username
 func (s *store) GetAccountByUsername(username string) (*Account, error) {
-	rows, err := s.db.Query(context.Background(), "SELECT * FROM accounts WHERE username = $1", username)
+	rows, err := s.db.Query(context.Background(), "SELECT "+accountColumns+" FROM accounts WHERE username = $1 AND user_id NOT IN (SELECT from_user_id FROM account_redirects)", username)
 	if err != nil {
 		return nil, err
 	}
@@ -129,7 +233,7 @@ func (s *store) GetAccountByUsername(username string) (*Account, error) {
 
 // GetAccountByEmail gets an account by email
 func (s *store) GetAccountByEmail(email string) (*Account, error) {
-	rows, err := s.db.Query(context.Background(), "SELECT * FROM accounts WHERE email = $1", email)
+	rows, err := s.db.Query(context.Background(), "SELECT "+accountColumns+" FROM accounts WHERE email = $1 AND user_id NOT IN (SELECT from_user_id FROM account_redirects)", email)
 	if err != nil {
 		return nil, err
 	}
@@ -144,11 +248,11 @@ func (s *store) GetAccountByEmail(email string) (*Account, error) {
 // UpdateAccountInDB updates an account in the database
 func (s *store) UpdateAccountInDB(account *Account) error {
 	_, err := s.db.Exec(context.Background(),
-		"UPDATE accounts SET username = $2, email = $3, hashed_secret = $4, salt = $5, roles = $6 WHERE user_id = $1",
-		account.UserID, account.Username, account.Email, account.HashedSecret, account.Salt, account.Roles,
+		"UPDATE accounts SET username = NULLIF($2, ''), email = NULLIF($3, ''), hashed_secret = $4, salt = $5, roles = $6, email_verified = $7 WHERE user_id = $1",
+		account.UserID, account.Username, account.Email, account.HashedSecret, account.Salt, account.Roles, account.EmailVerified,
 	)
 	if err != nil {
-		return err
+		return accountConflict(err)
 	}
 	return nil
 }
@@ -162,6 +266,101 @@ func (s *store) DeleteAccountFromDB(userID string) error {
 	return nil
 }
 
+// CREATE TABLE account_redirects (
+//   from_user_id BIGINT PRIMARY KEY NOT NULL,
+//   to_user_id BIGINT NOT NULL,
+//   merged_at timestamp with time zone default current_timestamp,
+//   FOREIGN KEY (from_user_id) REFERENCES accounts(user_id),
+//   FOREIGN KEY (to_user_id) REFERENCES accounts(user_id)
+// );
+
+// MergeAccountsInDB moves everything owned by one account onto another in a single transaction
+// The merged account keeps its row with a redirect to the account it was merged into, and can no longer sign in.
+// Returns the IDs of the merged account's sessions, which are deleted
+func (s *store) MergeAccountsInDB(intoID string, fromID string) ([]string, error) {
+	ctx := context.Background()
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock both accounts so neither is merged twice at once
+	_, err = tx.Exec(ctx, "SELECT 1 FROM accounts WHERE user_id IN ($1, $2) FOR UPDATE", intoID, fromID)
+	if err != nil {
+		return nil, err
+	}
+	var redirected int
+	err = tx.QueryRow(ctx, "SELECT COUNT(*) FROM account_redirects WHERE from_user_id IN ($1, $2)", intoID, fromID).Scan(&redirected)
+	if err != nil {
+		return nil, err
+	}
+	if redirected > 0 {
+		return nil, ErrAccountMerged
+	}
+
+	var conflicts int
+	err = tx.QueryRow(ctx,
+		"SELECT COUNT(*) FROM linked_accounts WHERE user_id = $2 AND platform IN (SELECT platform FROM linked_accounts WHERE user_id = $1)",
+		intoID, fromID).Scan(&conflicts)
+	if err != nil {
+		return nil, err
+	}
+	if conflicts > 0 {
+		return nil, ErrMergePlatformConflict
+	}
+
+	moves := []string{
+		"UPDATE linked_accounts SET user_id = $1 WHERE user_id = $2",
+		"DELETE FROM oauth_tokens WHERE user_id = $2 AND platform IN (SELECT platform FROM oauth_tokens WHERE user_id = $1)",
+		"UPDATE oauth_tokens SET user_id = $1 WHERE user_id = $2",
+		"UPDATE datastores SET owner_id = $1 WHERE owner_id = $2",
+		"UPDATE datastore_numbers SET user_id = $1 WHERE user_id = $2",
+		"INSERT INTO account_redirects (from_user_id, to_user_id) VALUES ($2, $1)",
+		// Anything that already redirected to the merged account now points at the account it was merged into
+		"UPDATE account_redirects SET to_user_id = $1 WHERE to_user_id = $2",
+	}
+	for _, statement := range moves {
+		_, err = tx.Exec(ctx, statement, intoID, fromID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Passkeys are bound to the user ID they were registered with, and API keys would sign in as the old account
+	removals := []string{
+		"DELETE FROM webauthn_credentials WHERE user_id = $1",
+		"DELETE FROM api_keys WHERE user_id = $1",
+		"DELETE FROM refresh_tokens WHERE user_id = $1",
+	}
+	for _, statement := range removals {
+		_, err = tx.Exec(ctx, statement, fromID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := tx.Query(ctx, "DELETE FROM sessions WHERE user_id = $1 RETURNING session_id::TEXT", fromID)
+	if err != nil {
+		return nil, err
+	}
+	sessionIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	return sessionIDs, tx.Commit(ctx)
+}
+
+// GetAccountRedirect gets the account a merged account was merged into
+func (s *store) GetAccountRedirect(userID string) (string, error) {
+	var toUserID string
+	err := s.db.QueryRow(context.Background(), "SELECT to_user_id::TEXT FROM account_redirects WHERE from_user_id = $1", userID).Scan(&toUserID)
+	if err != nil {
+		return "", err
+	}
+	return toUserID, nil
+}
+
 // CREATE TABLE sessions (
 // 	session_id BIGINT PRIMARY KEY NOT NULL,
 // 	user_id BIGINT NOT NULL,
@@ -169,6 +368,9 @@ func (s *store) DeleteAccountFromDB(userID string) error {
 // 	iat BIGINT NOT NULL,
 // 	lua BIGINT NOT NULL,
 // 	exp BIGINT NOT NULL,
+// 	user_agent TEXT NOT NULL DEFAULT '',
+// 	ip_address TEXT NOT NULL DEFAULT '',
+// 	client_id TEXT NOT NULL DEFAULT '',
 //  FOREIGN KEY (user_id) REFERENCES accounts(user_id)
 // );
 
@@ -176,8 +378,10 @@ func (s *store) DeleteAccountFromDB(userID string) error {
 type SessionStore interface {
 	AddSessionToDB(session *Session) error
 	GetSessionFromDB(id string) (*Session, error)
+	GetUserSessionsFromDB(userID string) ([]*Session, error)
 	UpdateSessionInDB(session *Session) error
 	DeleteSessionInDB(id string) error
+	DeleteUserSessionsInDB(userID string, exceptID string) ([]string, error)
 	AddSessionToCache(session *Session) error
 	GetSessionFromCache(id string) (*Session, error)
 	DeleteSessionFromCache(id string) error
@@ -188,8 +392,8 @@ func (s *store) AddSessionToDB(session *Session) error {
 	defer s.ClearExpiredSessions()
 
 	_, err := s.db.Exec(context.Background(),
-		"INSERT INTO sessions (session_id, user_id, permissions, iat, lua, exp) VALUES ($1, $2, $3, $4, $5, $6)",
-		session.ID, session.UserID, session.Permissions, session.IssuedAt, session.LastUsedAt, session.ExpiresAt,
+		"INSERT INTO sessions (session_id, user_id, permissions, iat, lua, exp, user_agent, ip_address, client_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)",
+		session.ID, session.UserID, session.Permissions, session.IssuedAt, session.LastUsedAt, session.ExpiresAt, session.UserAgent, session.IPAddress, session.ClientID,
 	)
 	if err != nil {
 		return err
@@ -214,6 +418,22 @@ func (s *store) GetSessionFromDB(id string) (*Session, error) {
 	return session, nil
 }
 
+// GetUserSessionsFromDB gets all of a user's sessions, most recently used first
+func (s *store) GetUserSessionsFromDB(userID string) ([]*Session, error) {
+	defer s.ClearExpiredSessions()
+
+	rows, err := s.db.Query(context.Background(), "SELECT * FROM sessions WHERE user_id = $1 ORDER BY lua DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[Session])
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
 // DeleteSessionInDB deletes a session by ID
 func (s *store) DeleteSessionInDB(id string) error {
 	defer s.ClearExpiredSessions()
@@ -225,13 +445,30 @@ func (s *store) DeleteSessionInDB(id string) error {
 	return nil
 }
 
+// DeleteUserSessionsInDB deletes all of a user's sessions except one, returning the deleted IDs
+func (s *store) DeleteUserSessionsInDB(userID string, exceptID string) ([]string, error) {
+	defer s.ClearExpiredSessions()
+
+	rows, err := s.db.Query(context.Background(),
+		"DELETE FROM sessions WHERE user_id = $1 AND session_id::TEXT != $2 RETURNING session_id::TEXT", userID, exceptID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
 // UpdateSessionInDB updates a session
 func (s *store) UpdateSessionInDB(session *Session) error {
 	defer s.ClearExpiredSessions()
 
 	_, err := s.db.Exec(context.Background(),
-		"UPDATE sessions SET user_id = $2, permissions = $3, iat = $4, lua = $5, exp = $6 WHERE session_id = $1",
-		session.ID, session.UserID, session.Permissions, session.IssuedAt, session.LastUsedAt, session.ExpiresAt,
+		"UPDATE sessions SET user_id = $2, permissions = $3, iat = $4, lua = $5, exp = $6, user_agent = $7, ip_address = $8, client_id = $9 WHERE session_id = $1",
+		session.ID, session.UserID, session.Permissions, session.IssuedAt, session.LastUsedAt, session.ExpiresAt, session.UserAgent, session.IPAddress, session.ClientID,
 	)
 	if err != nil {
 		return err
@@ -289,6 +526,82 @@ func (s *store) DeleteSessionFromCache(id string) error {
 	return nil
 }
 
+// CREATE TABLE refresh_tokens (
+//   token_hash TEXT PRIMARY KEY NOT NULL,
+//   session_id BIGINT NOT NULL,
+//   user_id BIGINT NOT NULL,
+//   used BOOLEAN NOT NULL DEFAULT FALSE,
+//   expires_at BIGINT NOT NULL,
+//   created_at timestamp with time zone default current_timestamp,
+//   FOREIGN KEY (session_id) REFERENCES sessions(session_id) ON DELETE CASCADE,
+//   FOREIGN KEY (user_id) REFERENCES accounts(user_id)
+// );
+
+// RefreshTokenStore interface
+type RefreshTokenStore interface {
+	AddRefreshToken(token *RefreshToken) error
+	UseRefreshToken(tokenHash string) (*RefreshToken, error)
+	GetRefreshToken(tokenHash string) (*RefreshToken, error)
+}
+
+// AddRefreshToken adds a refresh token to the database
+func (s *store) AddRefreshToken(token *RefreshToken) error {
+	_, err := s.db.Exec(context.Background(),
+		"INSERT INTO refresh_tokens (token_hash, session_id, user_id, expires_at) VALUES ($1, $2, $3, $4)",
+		token.TokenHash, token.SessionID, token.UserID, token.ExpiresAt,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// UseRefreshToken marks a refresh token as used, returning it as it was beforehand so reuse can be detected
+func (s *store) UseRefreshToken(tokenHash string) (*RefreshToken, error) {
+	rows, err := s.db.Query(context.Background(),
+		"UPDATE refresh_tokens SET used = TRUE WHERE token_hash = $1 AND used = FALSE "+
+			"RETURNING token_hash, session_id, user_id, FALSE AS used, expires_at, created_at",
+		tokenHash,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[RefreshToken])
+	if err == nil {
+		return token, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	// Either the token doesn't exist or it has already been used
+	rows, err = s.db.Query(context.Background(), "SELECT * FROM refresh_tokens WHERE token_hash = $1", tokenHash)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err = pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[RefreshToken])
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// GetRefreshToken gets a refresh token without using it
+func (s *store) GetRefreshToken(tokenHash string) (*RefreshToken, error) {
+	rows, err := s.db.Query(context.Background(), "SELECT * FROM refresh_tokens WHERE token_hash = $1", tokenHash)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[RefreshToken])
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
 //CREATE TRIGGER update_linked_accounts_modtime
 //BEFORE UPDATE ON linked_accounts
 //FOR EACH ROW
@@ -300,12 +613,18 @@ func (s *store) DeleteSessionFromCache(id string) error {
 //   platform_username TEXT NOT NULL,
 //   platform_id TEXT NOT NULL,
 //   data JSONB NOT NULL,
+//   verified BOOLEAN NOT NULL DEFAULT FALSE,
 //   created_at timestamp with time zone default current_timestamp,
 //   updated_at timestamp with time zone default current_timestamp,
 //   FOREIGN KEY (user_id) REFERENCES accounts(user_id),
 //   CONSTRAINT linked_accounts_unique UNIQUE (user_id, platform)
 // );
 
+// Links made before this column were made by signing in to the platform, apart from ones made with a link code:
+// ALTER TABLE linked_accounts ADD COLUMN verified BOOLEAN NOT NULL DEFAULT TRUE;
+// ALTER TABLE linked_accounts ALTER COLUMN verified SET DEFAULT FALSE;
+// UPDATE linked_accounts SET verified = FALSE WHERE data - 'id' - 'username' = '{}'::jsonb;
+
 // LinkAccountStore - Account Link Store
 type LinkAccountStore interface {
 	AddLinkedAccountToDB(la *LinkedAccount) error
@@ -313,11 +632,13 @@ type LinkAccountStore interface {
 	GetLinkedAccountByPlatformID(platform Platform, platformID string) (*LinkedAccount, error)
 	GetLinkedAccountByPlatformName(platform Platform, platformName string) (*LinkedAccount, error)
 	GetLinkedAccountByUserID(userID string, platform Platform) (*LinkedAccount, error)
+	GetLinkedAccountsByUserID(userID string) ([]*LinkedAccount, error)
+	DeleteLinkedAccount(userID string, platform Platform) error
 }
 
 // AddLinkedAccountToDB adds a linked account to the database
 func (s *store) AddLinkedAccountToDB(la *LinkedAccount) error {
-	_, err := s.db.Exec(context.Background(), "INSERT INTO linked_accounts (user_id, platform, platform_username, platform_id, data) VALUES ($1, $2, $3, $4, $5)", la.UserID, la.Platform, la.PlatformUsername, la.PlatformID, la.Data)
+	_, err := s.db.Exec(context.Background(), "INSERT INTO linked_accounts (user_id, platform, platform_username, platform_id, data, verified) VALUES ($1, $2, $3, $4, $5, $6)", la.UserID, la.Platform, la.PlatformUsername, la.PlatformID, la.Data, la.Verified)
 	if err != nil {
 		return err
 	}
@@ -326,7 +647,7 @@ func (s *store) AddLinkedAccountToDB(la *LinkedAccount) error {
 
 // UpdateLinkedAccount updates a linked account in the database
 func (s *store) UpdateLinkedAccount(la *LinkedAccount) error {
-	_, err := s.db.Exec(context.Background(), "UPDATE linked_accounts SET platform_username = $1, platform_id = $2, data = $3, updated_at = current_timestamp WHERE user_id = $4 AND platform = $5", la.PlatformUsername, la.PlatformID, la.Data, la.UserID, la.Platform)
+	_, err := s.db.Exec(context.Background(), "UPDATE linked_accounts SET platform_username = $1, platform_id = $2, data = $3, verified = $6, updated_at = current_timestamp WHERE user_id = $4 AND platform = $5", la.PlatformUsername, la.PlatformID, la.Data, la.UserID, la.Platform, la.Verified)
 	if err != nil {
 		return err
 	}
@@ -375,6 +696,32 @@ func (s *store) GetLinkedAccountByUserID(userID string, platform Platform) (*Lin
 	return al, nil
 }
 
+// GetLinkedAccountsByUserID gets all of a user's linked accounts
+func (s *store) GetLinkedAccountsByUserID(userID string) ([]*LinkedAccount, error) {
+	rows, err := s.db.Query(context.Background(), "SELECT * FROM linked_accounts WHERE user_id = $1 ORDER BY created_at", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	als, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[LinkedAccount])
+	if err != nil {
+		return nil, err
+	}
+	return als, nil
+}
+
+// DeleteLinkedAccount unlinks a platform account from a user
+func (s *store) DeleteLinkedAccount(userID string, platform Platform) error {
+	tag, err := s.db.Exec(context.Background(), "DELETE FROM linked_accounts WHERE user_id = $1 AND platform = $2", userID, platform)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
 // RateLimitStore interface
 type RateLimitStore interface {
 	GetRateLimit(key string) (int, error)
@@ -432,43 +779,184 @@ func (s *store) IncrementRateLimit(key string) error {
 //CREATE TABLE oauth_tokens (
 //	user_id BIGINT NOT NULL,
 //	platform TEXT NOT NULL,
-//	access_token TEXT NOT NULL,
+//	access_token BYTEA NOT NULL,
 //  token_type TEXT,
-//  refresh_token TEXT,
-//	expiry BIGINT,
+//  refresh_token BYTEA,
+//	expiry timestamp with time zone,
 //  expires_in BIGINT,
 //  scope TEXT[],
+//  invalid BOOLEAN NOT NULL DEFAULT FALSE,
+//  data_key BYTEA NOT NULL,
+//  key_version INT NOT NULL,
 //  created_at timestamp with time zone default current_timestamp,
 //  updated_at timestamp with time zone default current_timestamp,
 //  FOREIGN KEY (user_id) REFERENCES accounts(user_id),
 //  CONSTRAINT oauth_tokens_unique UNIQUE (user_id, platform)
 //);
 
-// OAuthToken OAuth2 token with scope
+//CREATE INDEX oauth_tokens_key_version ON oauth_tokens (key_version);
+
+// Tokens stored before they were encrypted are kept readable with key_version 0 until the token refresher encrypts them:
+// ALTER TABLE oauth_tokens ALTER COLUMN access_token TYPE BYTEA USING convert_to(access_token, 'UTF8');
+// ALTER TABLE oauth_tokens ALTER COLUMN refresh_token TYPE BYTEA USING convert_to(refresh_token, 'UTF8');
+// ALTER TABLE oauth_tokens ADD COLUMN data_key BYTEA, ADD COLUMN key_version INT NOT NULL DEFAULT 0;
+// ALTER TABLE oauth_tokens ALTER COLUMN key_version DROP DEFAULT;
+// Once no tokens have key_version 0 left:
+// ALTER TABLE oauth_tokens ALTER COLUMN data_key SET NOT NULL;
+
+// legacyOAuthTokenVersion - key_version of tokens stored before encryption, key ring versions start at 1
+const legacyOAuthTokenVersion = 0
+
+// OAuthToken OAuth2 token for a platform account, with scope
 type OAuthToken struct {
-	*oauth2.Token
+	UserID       string    `json:"user_id" db:"user_id"`
+	Platform     Platform  `json:"platform" db:"platform"`
 	AccessToken  string    `json:"access_token" db:"access_token"`
 	TokenType    string    `json:"token_type,omitempty" db:"token_type"`
 	RefreshToken string    `json:"refresh_token,omitempty" db:"refresh_token"`
 	Expiry       time.Time `json:"expiry,omitempty" db:"expiry"`
 	ExpiresIn    int64     `json:"expires_in,omitempty" db:"expires_in"`
-	UserID       string    `json:"user_id" db:"user_id"`
 	Scope        []string  `json:"scope" db:"scope"`
+	Invalid      bool      `json:"invalid" db:"invalid"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// oauthTokenRow OAuthToken as it is stored, with the tokens encrypted by a wrapped data key
+type oauthTokenRow struct {
+	UserID       string    `db:"user_id"`
+	Platform     Platform  `db:"platform"`
+	AccessToken  []byte    `db:"access_token"`
+	TokenType    string    `db:"token_type"`
+	RefreshToken []byte    `db:"refresh_token"`
+	Expiry       time.Time `db:"expiry"`
+	ExpiresIn    int64     `db:"expires_in"`
+	Scope        []string  `db:"scope"`
+	Invalid      bool      `db:"invalid"`
+	DataKey      []byte    `db:"data_key"`
+	KeyVersion   int       `db:"key_version"`
+	CreatedAt    time.Time `db:"created_at"`
+	UpdatedAt    time.Time `db:"updated_at"`
+}
+
+// NewOAuthToken creates an OAuthToken from an oauth2.Token
+func NewOAuthToken(token *oauth2.Token, scope []string) *OAuthToken {
+	return &OAuthToken{
+		AccessToken:  token.AccessToken,
+		TokenType:    token.TokenType,
+		RefreshToken: token.RefreshToken,
+		Expiry:       token.Expiry,
+		ExpiresIn:    token.ExpiresIn,
+		Scope:        scope,
+	}
+}
+
+// OAuth2 converts the token back into an oauth2.Token
+func (t *OAuthToken) OAuth2() *oauth2.Token {
+	return &oauth2.Token{
+		AccessToken:  t.AccessToken,
+		TokenType:    t.TokenType,
+		RefreshToken: t.RefreshToken,
+		Expiry:       t.Expiry,
+		ExpiresIn:    t.ExpiresIn,
+	}
+}
+
+// sealOAuthToken encrypts a token's secrets with a new data key
+func sealOAuthToken(token *OAuthToken) (*oauthTokenRow, error) {
+	ring, err := oauthKeyRing()
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := ring.NewDataKey()
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := dataKey.Encrypt([]byte(token.AccessToken))
+	if err != nil {
+		return nil, err
+	}
+	var refreshToken []byte
+	if token.RefreshToken != "" {
+		refreshToken, err = dataKey.Encrypt([]byte(token.RefreshToken))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &oauthTokenRow{
+		UserID:       token.UserID,
+		Platform:     token.Platform,
+		AccessToken:  accessToken,
+		TokenType:    token.TokenType,
+		RefreshToken: refreshToken,
+		Expiry:       token.Expiry,
+		ExpiresIn:    token.ExpiresIn,
+		Scope:        token.Scope,
+		DataKey:      dataKey.Wrapped,
+		KeyVersion:   dataKey.Version,
+	}, nil
+}
+
+// open decrypts a stored token's secrets, tokens stored before encryption are returned as they are
+func (row *oauthTokenRow) open() (*OAuthToken, error) {
+	accessToken, refreshToken := row.AccessToken, row.RefreshToken
+	if row.KeyVersion != legacyOAuthTokenVersion {
+		ring, err := oauthKeyRing()
+		if err != nil {
+			return nil, err
+		}
+		dataKey, err := ring.OpenDataKey(row.KeyVersion, row.DataKey)
+		if err != nil {
+			return nil, err
+		}
+		accessToken, err = dataKey.Decrypt(row.AccessToken)
+		if err != nil {
+			return nil, err
+		}
+		if len(row.RefreshToken) > 0 {
+			refreshToken, err = dataKey.Decrypt(row.RefreshToken)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &OAuthToken{
+		UserID:       row.UserID,
+		Platform:     row.Platform,
+		AccessToken:  string(accessToken),
+		TokenType:    row.TokenType,
+		RefreshToken: string(refreshToken),
+		Expiry:       row.Expiry,
+		ExpiresIn:    row.ExpiresIn,
+		Scope:        row.Scope,
+		Invalid:      row.Invalid,
+		CreatedAt:    row.CreatedAt,
+		UpdatedAt:    row.UpdatedAt,
+	}, nil
 }
 
 // OAuthTokenStore interface
 type OAuthTokenStore interface {
 	AddOAuthTokenToDB(token *OAuthToken) error
-	GetOAuthTokenByUserID(userID string, platform string) (*OAuthToken, error)
+	GetOAuthTokenByUserID(userID string, platform Platform) (*OAuthToken, error)
+	GetExpiringOAuthTokens(before time.Time) ([]*OAuthToken, error)
 	UpdateOAuthToken(token *OAuthToken) error
+	InvalidateOAuthToken(userID string, platform Platform) error
 	DeleteOAuthToken(userID string, platform Platform) error
+	LockOAuthTokenRefresh(userID string, platform Platform, ttl time.Duration) (bool, error)
+	UnlockOAuthTokenRefresh(userID string, platform Platform) error
 }
 
-// AddOAuthTokenToDB adds an OAuth token to the database
+// AddOAuthTokenToDB adds an OAuth token to the database, replacing the user's existing token for the platform
 func (s *store) AddOAuthTokenToDB(token *OAuthToken) error {
-	_, err := s.db.Exec(context.Background(),
-		"INSERT INTO oauth_tokens (user_id, platform, access_token, token_type, refresh_token, expiry, expires_in, scope) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
-		token.UserID, token.TokenType, token.AccessToken, token.RefreshToken, token.Expiry.Unix(), token.ExpiresIn, token.Scope)
+	row, err := sealOAuthToken(token)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(context.Background(),
+		`INSERT INTO oauth_tokens (user_id, platform, access_token, token_type, refresh_token, expiry, expires_in, scope, data_key, key_version) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (user_id, platform) DO UPDATE SET access_token = $3, token_type = $4, refresh_token = $5, expiry = $6, expires_in = $7, scope = $8, data_key = $9, key_version = $10, invalid = FALSE`,
+		row.UserID, row.Platform, row.AccessToken, row.TokenType, row.RefreshToken, row.Expiry, row.ExpiresIn, row.Scope, row.DataKey, row.KeyVersion)
 	if err != nil {
 		return err
 	}
@@ -476,24 +964,61 @@ func (s *store) AddOAuthTokenToDB(token *OAuthToken) error {
 }
 
 // GetOAuthTokenByUserID gets an OAuth token by user ID and platform
-func (s *store) GetOAuthTokenByUserID(userID string, platform string) (*OAuthToken, error) {
+func (s *store) GetOAuthTokenByUserID(userID string, platform Platform) (*OAuthToken, error) {
 	rows, err := s.db.Query(context.Background(), "SELECT * FROM oauth_tokens WHERE user_id = $1 AND platform = $2", userID, platform)
 	if err != nil {
 		return nil, err
 	}
 
-	token, err := pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[OAuthToken])
+	row, err := pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[oauthTokenRow])
 	if err != nil {
 		return nil, err
 	}
-	return token, nil
+	return row.open()
+}
+
+// GetExpiringOAuthTokens gets the valid, refreshable tokens that expire before the given time
+func (s *store) GetExpiringOAuthTokens(before time.Time) ([]*OAuthToken, error) {
+	rows, err := s.db.Query(context.Background(),
+		"SELECT * FROM oauth_tokens WHERE NOT invalid AND refresh_token IS NOT NULL AND expiry < $1", before)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[oauthTokenRow])
+	if err != nil {
+		return nil, err
+	}
+	var tokens []*OAuthToken
+	for _, row := range stored {
+		token, err := row.open()
+		if err != nil {
+			log.Printf("Failed to decrypt %s token for user %s:\n\t%v", row.Platform, row.UserID, err)
+			continue
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
 }
 
 // UpdateOAuthToken updates an OAuth token in the database
 func (s *store) UpdateOAuthToken(token *OAuthToken) error {
-	_, err := s.db.Exec(context.Background(),
-		"UPDATE oauth_tokens SET access_token = $2, token_type = $3, refresh_token = $4, expiry = $5, expires_in = $6, scope = $7 WHERE user_id = $1 AND platform = $8",
-		token.UserID, token.AccessToken, token.TokenType, token.RefreshToken, token.Expiry.Unix(), token.ExpiresIn, token.Scope)
+	row, err := sealOAuthToken(token)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(context.Background(),
+		"UPDATE oauth_tokens SET access_token = $3, token_type = $4, refresh_token = $5, expiry = $6, expires_in = $7, scope = $8, data_key = $9, key_version = $10, invalid = FALSE WHERE user_id = $1 AND platform = $2",
+		row.UserID, row.Platform, row.AccessToken, row.TokenType, row.RefreshToken, row.Expiry, row.ExpiresIn, row.Scope, row.DataKey, row.KeyVersion)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// InvalidateOAuthToken marks an OAuth token as no longer usable, the user has to authorize the platform again
+func (s *store) InvalidateOAuthToken(userID string, platform Platform) error {
+	_, err := s.db.Exec(context.Background(), "UPDATE oauth_tokens SET invalid = TRUE WHERE user_id = $1 AND platform = $2", userID, platform)
 	if err != nil {
 		return err
 	}
@@ -508,3 +1033,862 @@ func (s *store) DeleteOAuthToken(userID string, platform Platform) error {
 	}
 	return nil
 }
+
+// oauthRefreshKey - The Redis key locking a token while it is refreshed
+func oauthRefreshKey(userID string, platform Platform) string {
+	return "oauth_refresh:" + string(platform) + ":" + userID
+}
+
+// LockOAuthTokenRefresh takes the refresh lock for a token so only one instance refreshes it
+func (s *store) LockOAuthTokenRefresh(userID string, platform Platform, ttl time.Duration) (bool, error) {
+	return s.rdb.SetNX(context.Background(), oauthRefreshKey(userID, platform), 1, ttl).Result()
+}
+
+// UnlockOAuthTokenRefresh releases the refresh lock for a token
+func (s *store) UnlockOAuthTokenRefresh(userID string, platform Platform) error {
+	_, err := s.rdb.Del(context.Background(), oauthRefreshKey(userID, platform)).Result()
+	return err
+}
+
+// OAuthTokenKeyStore interface
+type OAuthTokenKeyStore interface {
+	EncryptLegacyOAuthTokens(limit int) (int, error)
+	RewrapOAuthTokens(limit int) (int, error)
+}
+
+// EncryptLegacyOAuthTokens encrypts tokens that were stored before encryption, returns how many tokens were encrypted
+func (s *store) EncryptLegacyOAuthTokens(limit int) (int, error) {
+	rows, err := s.db.Query(context.Background(),
+		"SELECT * FROM oauth_tokens WHERE key_version = $1 LIMIT $2", legacyOAuthTokenVersion, limit)
+	if err != nil {
+		return 0, err
+	}
+	legacy, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[oauthTokenRow])
+	if err != nil {
+		return 0, err
+	}
+
+	encrypted := 0
+	for _, row := range legacy {
+		token, err := row.open()
+		if err != nil {
+			return encrypted, err
+		}
+		sealed, err := sealOAuthToken(token)
+		if err != nil {
+			return encrypted, err
+		}
+		// Skip the token if it was written again since it was read, it's already encrypted
+		tag, err := s.db.Exec(context.Background(),
+			"UPDATE oauth_tokens SET access_token = $3, refresh_token = $4, data_key = $5, key_version = $6 WHERE user_id = $1 AND platform = $2 AND key_version = $7",
+			row.UserID, row.Platform, sealed.AccessToken, sealed.RefreshToken, sealed.DataKey, sealed.KeyVersion, legacyOAuthTokenVersion)
+		if err != nil {
+			return encrypted, err
+		}
+		encrypted += int(tag.RowsAffected())
+	}
+	return encrypted, nil
+}
+
+// RewrapOAuthTokens wraps the data keys of tokens still on an older key with the current key
+// Only the data keys change, returns how many tokens were rewrapped
+func (s *store) RewrapOAuthTokens(limit int) (int, error) {
+	ring, err := oauthKeyRing()
+	if err != nil {
+		return 0, err
+	}
+	rows, err := s.db.Query(context.Background(),
+		"SELECT user_id, platform, data_key, key_version FROM oauth_tokens WHERE key_version <> $1 AND key_version <> $2 LIMIT $3", ring.CurrentVersion(), legacyOAuthTokenVersion, limit)
+	if err != nil {
+		return 0, err
+	}
+	type wrappedKey struct {
+		UserID     string   `db:"user_id"`
+		Platform   Platform `db:"platform"`
+		DataKey    []byte   `db:"data_key"`
+		KeyVersion int      `db:"key_version"`
+	}
+	keys, err := pgx.CollectRows(rows, pgx.RowToStructByName[wrappedKey])
+	if err != nil {
+		return 0, err
+	}
+
+	rewrapped := 0
+	for _, k := range keys {
+		dataKey, err := ring.OpenDataKey(k.KeyVersion, k.DataKey)
+		if err != nil {
+			log.Printf("Failed to unwrap %s token key for user %s:\n\t%v", k.Platform, k.UserID, err)
+			continue
+		}
+		dataKey, err = ring.Rewrap(dataKey)
+		if err != nil {
+			return rewrapped, err
+		}
+		// Skip the token if it was written again since it was read, it already has a new key
+		tag, err := s.db.Exec(context.Background(),
+			"UPDATE oauth_tokens SET data_key = $3, key_version = $4 WHERE user_id = $1 AND platform = $2 AND key_version = $5",
+			k.UserID, k.Platform, dataKey.Wrapped, dataKey.Version, k.KeyVersion)
+		if err != nil {
+			return rewrapped, err
+		}
+		rewrapped += int(tag.RowsAffected())
+	}
+	return rewrapped, nil
+}
+
+// -------------- One-Time Tokens --------------
+
+// OneTimeTokenStore interface
+type OneTimeTokenStore interface {
+	AddOneTimeToken(purpose TokenPurpose, token string, userID string, ttl time.Duration) error
+	GetOneTimeToken(purpose TokenPurpose, token string) (string, error)
+	ConsumeOneTimeToken(purpose TokenPurpose, token string) (string, error)
+	IncrementOneTimeTokenFailures(purpose TokenPurpose, token string, ttl time.Duration) (int, error)
+}
+
+// oneTimeTokenKey builds the cache key for a token, only the token's hash is stored
+func oneTimeTokenKey(purpose TokenPurpose, token string) string {
+	return "ott:" + string(purpose) + ":" + HashToken(token)
+}
+
+// AddOneTimeToken stores a token for a user that expires after the given duration
+func (s *store) AddOneTimeToken(purpose TokenPurpose, token string, userID string, ttl time.Duration) error {
+	_, err := s.rdb.Set(context.Background(), oneTimeTokenKey(purpose, token), userID, ttl).Result()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetOneTimeToken gets the user ID for a token without using it up
+func (s *store) GetOneTimeToken(purpose TokenPurpose, token string) (string, error) {
+	userID, err := s.rdb.Get(context.Background(), oneTimeTokenKey(purpose, token)).Result()
+	if err != nil {
+		return "", err
+	}
+	return userID, nil
+}
+
+// ConsumeOneTimeToken gets the user ID for a token and removes it so it cannot be used again
+func (s *store) ConsumeOneTimeToken(purpose TokenPurpose, token string) (string, error) {
+	userID, err := s.rdb.GetDel(context.Background(), oneTimeTokenKey(purpose, token)).Result()
+	if err != nil {
+		return "", err
+	}
+	return userID, nil
+}
+
+// IncrementOneTimeTokenFailures counts a failed use of a token, the count expires with the token
+func (s *store) IncrementOneTimeTokenFailures(purpose TokenPurpose, token string, ttl time.Duration) (int, error) {
+	key := oneTimeTokenKey(purpose, token) + ":failures"
+	var incr *redis.IntCmd
+	_, err := s.rdb.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(context.Background(), key)
+		pipe.Expire(context.Background(), key, ttl)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(incr.Val()), nil
+}
+
+//CREATE TRIGGER update_mfa_totp_modtime
+//BEFORE UPDATE ON mfa_totp
+//FOR EACH ROW
+//EXECUTE PROCEDURE update_modified_column();
+
+// CREATE TABLE mfa_totp (
+//   user_id BIGINT PRIMARY KEY NOT NULL,
+//   secret BYTEA NOT NULL,
+//   enabled BOOLEAN NOT NULL DEFAULT FALSE,
+//   recovery_codes TEXT[] NOT NULL DEFAULT '{}',
+//   last_used_step BIGINT NOT NULL DEFAULT 0,
+//   created_at timestamp with time zone default current_timestamp,
+//   updated_at timestamp with time zone default current_timestamp,
+//   FOREIGN KEY (user_id) REFERENCES accounts(user_id)
+// );
+
+// TOTPStore interface
+type TOTPStore interface {
+	GetTOTP(userID string) (*TOTP, error)
+	UpsertTOTP(totp *TOTP) error
+	DeleteTOTP(userID string) error
+}
+
+// GetTOTP gets a user's TOTP configuration
+func (s *store) GetTOTP(userID string) (*TOTP, error) {
+	rows, err := s.db.Query(context.Background(), "SELECT * FROM mfa_totp WHERE user_id = $1", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	totp, err := pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[TOTP])
+	if err != nil {
+		return nil, err
+	}
+	return totp, nil
+}
+
+// UpsertTOTP creates or replaces a user's TOTP configuration
+func (s *store) UpsertTOTP(totp *TOTP) error {
+	_, err := s.db.Exec(context.Background(),
+		"INSERT INTO mfa_totp (user_id, secret, enabled, recovery_codes, last_used_step) VALUES ($1, $2, $3, $4, $5) "+
+			"ON CONFLICT (user_id) DO UPDATE SET secret = $2, enabled = $3, recovery_codes = $4, last_used_step = $5",
+		totp.UserID, totp.Secret, totp.Enabled, totp.RecoveryCodes, totp.LastUsedStep,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// DeleteTOTP removes a user's TOTP configuration
+func (s *store) DeleteTOTP(userID string) error {
+	_, err := s.db.Exec(context.Background(), "DELETE FROM mfa_totp WHERE user_id = $1", userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CREATE TABLE webauthn_credentials (
+//   credential_id TEXT PRIMARY KEY NOT NULL,
+//   user_id BIGINT NOT NULL,
+//   name TEXT NOT NULL,
+//   credential JSONB NOT NULL,
+//   created_at timestamp with time zone default current_timestamp,
+//   last_used_at timestamp with time zone,
+//   FOREIGN KEY (user_id) REFERENCES accounts(user_id)
+// );
+
+// WebAuthnStore interface
+type WebAuthnStore interface {
+	AddWebAuthnCredential(cred *WebAuthnCredential) error
+	GetWebAuthnCredential(credentialID string) (*WebAuthnCredential, error)
+	GetWebAuthnCredentials(userID string) ([]*WebAuthnCredential, error)
+	UpdateWebAuthnCredential(cred *WebAuthnCredential) error
+	DeleteWebAuthnCredential(userID, credentialID string) error
+	AddWebAuthnChallenge(purpose TokenPurpose, id string, session *webauthn.SessionData, ttl time.Duration) error
+	ConsumeWebAuthnChallenge(purpose TokenPurpose, id string) (*webauthn.SessionData, error)
+}
+
+// AddWebAuthnCredential adds a WebAuthn credential to the database
+func (s *store) AddWebAuthnCredential(cred *WebAuthnCredential) error {
+	_, err := s.db.Exec(context.Background(),
+		"INSERT INTO webauthn_credentials (credential_id, user_id, name, credential) VALUES ($1, $2, $3, $4)",
+		cred.ID, cred.UserID, cred.Name, cred.Credential,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetWebAuthnCredential gets a WebAuthn credential by ID
+func (s *store) GetWebAuthnCredential(credentialID string) (*WebAuthnCredential, error) {
+	rows, err := s.db.Query(context.Background(), "SELECT * FROM webauthn_credentials WHERE credential_id = $1", credentialID)
+	if err != nil {
+		return nil, err
+	}
+
+	cred, err := pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[WebAuthnCredential])
+	if err != nil {
+		return nil, err
+	}
+	return cred, nil
+}
+
+// GetWebAuthnCredentials gets all of a user's WebAuthn credentials
+func (s *store) GetWebAuthnCredentials(userID string) ([]*WebAuthnCredential, error) {
+	rows, err := s.db.Query(context.Background(), "SELECT * FROM webauthn_credentials WHERE user_id = $1 ORDER BY created_at", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[WebAuthnCredential])
+	if err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+// UpdateWebAuthnCredential updates a WebAuthn credential after it has been used
+func (s *store) UpdateWebAuthnCredential(cred *WebAuthnCredential) error {
+	_, err := s.db.Exec(context.Background(),
+		"UPDATE webauthn_credentials SET name = $2, credential = $3, last_used_at = $4 WHERE credential_id = $1",
+		cred.ID, cred.Name, cred.Credential, cred.LastUsedAt,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// DeleteWebAuthnCredential deletes one of a user's WebAuthn credentials
+func (s *store) DeleteWebAuthnCredential(userID, credentialID string) error {
+	tag, err := s.db.Exec(context.Background(), "DELETE FROM webauthn_credentials WHERE user_id = $1 AND credential_id = $2", userID, credentialID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// AddWebAuthnChallenge stores the session data for an in-progress WebAuthn ceremony
+func (s *store) AddWebAuthnChallenge(purpose TokenPurpose, id string, session *webauthn.SessionData, ttl time.Duration) error {
+	stringSession, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.rdb.Set(context.Background(), "webauthn:"+string(purpose)+":"+id, stringSession, ttl).Result()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ConsumeWebAuthnChallenge gets the session data for a WebAuthn ceremony and removes it so it cannot be replayed
+func (s *store) ConsumeWebAuthnChallenge(purpose TokenPurpose, id string) (*webauthn.SessionData, error) {
+	var session webauthn.SessionData
+	stringSession, err := s.rdb.GetDel(context.Background(), "webauthn:"+string(purpose)+":"+id).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(stringSession), &session)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// CREATE TABLE api_keys (
+//   key_id BIGINT PRIMARY KEY NOT NULL,
+//   user_id BIGINT NOT NULL,
+//   name TEXT NOT NULL,
+//   prefix TEXT NOT NULL,
+//   key_hash TEXT UNIQUE NOT NULL,
+//   permissions TEXT[] NOT NULL,
+//   expires_at BIGINT NOT NULL DEFAULT 0,
+//   last_used_at BIGINT NOT NULL DEFAULT 0,
+//   created_at timestamp with time zone default current_timestamp,
+//   FOREIGN KEY (user_id) REFERENCES accounts(user_id)
+// );
+
+// APIKeyStore interface
+type APIKeyStore interface {
+	AddAPIKeyToDB(key *APIKey) error
+	GetAPIKeyByHash(keyHash string) (*APIKey, error)
+	GetAPIKeysByUserID(userID string) ([]*APIKey, error)
+	UpdateAPIKeyLastUsed(keyID string, lastUsedAt int64) error
+	DeleteAPIKeyFromDB(userID, keyID string) error
+}
+
+// AddAPIKeyToDB adds an API key to the database
+func (s *store) AddAPIKeyToDB(key *APIKey) error {
+	_, err := s.db.Exec(context.Background(),
+		"INSERT INTO api_keys (key_id, user_id, name, prefix, key_hash, permissions, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		key.ID, key.UserID, key.Name, key.Prefix, key.KeyHash, key.Permissions, key.ExpiresAt,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetAPIKeyByHash gets an API key by the hash of the key
+func (s *store) GetAPIKeyByHash(keyHash string) (*APIKey, error) {
+	rows, err := s.db.Query(context.Background(), "SELECT * FROM api_keys WHERE key_hash = $1", keyHash)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[APIKey])
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// GetAPIKeysByUserID gets all of a user's API keys
+func (s *store) GetAPIKeysByUserID(userID string) ([]*APIKey, error) {
+	rows, err := s.db.Query(context.Background(), "SELECT * FROM api_keys WHERE user_id = $1 ORDER BY created_at", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[APIKey])
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// UpdateAPIKeyLastUsed records when an API key was last used
+func (s *store) UpdateAPIKeyLastUsed(keyID string, lastUsedAt int64) error {
+	_, err := s.db.Exec(context.Background(), "UPDATE api_keys SET last_used_at = $2 WHERE key_id = $1", keyID, lastUsedAt)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// DeleteAPIKeyFromDB deletes one of a user's API keys
+func (s *store) DeleteAPIKeyFromDB(userID, keyID string) error {
+	tag, err := s.db.Exec(context.Background(), "DELETE FROM api_keys WHERE user_id = $1 AND key_id = $2", userID, keyID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// CREATE TABLE jwt_signing_keys (
+//   kid TEXT PRIMARY KEY NOT NULL,
+//   algorithm TEXT NOT NULL,
+//   public_key BYTEA NOT NULL,
+//   private_key BYTEA NOT NULL,
+//   created_at BIGINT NOT NULL,
+//   retired_at BIGINT NOT NULL DEFAULT 0,
+//   expires_at BIGINT NOT NULL DEFAULT 0
+// );
+
+// SigningKeyStore interface
+type SigningKeyStore interface {
+	GetSigningKeys(now int64) ([]*SigningKey, error)
+	RotateSigningKey(key *SigningKey, rotateBefore int64, retiredExpiresAt int64) (bool, error)
+}
+
+// GetSigningKeys gets the keys that haven't passed their grace window, newest first
+func (s *store) GetSigningKeys(now int64) ([]*SigningKey, error) {
+	rows, err := s.db.Query(context.Background(),
+		"SELECT * FROM jwt_signing_keys WHERE expires_at = 0 OR expires_at > $1 ORDER BY created_at DESC", now)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[SigningKey])
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// RotateSigningKey adds a new active key if the current one was created before rotateBefore, retiring the old one
+// The table is locked so that only one instance rotates at a time
+func (s *store) RotateSigningKey(key *SigningKey, rotateBefore int64, retiredExpiresAt int64) (bool, error) {
+	ctx := context.Background()
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "LOCK TABLE jwt_signing_keys IN EXCLUSIVE MODE")
+	if err != nil {
+		return false, err
+	}
+	var current int
+	err = tx.QueryRow(ctx, "SELECT COUNT(*) FROM jwt_signing_keys WHERE retired_at = 0 AND created_at >= $1", rotateBefore).Scan(&current)
+	if err != nil {
+		return false, err
+	}
+	if current > 0 {
+		return false, nil
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE jwt_signing_keys SET retired_at = $1, expires_at = $2 WHERE retired_at = 0", key.CreatedAt, retiredExpiresAt)
+	if err != nil {
+		return false, err
+	}
+	_, err = tx.Exec(ctx,
+		"INSERT INTO jwt_signing_keys (kid, algorithm, public_key, private_key, created_at) VALUES ($1, $2, $3, $4, $5)",
+		key.KID, key.Algorithm, key.PublicKey, key.PrivateKey, key.CreatedAt,
+	)
+	if err != nil {
+		return false, err
+	}
+	_, err = tx.Exec(ctx, "DELETE FROM jwt_signing_keys WHERE expires_at != 0 AND expires_at < $1", key.CreatedAt)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
+
+// -------------- Roles --------------
+
+// CREATE TABLE roles (
+//   name TEXT PRIMARY KEY NOT NULL,
+//   description TEXT NOT NULL DEFAULT '',
+//   permissions TEXT[] NOT NULL DEFAULT '{}',
+//   created_at timestamp with time zone default current_timestamp,
+//   updated_at timestamp with time zone default current_timestamp,
+//   CONSTRAINT builtin_role CHECK (name NOT IN ('system', 'owner'))
+// );
+//
+// Built-in roles are defined in code, so rows can't shadow them:
+// DELETE FROM roles WHERE name IN ('system', 'owner');
+// ALTER TABLE roles ADD CONSTRAINT builtin_role CHECK (name NOT IN ('system', 'owner'));
+
+// rolesChannel - Redis channel used to tell every instance to reload its roles
+const rolesChannel = "roles:invalidate"
+
+// RoleStore interface
+type RoleStore interface {
+	GetRolesFromDB() ([]*Role, error)
+	GetRoleFromDB(name string) (*Role, error)
+	AddRoleToDB(role *Role) error
+	UpdateRoleInDB(role *Role) error
+	DeleteRoleFromDB(name string) error
+	PublishRolesChanged() error
+	SubscribeRolesChanged() *redis.PubSub
+}
+
+// GetRolesFromDB gets every role
+func (s *store) GetRolesFromDB() ([]*Role, error) {
+	rows, err := s.db.Query(context.Background(), "SELECT * FROM roles ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[Role])
+	if err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// GetRoleFromDB gets a role by name
+func (s *store) GetRoleFromDB(name string) (*Role, error) {
+	rows, err := s.db.Query(context.Background(), "SELECT * FROM roles WHERE name = $1", name)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[Role])
+	if err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// AddRoleToDB adds a role to the database
+func (s *store) AddRoleToDB(role *Role) error {
+	_, err := s.db.Exec(context.Background(),
+		"INSERT INTO roles (name, description, permissions) VALUES ($1, $2, $3)",
+		role.Name, role.Description, role.Permissions,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// UpdateRoleInDB updates a role's description and permissions
+func (s *store) UpdateRoleInDB(role *Role) error {
+	tag, err := s.db.Exec(context.Background(),
+		"UPDATE roles SET description = $2, permissions = $3, updated_at = current_timestamp WHERE name = $1",
+		role.Name, role.Description, role.Permissions,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteRoleFromDB deletes a role
+func (s *store) DeleteRoleFromDB(name string) error {
+	tag, err := s.db.Exec(context.Background(), "DELETE FROM roles WHERE name = $1", name)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// PublishRolesChanged tells every instance that the roles have changed
+func (s *store) PublishRolesChanged() error {
+	return s.rdb.Publish(context.Background(), rolesChannel, "").Err()
+}
+
+// SubscribeRolesChanged subscribes to role change notifications
+func (s *store) SubscribeRolesChanged() *redis.PubSub {
+	return s.rdb.Subscribe(context.Background(), rolesChannel)
+}
+
+// -------------- Link Codes --------------
+
+// LinkCodeStore interface
+type LinkCodeStore interface {
+	AddLinkCode(code *LinkCode, ttl time.Duration) (bool, error)
+	ConsumeLinkCode(code string) (*LinkCode, error)
+}
+
+// linkCodeKey - The Redis key for a link code
+func linkCodeKey(code string) string {
+	return "link_code:" + code
+}
+
+// AddLinkCode stores a link code, returns false if the code is already in use
+func (s *store) AddLinkCode(code *LinkCode, ttl time.Duration) (bool, error) {
+	data, err := json.Marshal(code)
+	if err != nil {
+		return false, err
+	}
+	return s.rdb.SetNX(context.Background(), linkCodeKey(code.Code), data, ttl).Result()
+}
+
+// ConsumeLinkCode gets a link code and removes it so it cannot be used again
+func (s *store) ConsumeLinkCode(code string) (*LinkCode, error) {
+	data, err := s.rdb.GetDel(context.Background(), linkCodeKey(code)).Bytes()
+	if err != nil {
+		return nil, err
+	}
+	var linkCode LinkCode
+	err = json.Unmarshal(data, &linkCode)
+	if err != nil {
+		return nil, err
+	}
+	return &linkCode, nil
+}
+
+// -------------- Service Accounts --------------
+
+// CREATE TABLE service_accounts (
+//   client_id BIGINT PRIMARY KEY NOT NULL,
+//   name TEXT NOT NULL,
+//   secret_hash TEXT NOT NULL,
+//   roles TEXT[] NOT NULL DEFAULT '{}',
+//   created_by BIGINT NOT NULL,
+//   last_used_at BIGINT NOT NULL DEFAULT 0,
+//   created_at timestamp with time zone default current_timestamp
+// );
+
+// ServiceAccountStore interface
+type ServiceAccountStore interface {
+	AddServiceAccountToDB(account *ServiceAccount) error
+	GetServiceAccountFromDB(clientID string) (*ServiceAccount, error)
+	GetServiceAccountsFromDB() ([]*ServiceAccount, error)
+	UpdateServiceAccountRolesInDB(clientID string, roles []string) error
+	UpdateServiceAccountLastUsed(clientID string, lastUsedAt int64) error
+	DeleteServiceAccountFromDB(clientID string) error
+	AddServiceAccountSession(clientID string, sessionID string, ttl time.Duration) error
+	PopServiceAccountSessions(clientID string) ([]string, error)
+}
+
+// AddServiceAccountToDB adds a service account to the database
+func (s *store) AddServiceAccountToDB(account *ServiceAccount) error {
+	_, err := s.db.Exec(context.Background(),
+		"INSERT INTO service_accounts (client_id, name, secret_hash, roles, created_by) VALUES ($1, $2, $3, $4, $5)",
+		account.ClientID, account.Name, account.SecretHash, account.Roles, account.CreatedBy,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetServiceAccountFromDB gets a service account by client ID
+func (s *store) GetServiceAccountFromDB(clientID string) (*ServiceAccount, error) {
+	rows, err := s.db.Query(context.Background(), "SELECT * FROM service_accounts WHERE client_id = $1", clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[ServiceAccount])
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// GetServiceAccountsFromDB gets every service account
+func (s *store) GetServiceAccountsFromDB() ([]*ServiceAccount, error) {
+	rows, err := s.db.Query(context.Background(), "SELECT * FROM service_accounts ORDER BY created_at")
+	if err != nil {
+		return nil, err
+	}
+
+	accounts, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[ServiceAccount])
+	if err != nil {
+		return nil, err
+	}
+	return accounts, nil
+}
+
+// UpdateServiceAccountRolesInDB replaces a service account's roles
+func (s *store) UpdateServiceAccountRolesInDB(clientID string, roles []string) error {
+	tag, err := s.db.Exec(context.Background(), "UPDATE service_accounts SET roles = $2 WHERE client_id = $1", clientID, roles)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// UpdateServiceAccountLastUsed records when a service account last signed in
+func (s *store) UpdateServiceAccountLastUsed(clientID string, lastUsedAt int64) error {
+	_, err := s.db.Exec(context.Background(), "UPDATE service_accounts SET last_used_at = $2 WHERE client_id = $1", clientID, lastUsedAt)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// DeleteServiceAccountFromDB deletes a service account
+func (s *store) DeleteServiceAccountFromDB(clientID string) error {
+	tag, err := s.db.Exec(context.Background(), "DELETE FROM service_accounts WHERE client_id = $1", clientID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// serviceAccountSessionsKey - The Redis key for the sessions a service account currently has
+func serviceAccountSessionsKey(clientID string) string {
+	return "service_account_sessions:" + clientID
+}
+
+// AddServiceAccountSession records a service account's session so it can be revoked with the account
+// The set lives as long as the newest session in it
+func (s *store) AddServiceAccountSession(clientID string, sessionID string, ttl time.Duration) error {
+	key := serviceAccountSessionsKey(clientID)
+	_, err := s.rdb.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		pipe.SAdd(context.Background(), key, sessionID)
+		pipe.Expire(context.Background(), key, ttl)
+		return nil
+	})
+	return err
+}
+
+// PopServiceAccountSessions removes and returns every session recorded for a service account
+func (s *store) PopServiceAccountSessions(clientID string) ([]string, error) {
+	key := serviceAccountSessionsKey(clientID)
+	var members *redis.StringSliceCmd
+	_, err := s.rdb.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		members = pipe.SMembers(context.Background(), key)
+		pipe.Del(context.Background(), key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return members.Val(), nil
+}
+
+// -------------- Login Lockout --------------
+
+// LockoutStore interface
+type LockoutStore interface {
+	IncrementLoginFailures(userID string, window time.Duration) (int, error)
+	SetLoginLock(userID string, ttl time.Duration) error
+	GetLoginLock(userID string) (time.Duration, error)
+	ClearLoginFailures(userID string) error
+}
+
+// IncrementLoginFailures counts a failed login, the count is forgotten once window passes without another failure
+func (s *store) IncrementLoginFailures(userID string, window time.Duration) (int, error) {
+	var incr *redis.IntCmd
+	_, err := s.rdb.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(context.Background(), "login_failures:"+userID)
+		pipe.Expire(context.Background(), "login_failures:"+userID, window)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(incr.Val()), nil
+}
+
+// SetLoginLock locks an account's logins until ttl passes
+func (s *store) SetLoginLock(userID string, ttl time.Duration) error {
+	_, err := s.rdb.Set(context.Background(), "login_lock:"+userID, 1, ttl).Result()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetLoginLock gets how much longer an account's logins are locked for, zero if they aren't
+func (s *store) GetLoginLock(userID string) (time.Duration, error) {
+	ttl, err := s.rdb.PTTL(context.Background(), "login_lock:"+userID).Result()
+	if err != nil {
+		return 0, err
+	}
+	// Negative TTLs mean the key doesn't exist or has no expiry
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// ClearLoginFailures removes an account's failed logins and any lock on it
+func (s *store) ClearLoginFailures(userID string) error {
+	_, err := s.rdb.Del(context.Background(), "login_failures:"+userID, "login_lock:"+userID).Result()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// -------------- Auth Events --------------
+
+// CREATE TABLE auth_events (
+//   event_id BIGINT PRIMARY KEY NOT NULL,
+//   user_id BIGINT NOT NULL,
+//   type TEXT NOT NULL,
+//   detail TEXT NOT NULL DEFAULT '',
+//   ip_address TEXT NOT NULL DEFAULT '',
+//   user_agent TEXT NOT NULL DEFAULT '',
+//   created_at timestamp with time zone default current_timestamp,
+//   FOREIGN KEY (user_id) REFERENCES accounts(user_id) ON DELETE CASCADE
+// );
+// CREATE INDEX auth_events_user_id_idx ON auth_events (user_id, created_at DESC);
+
+// AuthEventStore interface
+type AuthEventStore interface {
+	AddAuthEventToDB(event *AuthEvent) error
+	GetAuthEventsFromDB(userID string, limit int) ([]*AuthEvent, error)
+}
+
+// AddAuthEventToDB adds an auth event to the database
+func (s *store) AddAuthEventToDB(event *AuthEvent) error {
+	_, err := s.db.Exec(context.Background(),
+		"INSERT INTO auth_events (event_id, user_id, type, detail, ip_address, user_agent) VALUES ($1, $2, $3, $4, $5, $6)",
+		event.EventID, event.UserID, event.Type, event.Detail, event.IPAddress, event.UserAgent,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetAuthEventsFromDB gets a user's most recent auth events
+func (s *store) GetAuthEventsFromDB(userID string, limit int) ([]*AuthEvent, error) {
+	rows, err := s.db.Query(context.Background(), "SELECT * FROM auth_events WHERE user_id = $1 ORDER BY created_at DESC LIMIT $2", userID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[AuthEvent])
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -2,11 +2,15 @@ package auth
 
 import (
 	"crypto/rand"
+	"errors"
 	perms "github.com/NeuralNexusDev/neuralnexus-api/modules/auth/permissions"
 	"github.com/NeuralNexusDev/neuralnexus-api/modules/database"
 
 	"log"
+	"net/mail"
 	"os"
+	"slices"
+	"strings"
 	"time"
 
 	_ "unsafe"
@@ -18,13 +22,78 @@ var pepper = []byte(os.Getenv("PEPPER"))
 
 // Account struct
 type Account struct {
-	UserID       string    `db:"user_id" validate:"required" json:"user_id" xml:"user_id"`
-	Username     string    `db:"username" json:"username" xml:"username"`
-	Email        string    `db:"email" json:"-" xml:"-"`
-	HashedSecret []byte    `db:"hashed_secret" json:"-" xml:"-"`
-	Salt         []byte    `db:"salt" json:"-" xml:"-"`
-	Roles        []string  `db:"roles" json:"roles" xml:"roles"`
-	UpdatedAt    time.Time `db:"updated_at" json:"updated_at" xml:"updated_at"`
+	UserID        string    `db:"user_id" validate:"required" json:"user_id" xml:"user_id"`
+	Username      string    `db:"username" json:"username" xml:"username"`
+	Email         string    `db:"email" json:"-" xml:"-"`
+	HashedSecret  []byte    `db:"hashed_secret" json:"-" xml:"-"`
+	Salt          []byte    `db:"salt" json:"-" xml:"-"`
+	Roles         []string  `db:"roles" json:"roles" xml:"roles"`
+	EmailVerified bool      `db:"email_verified" json:"email_verified" xml:"email_verified"`
+	UpdatedAt     time.Time `db:"updated_at" json:"updated_at" xml:"updated_at"`
+}
+
+const (
+	usernameMinLength = 3
+	usernameMaxLength = 32
+)
+
+// usernameRune checks if a character may be used in a username
+func usernameRune(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-' || c == '.'
+}
+
+// ValidateUsername checks that a username is usable for a password account
+func ValidateUsername(username string) error {
+	if len(username) < usernameMinLength || len(username) > usernameMaxLength {
+		return errors.New("username must be between 3 and 32 characters")
+	}
+	for _, c := range username {
+		if !usernameRune(c) {
+			return errors.New("username may only contain letters, numbers, '_', '-' and '.'")
+		}
+	}
+	return nil
+}
+
+// PlatformUsername turns a platform's name for a user into a valid username
+// Platforms like Google give a display name, which can have spaces and other characters usernames can't
+func PlatformUsername(name string) string {
+	username := make([]rune, 0, usernameMaxLength)
+	for _, c := range name {
+		if len(username) == usernameMaxLength {
+			break
+		}
+		if c == ' ' {
+			c = '_'
+		}
+		if usernameRune(c) {
+			username = append(username, c)
+		}
+	}
+	if len(username) < usernameMinLength {
+		return "user" + string(username)
+	}
+	return string(username)
+}
+
+// ValidateEmail checks that an email address is well-formed
+func ValidateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return errors.New("invalid email address")
+	}
+	return nil
+}
+
+// ValidatePassword checks that a password meets the minimum requirements
+func ValidatePassword(password string) error {
+	if len(password) < 8 {
+		return errors.New("password must be at least 8 characters")
+	}
+	if len(password) > 256 {
+		return errors.New("password must be at most 256 characters")
+	}
+	return nil
 }
 
 // NewAccount creates a new account
@@ -120,20 +189,43 @@ func (user *Account) RemoveRole(role string) {
 
 // -------------- Session --------------
 
-// NewSession creates a new session
-func (user *Account) NewSession(expiresAt int64) (*Session, error) {
+// Permissions resolves the account's roles into the permissions a session carries
+// Roles come from the cache kept in sync with the database by the RoleService
+func (user *Account) Permissions() []string {
+	return rolePermissions(user.Roles)
+}
+
+// rolePermissions gets every permission granted by a set of roles
+func rolePermissions(roles []string) []string {
 	var permissions []string
-	for _, r := range user.Roles {
+	for _, r := range roles {
 		role, err := perms.GetRoleByName(r)
 		if err != nil {
 			log.Println(err)
 			continue
 		}
 		for _, p := range role.Permissions {
-			permissions = append(permissions, p.Name+"|"+p.Value)
+			if !slices.Contains(permissions, p.String()) {
+				permissions = append(permissions, p.String())
+			}
 		}
 	}
+	return permissions
+}
 
+// GrantedPermissions narrows the scopes granted to an OIDC client to the permissions the user still holds
+func GrantedPermissions(scopes []string, held []string) []string {
+	granted := []string{}
+	for _, p := range scopes {
+		if strings.HasPrefix(p, "oidc:") || perms.HasPermission(held, p) {
+			granted = append(granted, p)
+		}
+	}
+	return granted
+}
+
+// NewSession creates a new session
+func (user *Account) NewSession(expiresAt int64) (*Session, error) {
 	id, err := database.GenSnowflake()
 	if err != nil {
 		return nil, err
@@ -141,7 +233,7 @@ func (user *Account) NewSession(expiresAt int64) (*Session, error) {
 	return &Session{
 		ID:          id,
 		UserID:      user.UserID,
-		Permissions: permissions,
+		Permissions: user.Permissions(),
 		IssuedAt:    time.Now().Unix(),
 		LastUsedAt:  time.Now().Unix(),
 		ExpiresAt:   expiresAt,
@@ -152,15 +244,17 @@ func (user *Account) NewSession(expiresAt int64) (*Session, error) {
 
 // -------------- Structs --------------
 
-// LinkedAccount struct
+// LinkedAccount struct, Verified is set when the user signed in to the platform account to link it.
+// Links made with a link code are only vouched for by whoever redeemed the code, so they can't be used to sign in
 type LinkedAccount struct {
-	UserID           string      `db:"user_id" validate:"required"`
-	Platform         Platform    `db:"platform" validate:"required"`
-	PlatformUsername string      `db:"platform_username" validate:"required_without=GetID"`
-	PlatformID       string      `db:"platform_id" validate:"required_without=GetUsername"`
-	Data             interface{} `db:"data" validate:"required"`
-	DataUpdatedAt    time.Time   `db:"updated_at"`
-	CreatedAt        time.Time   `db:"created_at"`
+	UserID           string      `db:"user_id" validate:"required" json:"user_id" xml:"user_id"`
+	Platform         Platform    `db:"platform" validate:"required" json:"platform" xml:"platform"`
+	PlatformUsername string      `db:"platform_username" validate:"required_without=GetID" json:"platform_username" xml:"platform_username"`
+	PlatformID       string      `db:"platform_id" validate:"required_without=GetUsername" json:"platform_id" xml:"platform_id"`
+	Data             interface{} `db:"data" validate:"required" json:"-" xml:"-"`
+	Verified         bool        `db:"verified" json:"verified" xml:"verified"`
+	DataUpdatedAt    time.Time   `db:"updated_at" json:"updated_at" xml:"updated_at"`
+	CreatedAt        time.Time   `db:"created_at" json:"created_at" xml:"created_at"`
 }
 
 // NewLinkedAccount creates a new linked account
@@ -171,6 +265,7 @@ func NewLinkedAccount(userID string, platform Platform, platformUsername, platfo
 		PlatformUsername: platformUsername,
 		PlatformID:       platformID,
 		Data:             data,
+		Verified:         true,
 	}
 }
 
@@ -189,6 +284,11 @@ type Platform string
 
 var (
 	PlatformDiscord   Platform = "discord"
+	PlatformGitHub    Platform = "github"
+	PlatformGoogle    Platform = "google"
 	PlatformMinecraft Platform = "minecraft"
 	PlatformTwitch    Platform = "twitch"
 )
+
+// LoginPlatforms - Platforms that can be used to log in, not just linked
+var LoginPlatforms = []Platform{PlatformDiscord, PlatformTwitch, PlatformMinecraft, PlatformGitHub, PlatformGoogle}
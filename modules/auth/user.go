@@ -1,10 +1,20 @@
 package auth
 
 import (
-	"log"
+	"errors"
+	"slices"
 	"time"
 
-	perms "github.com/NeuralNexusDev/neuralnexus-api/modules/auth/permissions"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrLastLoginMethod        = errors.New("cannot unlink the only way left to log in to this account")
+	ErrLinkedToAnotherAccount = errors.New("platform account already linked to another account")
+	ErrPlatformAlreadyLinked  = errors.New("a different account on this platform is already linked")
+	ErrMergeSameAccount       = errors.New("cannot merge an account into itself")
+	ErrMergePlatformConflict  = errors.New("both accounts have an account on the same platform linked, unlink one of them first")
+	ErrAccountMerged          = errors.New("account has been merged into another account")
 )
 
 // UserService - The userService interface
@@ -16,21 +26,32 @@ type UserService interface {
 	UpdateUser(user *Account) error
 	UpdateUserFromPlatform(platform Platform, platformID string, data PlatformData) (*Account, error)
 	DeleteUser(userID string) error
+	GetLinkedAccounts(userID string) ([]*LinkedAccount, error)
+	UnlinkAccount(userID string, platform Platform) error
+	MergeUsers(intoID string, fromID string) (*Account, error)
 }
 
 // userService - The userService struct
 type userService struct {
 	as  AccountStore
 	als LinkAccountStore
+	ws  WebAuthnStore
+	ss  SessionStore
 }
 
 // NewUserService - Create a new userService
 func NewUserService(store Store) UserService {
-	return &userService{store.Account(), store.LinkAccount()}
+	return &userService{store.Account(), store.LinkAccount(), store.WebAuthn(), store.Session()}
 }
 
 // GetUser - Get a user by their ID
+// Merged accounts resolve to the account they were merged into
 func (s *userService) GetUser(userID string) (*Account, error) {
+	if toUserID, err := s.as.GetAccountRedirect(userID); err == nil {
+		userID = toUserID
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
 	return s.as.GetAccountByID(userID)
 }
 
@@ -49,18 +70,7 @@ func (s *userService) GetUserPermissions(userID string) ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
-	var permissions []string
-	for _, r := range a.Roles {
-		role, err := perms.GetRoleByName(r)
-		if err != nil {
-			log.Println(err)
-			continue
-		}
-		for _, p := range role.Permissions {
-			permissions = append(permissions, p.Name+"|"+p.Value)
-		}
-	}
-	return permissions, nil
+	return a.Permissions(), nil
 }
 
 // UpdateUser - Update a user
@@ -99,6 +109,7 @@ func (s *userService) UpdateUserFromPlatform(platform Platform, platformID strin
 			Platform:      platform,
 			PlatformID:    platformID,
 			Data:          data,
+			Verified:      true,
 			DataUpdatedAt: time.Now(),
 			CreatedAt:     time.Now(),
 		}
@@ -126,3 +137,96 @@ func (s *userService) UpdateUserFromPlatform(platform Platform, platformID strin
 func (s *userService) DeleteUser(userID string) error {
 	return s.as.DeleteAccountFromDB(userID)
 }
+
+// GetLinkedAccounts - Get the platform accounts linked to a user
+func (s *userService) GetLinkedAccounts(userID string) ([]*LinkedAccount, error) {
+	return s.als.GetLinkedAccountsByUserID(userID)
+}
+
+// UnlinkAccount - Unlink a platform account, refusing if it is the last way the user can log in
+func (s *userService) UnlinkAccount(userID string, platform Platform) error {
+	account, err := s.as.GetAccountByID(userID)
+	if err != nil {
+		return err
+	}
+	linked, err := s.als.GetLinkedAccountsByUserID(userID)
+	if err != nil {
+		return err
+	}
+	idx := slices.IndexFunc(linked, func(la *LinkedAccount) bool { return la.Platform == platform })
+	if idx == -1 {
+		return pgx.ErrNoRows
+	}
+
+	if slices.Contains(LoginPlatforms, platform) {
+		loginMethods := 0
+		if len(account.HashedSecret) > 0 {
+			loginMethods++
+		}
+		creds, err := s.ws.GetWebAuthnCredentials(userID)
+		if err != nil {
+			return err
+		}
+		if len(creds) > 0 {
+			loginMethods++
+		}
+		for i, la := range linked {
+			if i != idx && slices.Contains(LoginPlatforms, la.Platform) {
+				loginMethods++
+			}
+		}
+		if loginMethods == 0 {
+			return ErrLastLoginMethod
+		}
+	}
+	return s.als.DeleteLinkedAccount(userID, platform)
+}
+
+// LinkPlatformAccount links a platform account to a user, refreshing its data if the user already has it linked
+func LinkPlatformAccount(las LinkAccountStore, la *LinkedAccount) error {
+	existing, err := las.GetLinkedAccountByPlatformID(la.Platform, la.PlatformID)
+	if err == nil && existing.UserID != la.UserID {
+		if existing.Verified || !la.Verified {
+			return ErrLinkedToAnotherAccount
+		}
+		// Signing in to the platform account proves who owns it, so it's taken from a link that was only made with a code
+		err = las.DeleteLinkedAccount(existing.UserID, existing.Platform)
+		if err != nil {
+			return err
+		}
+	} else if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	existing, err = las.GetLinkedAccountByUserID(la.UserID, la.Platform)
+	if err == nil {
+		if existing.PlatformID != la.PlatformID {
+			return ErrPlatformAlreadyLinked
+		}
+		// A link code can't replace the data of a link the user already signed in to the platform for
+		if existing.Verified && !la.Verified {
+			*la = *existing
+			return nil
+		}
+		return las.UpdateLinkedAccount(la)
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	return las.AddLinkedAccountToDB(la)
+}
+
+// MergeUsers moves everything owned by one user onto another, both users must have signed in first
+// The merged user's sessions are revoked and its ID redirects to the user it was merged into
+func (s *userService) MergeUsers(intoID string, fromID string) (*Account, error) {
+	if intoID == fromID {
+		return nil, ErrMergeSameAccount
+	}
+	sessionIDs, err := s.as.MergeAccountsInDB(intoID, fromID)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range sessionIDs {
+		s.ss.DeleteSessionFromCache(id)
+	}
+	return s.as.GetAccountByID(intoID)
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// memLinkAccountStore - LinkAccountStore backed by memory, keyed by user and platform
+type memLinkAccountStore struct {
+	LinkAccountStore
+	links map[string]*LinkedAccount
+}
+
+func (s *memLinkAccountStore) AddLinkedAccountToDB(la *LinkedAccount) error {
+	stored := *la
+	s.links[la.UserID+":"+string(la.Platform)] = &stored
+	return nil
+}
+
+func (s *memLinkAccountStore) UpdateLinkedAccount(la *LinkedAccount) error {
+	return s.AddLinkedAccountToDB(la)
+}
+
+func (s *memLinkAccountStore) GetLinkedAccountByPlatformID(platform Platform, platformID string) (*LinkedAccount, error) {
+	for _, la := range s.links {
+		if la.Platform == platform && la.PlatformID == platformID {
+			found := *la
+			return &found, nil
+		}
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (s *memLinkAccountStore) GetLinkedAccountByUserID(userID string, platform Platform) (*LinkedAccount, error) {
+	la, ok := s.links[userID+":"+string(platform)]
+	if !ok {
+		return nil, pgx.ErrNoRows
+	}
+	found := *la
+	return &found, nil
+}
+
+func (s *memLinkAccountStore) DeleteLinkedAccount(userID string, platform Platform) error {
+	delete(s.links, userID+":"+string(platform))
+	return nil
+}
+
+func codeLink(userID string) *LinkedAccount {
+	return &LinkedAccount{UserID: userID, Platform: PlatformMinecraft, PlatformID: "uuid", PlatformUsername: "Notch"}
+}
+
+func signInLink(userID string) *LinkedAccount {
+	return &LinkedAccount{UserID: userID, Platform: PlatformMinecraft, PlatformID: "uuid", PlatformUsername: "Notch", Verified: true}
+}
+
+func TestLinkPlatformAccountVerified(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing *LinkedAccount
+		link     *LinkedAccount
+		wantErr  error
+		wantUser string
+		verified bool
+	}{
+		{"sign in takes over a code link", codeLink("attacker"), signInLink("owner"), nil, "owner", true},
+		{"code can't take over a sign in link", signInLink("owner"), codeLink("attacker"), ErrLinkedToAnotherAccount, "owner", true},
+		{"code can't take over a code link", codeLink("first"), codeLink("second"), ErrLinkedToAnotherAccount, "first", false},
+		{"sign in verifies the user's own code link", codeLink("owner"), signInLink("owner"), nil, "owner", true},
+		{"code keeps the user's own sign in link verified", signInLink("owner"), codeLink("owner"), nil, "owner", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			las := &memLinkAccountStore{links: map[string]*LinkedAccount{}}
+			las.AddLinkedAccountToDB(tt.existing)
+
+			err := LinkPlatformAccount(las, tt.link)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			la, err := las.GetLinkedAccountByPlatformID(PlatformMinecraft, "uuid")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if la.UserID != tt.wantUser || la.Verified != tt.verified {
+				t.Errorf("linked to %q verified %v, want %q verified %v", la.UserID, la.Verified, tt.wantUser, tt.verified)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/NeuralNexusDev/neuralnexus-api/modules/email"
+)
+
+// -------------- Tokens --------------
+
+// TokenPurpose - What a one-time token can be redeemed for
+type TokenPurpose string
+
+const (
+	TokenPurposeVerifyEmail TokenPurpose = "verify_email"
+)
+
+// EmailVerificationTTL - How long an email verification link stays valid
+var EmailVerificationTTL = 24 * time.Hour
+
+// GenerateToken creates a random URL-safe token
+func GenerateToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken hashes a token so that it can be stored without exposing the original value
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// -------------- Service --------------
+
+// VerificationService - Email verification service interface
+type VerificationService interface {
+	SendVerificationEmail(account *Account) error
+	VerifyEmail(token string) (*Account, error)
+}
+
+// verificationService - VerificationService implementation
+type verificationService struct {
+	as     AccountStore
+	tokens OneTimeTokenStore
+	sender email.Sender
+}
+
+// NewVerificationService - Create a new email verification service
+func NewVerificationService(store Store, sender email.Sender) VerificationService {
+	return &verificationService{
+		as:     store.Account(),
+		tokens: store.OneTimeToken(),
+		sender: sender,
+	}
+}
+
+// SendVerificationEmail issues a single-use verification token and emails it to the account
+func (s *verificationService) SendVerificationEmail(account *Account) error {
+	if account.EmailVerified {
+		return errors.New("email already verified")
+	}
+	token, err := GenerateToken()
+	if err != nil {
+		return err
+	}
+	err = s.tokens.AddOneTimeToken(TokenPurposeVerifyEmail, token, account.UserID, EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	return s.sender.Send(&email.Message{
+		To:      account.Email,
+		Subject: "Verify your NeuralNexus account",
+		Body: "Hi " + account.Username + ",\n\n" +
+			"Please confirm your email address by opening the link below:\n\n" +
+			NN_SITE_URL + "/verify-email?token=" + token + "\n\n" +
+			"This link expires in 24 hours. If you did not create an account you can ignore this email.\n",
+	})
+}
+
+// VerifyEmail redeems a verification token and marks the account as verified
+func (s *verificationService) VerifyEmail(token string) (*Account, error) {
+	userID, err := s.tokens.ConsumeOneTimeToken(TokenPurposeVerifyEmail, token)
+	if err != nil {
+		return nil, errors.New("invalid or expired token")
+	}
+	account, err := s.as.GetAccountByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	account.EmailVerified = true
+	err = s.as.UpdateAccountInDB(account)
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
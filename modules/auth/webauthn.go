@@ -0,0 +1,306 @@
+package auth
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// -------------- Globals --------------
+
+//goland:noinspection GoSnakeCaseUsage
+var (
+	// WEBAUTHN_RP_ID relying party ID, defaults to the host of NN_SITE_URL
+	WEBAUTHN_RP_ID = os.Getenv("WEBAUTHN_RP_ID")
+	// WEBAUTHN_RP_ORIGINS comma separated list of allowed origins, defaults to NN_SITE_URL
+	WEBAUTHN_RP_ORIGINS = os.Getenv("WEBAUTHN_RP_ORIGINS")
+	// WEBAUTHN_RP_NAME name shown by the browser when creating a passkey
+	WEBAUTHN_RP_NAME = os.Getenv("WEBAUTHN_RP_NAME")
+)
+
+const (
+	TokenPurposeWebAuthnRegister TokenPurpose = "webauthn_register"
+	TokenPurposeWebAuthnLogin    TokenPurpose = "webauthn_login"
+)
+
+// WebAuthnChallengeTTL - How long a user has to complete a WebAuthn ceremony
+var WebAuthnChallengeTTL = 5 * time.Minute
+
+var (
+	ErrWebAuthnDisabled       = errors.New("webauthn is not configured")
+	ErrWebAuthnChallenge      = errors.New("invalid or expired challenge")
+	ErrWebAuthnCredential     = errors.New("invalid credential")
+	ErrWebAuthnCredentialUsed = errors.New("credential is already registered")
+)
+
+// -------------- Structs --------------
+
+// WebAuthnCredential struct
+type WebAuthnCredential struct {
+	ID         string              `json:"id" xml:"id" db:"credential_id"`
+	UserID     string              `json:"user_id" xml:"user_id" db:"user_id"`
+	Name       string              `json:"name" xml:"name" db:"name"`
+	Credential webauthn.Credential `json:"-" xml:"-" db:"credential"`
+	CreatedAt  time.Time           `json:"created_at" xml:"created_at" db:"created_at"`
+	LastUsedAt *time.Time          `json:"last_used_at,omitempty" xml:"last_used_at,omitempty" db:"last_used_at"`
+}
+
+// WebAuthnChallenge struct returned when a ceremony is started, the options are passed to the browser as-is
+type WebAuthnChallenge struct {
+	ChallengeID string `json:"challenge_id" xml:"challenge_id"`
+	Options     any    `json:"options" xml:"-"`
+}
+
+// webAuthnUser - Adapts an account and its credentials to the webauthn.User interface
+type webAuthnUser struct {
+	account     *Account
+	credentials []webauthn.Credential
+}
+
+// WebAuthnID the user handle, which is the account's user ID
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return []byte(u.account.UserID)
+}
+
+// WebAuthnName the name the passkey is stored under
+func (u *webAuthnUser) WebAuthnName() string {
+	if u.account.Username != "" {
+		return u.account.Username
+	}
+	if u.account.Email != "" {
+		return u.account.Email
+	}
+	return u.account.UserID
+}
+
+// WebAuthnDisplayName the name shown in the browser's passkey picker
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return u.WebAuthnName()
+}
+
+// WebAuthnCredentials the user's registered credentials
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+// -------------- Service --------------
+
+// WebAuthnService - WebAuthn passkey service interface
+type WebAuthnService interface {
+	BeginRegistration(account *Account) (*WebAuthnChallenge, error)
+	FinishRegistration(account *Account, challengeID, name string, response []byte) (*WebAuthnCredential, error)
+	BeginLogin() (*WebAuthnChallenge, error)
+	FinishLogin(challengeID string, response []byte) (*Account, error)
+	GetCredentials(userID string) ([]*WebAuthnCredential, error)
+	DeleteCredential(userID, credentialID string) error
+}
+
+// webAuthnService - WebAuthnService implementation
+type webAuthnService struct {
+	wa    *webauthn.WebAuthn
+	as    AccountStore
+	store WebAuthnStore
+}
+
+// NewWebAuthnService - Create a new WebAuthn service
+func NewWebAuthnService(store Store) WebAuthnService {
+	wa, err := webauthn.New(webAuthnConfig())
+	if err != nil {
+		log.Println("WebAuthn is not configured, passkeys are disabled:\n\t", err)
+	}
+	return &webAuthnService{
+		wa:    wa,
+		as:    store.Account(),
+		store: store.WebAuthn(),
+	}
+}
+
+// webAuthnConfig builds the relying party config from the environment
+func webAuthnConfig() *webauthn.Config {
+	rpID := WEBAUTHN_RP_ID
+	if rpID == "" {
+		if u, err := url.Parse(NN_SITE_URL); err == nil {
+			rpID = u.Hostname()
+		}
+	}
+	origins := []string{NN_SITE_URL}
+	if WEBAUTHN_RP_ORIGINS != "" {
+		origins = strings.Split(WEBAUTHN_RP_ORIGINS, ",")
+	}
+	name := WEBAUTHN_RP_NAME
+	if name == "" {
+		name = "NeuralNexus"
+	}
+	return &webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: name,
+		RPOrigins:     origins,
+	}
+}
+
+// loadUser gets an account's credentials in the form the webauthn library expects
+func (s *webAuthnService) loadUser(account *Account) (*webAuthnUser, error) {
+	creds, err := s.store.GetWebAuthnCredentials(account.UserID)
+	if err != nil {
+		return nil, err
+	}
+	user := &webAuthnUser{account: account}
+	for _, c := range creds {
+		user.credentials = append(user.credentials, c.Credential)
+	}
+	return user, nil
+}
+
+// BeginRegistration starts registering a new passkey, existing credentials are excluded so they aren't registered twice
+func (s *webAuthnService) BeginRegistration(account *Account) (*WebAuthnChallenge, error) {
+	if s.wa == nil {
+		return nil, ErrWebAuthnDisabled
+	}
+	user, err := s.loadUser(account)
+	if err != nil {
+		return nil, err
+	}
+	options, session, err := s.wa.BeginRegistration(user,
+		webauthn.WithExclusions(webauthn.Credentials(user.credentials).CredentialDescriptors()),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return s.newChallenge(TokenPurposeWebAuthnRegister, session, options)
+}
+
+// FinishRegistration verifies the authenticator's response and stores the new credential
+func (s *webAuthnService) FinishRegistration(account *Account, challengeID, name string, response []byte) (*WebAuthnCredential, error) {
+	if s.wa == nil {
+		return nil, ErrWebAuthnDisabled
+	}
+	session, err := s.store.ConsumeWebAuthnChallenge(TokenPurposeWebAuthnRegister, challengeID)
+	if err != nil || !bytes.Equal(session.UserID, []byte(account.UserID)) {
+		return nil, ErrWebAuthnChallenge
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		return nil, ErrWebAuthnCredential
+	}
+	user, err := s.loadUser(account)
+	if err != nil {
+		return nil, err
+	}
+	credential, err := s.wa.CreateCredential(user, *session, parsed)
+	if err != nil {
+		return nil, ErrWebAuthnCredential
+	}
+
+	id := protocol.URLEncodedBase64(credential.ID).String()
+	if _, err = s.store.GetWebAuthnCredential(id); err == nil {
+		return nil, ErrWebAuthnCredentialUsed
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "Passkey"
+	}
+	wc := &WebAuthnCredential{
+		ID:         id,
+		UserID:     account.UserID,
+		Name:       name,
+		Credential: *credential,
+		CreatedAt:  time.Now(),
+	}
+	err = s.store.AddWebAuthnCredential(wc)
+	if err != nil {
+		return nil, err
+	}
+	return wc, nil
+}
+
+// BeginLogin starts a passkey login, the browser offers any discoverable credential for this site
+func (s *webAuthnService) BeginLogin() (*WebAuthnChallenge, error) {
+	if s.wa == nil {
+		return nil, ErrWebAuthnDisabled
+	}
+	options, session, err := s.wa.BeginDiscoverableLogin()
+	if err != nil {
+		return nil, err
+	}
+	return s.newChallenge(TokenPurposeWebAuthnLogin, session, options)
+}
+
+// FinishLogin verifies a passkey assertion and returns the account it belongs to
+func (s *webAuthnService) FinishLogin(challengeID string, response []byte) (*Account, error) {
+	if s.wa == nil {
+		return nil, ErrWebAuthnDisabled
+	}
+	session, err := s.store.ConsumeWebAuthnChallenge(TokenPurposeWebAuthnLogin, challengeID)
+	if err != nil {
+		return nil, ErrWebAuthnChallenge
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return nil, ErrWebAuthnCredential
+	}
+
+	var account *Account
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		a, err := s.as.GetAccountByID(string(userHandle))
+		if err != nil {
+			return nil, err
+		}
+		account = a
+		return s.loadUser(a)
+	}
+	_, credential, err := s.wa.ValidatePasskeyLogin(handler, *session, parsed)
+	if err != nil || account == nil {
+		return nil, ErrWebAuthnCredential
+	}
+	// A counter that went backwards means the authenticator may have been cloned
+	if credential.Authenticator.CloneWarning {
+		return nil, ErrWebAuthnCredential
+	}
+
+	wc, err := s.store.GetWebAuthnCredential(protocol.URLEncodedBase64(credential.ID).String())
+	if err != nil || wc.UserID != account.UserID {
+		return nil, ErrWebAuthnCredential
+	}
+	now := time.Now()
+	wc.Credential = *credential
+	wc.LastUsedAt = &now
+	err = s.store.UpdateWebAuthnCredential(wc)
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// GetCredentials lists a user's passkeys
+func (s *webAuthnService) GetCredentials(userID string) ([]*WebAuthnCredential, error) {
+	return s.store.GetWebAuthnCredentials(userID)
+}
+
+// DeleteCredential removes one of a user's passkeys
+func (s *webAuthnService) DeleteCredential(userID, credentialID string) error {
+	return s.store.DeleteWebAuthnCredential(userID, credentialID)
+}
+
+// newChallenge stores the ceremony's session data in the cache under a random ID
+func (s *webAuthnService) newChallenge(purpose TokenPurpose, session *webauthn.SessionData, options any) (*WebAuthnChallenge, error) {
+	id, err := GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+	err = s.store.AddWebAuthnChallenge(purpose, id, session, WebAuthnChallengeTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &WebAuthnChallenge{
+		ChallengeID: id,
+		Options:     options,
+	}, nil
+}
@@ -5,9 +5,6 @@ import (
 	"net/http"
 	"strconv"
 
-	mw "github.com/NeuralNexusDev/neuralnexus-api/middleware"
-	"github.com/NeuralNexusDev/neuralnexus-api/modules/auth"
-	perms "github.com/NeuralNexusDev/neuralnexus-api/modules/auth/permissions"
 	"github.com/NeuralNexusDev/neuralnexus-api/responses"
 )
 
@@ -27,12 +24,6 @@ func GetBeeNameHandler(s BNGStore) http.HandlerFunc {
 // UploadBeeNameHandler Upload a bee name
 func UploadBeeNameHandler(s BNGStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		session := r.Context().Value(mw.SessionKey).(*auth.Session)
-		if !session.HasPermission(perms.ScopeAdminBeeNameGenerator) {
-			responses.Forbidden(w, r, "You do not have permission to upload bee names")
-			return
-		}
-
 		beeName := r.PathValue("name")
 		if beeName == "" {
 			responses.BadRequest(w, r, "Invalid name")
@@ -52,12 +43,6 @@ func UploadBeeNameHandler(s BNGStore) http.HandlerFunc {
 // DeleteBeeNameHandler Delete a bee name
 func DeleteBeeNameHandler(s BNGStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		session := r.Context().Value(mw.SessionKey).(*auth.Session)
-		if !session.HasPermission(perms.ScopeAdminBeeNameGenerator) {
-			responses.Forbidden(w, r, "You do not have permission to delete bee names")
-			return
-		}
-
 		beeName := r.PathValue("name")
 		if beeName == "" {
 			responses.BadRequest(w, r, "Invalid name")
@@ -96,12 +81,6 @@ func SubmitBeeNameHandler(s BNGStore) http.HandlerFunc {
 // GetBeeNameSuggestionsHandler Get a list of bee name suggestions
 func GetBeeNameSuggestionsHandler(s BNGStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		session := r.Context().Value(mw.SessionKey).(*auth.Session)
-		if !session.HasPermission(perms.ScopeAdminBeeNameGenerator) {
-			responses.Forbidden(w, r, "You do not have permission to get bee name suggestions")
-			return
-		}
-
 		amount := r.PathValue("amount")
 		if amount == "" || amount == "0" {
 			amount = "NAN"
@@ -125,12 +104,6 @@ func GetBeeNameSuggestionsHandler(s BNGStore) http.HandlerFunc {
 // AcceptBeeNameSuggestionHandler Accept a bee name suggestion
 func AcceptBeeNameSuggestionHandler(s BNGStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		session := r.Context().Value(mw.SessionKey).(*auth.Session)
-		if !session.HasPermission(perms.ScopeAdminBeeNameGenerator) {
-			responses.Forbidden(w, r, "You do not have permission to accept bee name suggestions")
-			return
-		}
-
 		beeName := r.PathValue("name")
 		if beeName == "" {
 			responses.BadRequest(w, r, "Invalid name")
@@ -150,12 +123,6 @@ func AcceptBeeNameSuggestionHandler(s BNGStore) http.HandlerFunc {
 // RejectBeeNameSuggestionHandler Reject a bee name suggestion
 func RejectBeeNameSuggestionHandler(s BNGStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		session := r.Context().Value(mw.SessionKey).(*auth.Session)
-		if !session.HasPermission(perms.ScopeAdminBeeNameGenerator) {
-			responses.Forbidden(w, r, "You do not have permission to reject bee name suggestions")
-			return
-		}
-
 		beeName := r.PathValue("name")
 		if beeName == "" {
 			responses.BadRequest(w, r, "Invalid name")
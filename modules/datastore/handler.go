@@ -5,8 +5,6 @@ import (
 	"net/http"
 
 	mw "github.com/NeuralNexusDev/neuralnexus-api/middleware"
-	"github.com/NeuralNexusDev/neuralnexus-api/modules/auth"
-	perms "github.com/NeuralNexusDev/neuralnexus-api/modules/auth/permissions"
 	"github.com/NeuralNexusDev/neuralnexus-api/modules/database"
 	"github.com/NeuralNexusDev/neuralnexus-api/responses"
 )
@@ -14,12 +12,7 @@ import (
 // CreateDataStoreHandler - Create a new data store
 func CreateDataStoreHandler(s DSService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		session := r.Context().Value(mw.SessionKey).(*auth.Session)
-		if !session.HasPermission(perms.ScopeAdminDataStore) {
-			responses.Forbidden(w, r, "You do not have permission to create a datastore")
-			return
-		}
-
+		session, _ := mw.GetSession(r.Context())
 		id, err := database.GenSnowflake()
 		if err != nil {
 			log.Println("Failed to generate snowflake:\n\t", err)
@@ -60,12 +53,6 @@ func ReadDataStoreHandler(s DSService) http.HandlerFunc {
 // UpdateDataStoreHandler - Update a data store
 func UpdateDataStoreHandler(s DSService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		session := r.Context().Value(mw.SessionKey).(*auth.Session)
-		if !session.HasPermission(perms.ScopeAdminDataStore) {
-			responses.Forbidden(w, r, "You do not have permission to update a datastore")
-			return
-		}
-
 		var ds *Store
 		err := responses.DecodeStruct(r, &ds)
 		if err != nil {
@@ -87,12 +74,6 @@ func UpdateDataStoreHandler(s DSService) http.HandlerFunc {
 // DeleteDataStoreHandler - Delete a data store
 func DeleteDataStoreHandler(s DSService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		session := r.Context().Value(mw.SessionKey).(*auth.Session)
-		if !session.HasPermission(perms.ScopeAdminDataStore) {
-			responses.Forbidden(w, r, "You do not have permission to delete a datastore")
-			return
-		}
-
 		var ds *Store
 		err := responses.DecodeStruct(r, &ds)
 		if err != nil {
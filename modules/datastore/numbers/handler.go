@@ -4,21 +4,12 @@ import (
 	"log"
 	"net/http"
 
-	mw "github.com/NeuralNexusDev/neuralnexus-api/middleware"
-	"github.com/NeuralNexusDev/neuralnexus-api/modules/auth"
-	perms "github.com/NeuralNexusDev/neuralnexus-api/modules/auth/permissions"
 	"github.com/NeuralNexusDev/neuralnexus-api/responses"
 )
 
 // CreateNumberHandler - Create a new number
 func CreateNumberHandler(s NumberService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		session := r.Context().Value(mw.SessionKey).(*auth.Session)
-		if !session.HasPermission(perms.ScopeAdminNumberStore) {
-			responses.Forbidden(w, r, "You do not have permission to create a numberstore")
-			return
-		}
-
 		var n *NumberData
 		err := responses.DecodeStruct(r, &n)
 		if err != nil {
@@ -61,12 +52,6 @@ func ReadNumberHandler(s NumberService) http.HandlerFunc {
 // UpdateNumberHandler - Update a number
 func UpdateNumberHandler(s NumberService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		session := r.Context().Value(mw.SessionKey).(*auth.Session)
-		if !session.HasPermission(perms.ScopeAdminNumberStore) {
-			responses.Forbidden(w, r, "You do not have permission to create a numberstore")
-			return
-		}
-
 		var n *NumberData
 		err := responses.DecodeStruct(r, &n)
 		if err != nil {
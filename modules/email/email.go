@@ -0,0 +1,121 @@
+package email
+
+import (
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+)
+
+// -------------- Globals --------------
+
+//goland:noinspection GoSnakeCaseUsage
+var (
+	SMTP_HOST     = os.Getenv("SMTP_HOST")
+	SMTP_PORT     = os.Getenv("SMTP_PORT")
+	SMTP_USERNAME = os.Getenv("SMTP_USERNAME")
+	SMTP_PASSWORD = os.Getenv("SMTP_PASSWORD")
+	SMTP_FROM     = os.Getenv("SMTP_FROM")
+)
+
+// -------------- Structs --------------
+
+// Message - An email message
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender - Delivers email messages
+type Sender interface {
+	Send(msg *Message) error
+}
+
+// NewSender - Create the configured sender, falling back to logging messages when SMTP is not set up
+func NewSender() Sender {
+	if SMTP_HOST == "" {
+		log.Println("SMTP_HOST is not set, emails will be logged instead of sent")
+		return &logSender{}
+	}
+	port := SMTP_PORT
+	if port == "" {
+		port = "587"
+	}
+	var auth smtp.Auth
+	if SMTP_USERNAME != "" {
+		auth = smtp.PlainAuth("", SMTP_USERNAME, SMTP_PASSWORD, SMTP_HOST)
+	}
+	return &smtpSender{
+		addr: SMTP_HOST + ":" + port,
+		from: SMTP_FROM,
+		auth: auth,
+	}
+}
+
+// -------------- SMTP --------------
+
+// smtpSender - Sends email through an SMTP relay
+type smtpSender struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// Send - Send a message through the SMTP relay
+func (s *smtpSender) Send(msg *Message) error {
+	var b strings.Builder
+	b.WriteString("From: " + s.from + "\r\n")
+	b.WriteString("To: " + msg.To + "\r\n")
+	b.WriteString("Subject: " + msg.Subject + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(msg.Body)
+	return smtp.SendMail(s.addr, s.auth, s.from, []string{msg.To}, []byte(b.String()))
+}
+
+// -------------- Log --------------
+
+// logSender - Writes messages to the log, useful for local development
+type logSender struct{}
+
+// Send - Log the message
+func (s *logSender) Send(msg *Message) error {
+	log.Printf("Email to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// -------------- Capture --------------
+
+// CaptureSender - Keeps messages in memory instead of sending them, for tests
+type CaptureSender struct {
+	mu       sync.Mutex
+	Messages []*Message
+}
+
+// NewCaptureSender - Create a new capture sender
+func NewCaptureSender() *CaptureSender {
+	return &CaptureSender{}
+}
+
+// Send - Capture the message
+func (s *CaptureSender) Send(msg *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Messages = append(s.Messages, msg)
+	return nil
+}
+
+// Last - Get the most recently captured message sent to an address
+func (s *CaptureSender) Last(to string) *Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.Messages) - 1; i >= 0; i-- {
+		if s.Messages[i].To == to {
+			return s.Messages[i]
+		}
+	}
+	return nil
+}
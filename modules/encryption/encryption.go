@@ -4,6 +4,7 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"errors"
 )
 
 // -------------- Globals --------------
@@ -12,8 +13,12 @@ import (
 var (
 	IV_LENGTH  = 16
 	KEY_LENGTH = IV_LENGTH * 8
+	// TAG_LENGTH length of the GCM authentication tag at the end of the encrypted data
+	TAG_LENGTH = 16
 )
 
+var ErrCiphertextTooShort = errors.New("encrypted data is too short")
+
 // -------------- Functions --------------
 
 // EncryptAES encrypts a string using AES, returns the encrypted byte array with the IV added to the end
@@ -48,6 +53,10 @@ func EncryptAES(input []byte, key string) ([]byte, error) {
 // DecryptAES decrypts a byte array using AES, returns the decrypted byte array
 // Uses AES/GCM/NoPadding
 func DecryptAES(input []byte, key string) ([]byte, error) {
+	if len(input) < TAG_LENGTH+IV_LENGTH {
+		return nil, ErrCiphertextTooShort
+	}
+
 	// Get IV
 	encryptedData := make([]byte, len(input)-IV_LENGTH)
 	initializationVector := make([]byte, IV_LENGTH)
@@ -0,0 +1,135 @@
+package encryption
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// -------------- Globals --------------
+
+//goland:noinspection GoSnakeCaseUsage
+var (
+	DATA_KEY_LENGTH = 32
+)
+
+var (
+	ErrNoKeys         = errors.New("key ring has no keys")
+	ErrInvalidKeyRing = errors.New("key ring must be a comma separated list of version:base64key")
+	ErrInvalidKey     = errors.New("keys must be 16, 24 or 32 bytes")
+	ErrUnknownVersion = errors.New("no key with that version in the key ring")
+)
+
+// -------------- Structs --------------
+
+// KeyRing versioned key-encryption keys, data keys are wrapped with the newest one
+type KeyRing struct {
+	keys    map[int]string
+	current int
+}
+
+// DataKey a per-record key used to encrypt data, stored wrapped by a key in the key ring
+type DataKey struct {
+	Version int
+	Wrapped []byte
+	key     string
+}
+
+// -------------- Functions --------------
+
+// NewKeyRing creates a key ring, the key with the highest version is used for new data keys
+func NewKeyRing(keys map[int]string) (*KeyRing, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	ring := &KeyRing{keys: keys}
+	for version, key := range keys {
+		switch len(key) {
+		case 16, 24, 32:
+		default:
+			return nil, ErrInvalidKey
+		}
+		if version > ring.current {
+			ring.current = version
+		}
+	}
+	return ring, nil
+}
+
+// ParseKeyRing parses a key ring from configuration, e.g. "1:base64key,2:base64key"
+func ParseKeyRing(config string) (*KeyRing, error) {
+	keys := map[int]string{}
+	for _, entry := range strings.Split(config, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		rawVersion, rawKey, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, ErrInvalidKeyRing
+		}
+		version, err := strconv.Atoi(rawVersion)
+		if err != nil || version < 1 {
+			return nil, ErrInvalidKeyRing
+		}
+		key, err := base64.StdEncoding.DecodeString(rawKey)
+		if err != nil {
+			return nil, ErrInvalidKeyRing
+		}
+		keys[version] = string(key)
+	}
+	return NewKeyRing(keys)
+}
+
+// CurrentVersion gets the version of the key new data keys are wrapped with
+func (k *KeyRing) CurrentVersion() int {
+	return k.current
+}
+
+// NewDataKey creates a random data key wrapped with the current key
+func (k *KeyRing) NewDataKey() (*DataKey, error) {
+	key := make([]byte, DATA_KEY_LENGTH)
+	_, err := rand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := EncryptAES(key, k.keys[k.current])
+	if err != nil {
+		return nil, err
+	}
+	return &DataKey{Version: k.current, Wrapped: wrapped, key: string(key)}, nil
+}
+
+// OpenDataKey unwraps a stored data key with the key of the version it was wrapped with
+func (k *KeyRing) OpenDataKey(version int, wrapped []byte) (*DataKey, error) {
+	kek, ok := k.keys[version]
+	if !ok {
+		return nil, ErrUnknownVersion
+	}
+	key, err := DecryptAES(wrapped, kek)
+	if err != nil {
+		return nil, err
+	}
+	return &DataKey{Version: version, Wrapped: wrapped, key: string(key)}, nil
+}
+
+// Rewrap wraps a data key with the current key, the data it encrypts doesn't change
+func (k *KeyRing) Rewrap(dataKey *DataKey) (*DataKey, error) {
+	wrapped, err := EncryptAES([]byte(dataKey.key), k.keys[k.current])
+	if err != nil {
+		return nil, err
+	}
+	return &DataKey{Version: k.current, Wrapped: wrapped, key: dataKey.key}, nil
+}
+
+// Encrypt encrypts data with the data key
+func (d *DataKey) Encrypt(input []byte) ([]byte, error) {
+	return EncryptAES(input, d.key)
+}
+
+// Decrypt decrypts data with the data key
+func (d *DataKey) Decrypt(input []byte) ([]byte, error) {
+	return DecryptAES(input, d.key)
+}
@@ -6,7 +6,6 @@ import (
 	"strconv"
 
 	mw "github.com/NeuralNexusDev/neuralnexus-api/middleware"
-	"github.com/NeuralNexusDev/neuralnexus-api/modules/auth"
 	perms "github.com/NeuralNexusDev/neuralnexus-api/modules/auth/permissions"
 	"github.com/NeuralNexusDev/neuralnexus-api/responses"
 )
@@ -14,12 +13,6 @@ import (
 // CreatePetHandler - Create a new pet
 func CreatePetHandler(s PetPicService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		session := r.Context().Value(mw.SessionKey).(auth.Session)
-		if !session.HasPermission(perms.ScopeAdminPetPictures) {
-			responses.Forbidden(w, r, "You do not have permission to create a pet")
-			return
-		}
-
 		petName := r.PathValue("name")
 		if petName == "" {
 			var pet Pet
@@ -87,8 +80,8 @@ func UpdatePetHandler(s PetPicService) http.HandlerFunc {
 			return
 		}
 
-		session := r.Context().Value(mw.SessionKey).(auth.Session)
-		if !session.HasPermission(perms.ScopePetPictures(pet.Name)) {
+		session, ok := mw.GetSession(r.Context())
+		if !ok || !session.HasPermission(perms.ScopePetPictures(pet.Name).WithVerb(perms.VerbWrite)) {
 			responses.Forbidden(w, r, "You do not have permission to update this pet")
 			return
 		}
@@ -172,8 +165,8 @@ func UpdatePetPictureHandler(s PetPicService) http.HandlerFunc {
 			return
 		}
 
-		session := r.Context().Value(mw.SessionKey).(auth.Session)
-		if !session.HasPermission(perms.ScopePetPictures(pet.Name)) {
+		session, ok := mw.GetSession(r.Context())
+		if !ok || !session.HasPermission(perms.ScopePetPictures(pet.Name).WithVerb(perms.VerbWrite)) {
 			responses.Forbidden(w, r, "You do not have permission to update this pet")
 			return
 		}
@@ -218,8 +211,8 @@ func DeletePetPictureHandler(s PetPicService) http.HandlerFunc {
 			return
 		}
 
-		session := r.Context().Value(mw.SessionKey).(auth.Session)
-		if !session.HasPermission(perms.ScopePetPictures(pet.Name)) {
+		session, ok := mw.GetSession(r.Context())
+		if !ok || !session.HasPermission(perms.ScopePetPictures(pet.Name).WithVerb(perms.VerbWrite)) {
 			responses.Forbidden(w, r, "You do not have permission to update this pet")
 			return
 		}
@@ -29,7 +29,7 @@ const (
 )
 
 // HandleEventSub handles the EventSub notifications
-func HandleEventSub(eventsub EventSubService, tokens auth.OAuthTokenStore, linked auth.LinkAccountStore) http.HandlerFunc {
+func HandleEventSub(eventsub EventSubService, tokens auth.OAuthTokenService, linked auth.LinkAccountStore, codes auth.LinkCodeService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Header.Get(EventSubMessageType) == "" {
 			mw.LogRequest(r.Context(), "EventSub message type not set")
@@ -58,11 +58,11 @@ func HandleEventSub(eventsub EventSubService, tokens auth.OAuthTokenStore, linke
 		var messageType = strings.ToLower(r.Header.Get(EventSubMessageType))
 		switch messageType {
 		case EventSubTypeRevocation:
-			err = handleRevocation(r.Context(), userId, eventsub, tokens, *vals)
+			err = handleRevocation(r.Context(), userId, eventsub, tokens, *vals, linked)
 		case EventSubTypeVerification:
 			err = handleVerification(w, r.Context(), userId, eventsub, *vals)
 		case EventSubTypeNotification:
-			err = handleNotification(r.Context(), userId, eventsub, tokens, *vals, linked)
+			err = handleNotification(r.Context(), userId, eventsub, tokens, *vals, linked, codes)
 		default:
 			mw.LogRequest(r.Context(), userId, "Unexpected EventSub message type:", messageType)
 			responses.BadRequest(w, r, "")
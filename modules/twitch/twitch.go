@@ -79,3 +79,15 @@ func GetUser(token *auth.OAuthToken) (*Data, error) {
 	user := &users.Data.Users[0]
 	return &Data{user}, nil
 }
+
+// NewUserClient creates a Helix client acting as a user, with a token from their stored platform token
+func NewUserClient(ts oauth2.TokenSource) (*helix.Client, error) {
+	token, err := ts.Token()
+	if err != nil {
+		return nil, err
+	}
+	return helix.NewClient(&helix.Options{
+		ClientID:        CLIENT_ID,
+		UserAccessToken: token.AccessToken,
+	})
+}
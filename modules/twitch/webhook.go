@@ -40,12 +40,16 @@ func validateEventSubNotification(header http.Header, body []byte) (*eventSubNot
 }
 
 // handleRevocation handles the EventSub revocation notifications
-func handleRevocation(ctx context.Context, userId string, eventsub EventSubService, tokens auth.OAuthTokenStore, vals eventSubNotification) error {
+func handleRevocation(ctx context.Context, userId string, eventsub EventSubService, tokens auth.OAuthTokenService, vals eventSubNotification, linked auth.LinkAccountStore) error {
 	var err error
 	switch vals.Subscription.Status {
 	case helix.EventSubStatusAuthorizationRevoked:
 		mw.LogRequest(ctx, userId, "EventSub authorization revoked")
-		err = tokens.DeleteOAuthToken(vals.Subscription.Condition.BroadcasterUserID, auth.PlatformTwitch)
+		// Tokens are stored under the linked user, not the Twitch user
+		la, err := linked.GetLinkedAccountByPlatformID(auth.PlatformTwitch, vals.Subscription.Condition.BroadcasterUserID)
+		if err == nil {
+			err = tokens.DeleteToken(la.UserID, auth.PlatformTwitch)
+		}
 		if err != nil {
 			mw.LogRequest(ctx, userId, "Failed to delete OAuth token:", err.Error())
 			return errors.New("failed to delete OAuth token")
@@ -86,12 +90,12 @@ func handleVerification(w http.ResponseWriter, ctx context.Context, userId strin
 }
 
 // handleNotification handles the EventSub notifications
-func handleNotification(ctx context.Context, userId string, eventsub EventSubService, tokens auth.OAuthTokenStore, vals eventSubNotification, linked auth.LinkAccountStore) error {
+func handleNotification(ctx context.Context, userId string, eventsub EventSubService, tokens auth.OAuthTokenService, vals eventSubNotification, linked auth.LinkAccountStore, codes auth.LinkCodeService) error {
 	var err error
 	mw.LogRequest(ctx, userId, "EventSub notification type:", vals.Subscription.Type)
 	switch vals.Subscription.Type {
 	case helix.EventSubTypeChannelChatMessage:
-		err = handleChannelChatMessage(ctx, userId, eventsub, tokens, vals, linked)
+		err = handleChannelChatMessage(ctx, userId, eventsub, tokens, vals, linked, codes)
 	default:
 		mw.LogRequest(ctx, userId, "EventSub unknown notification type:", vals.Subscription.Type)
 		return errors.New("unknown EventSub notification type")
@@ -104,7 +108,7 @@ func handleNotification(ctx context.Context, userId string, eventsub EventSubSer
 }
 
 // handleChannelChatMessage handles the EventSub chat message notifications
-func handleChannelChatMessage(ctx context.Context, userId string, eventsub EventSubService, tokens auth.OAuthTokenStore, vals eventSubNotification, linked auth.LinkAccountStore) error {
+func handleChannelChatMessage(ctx context.Context, userId string, eventsub EventSubService, tokens auth.OAuthTokenService, vals eventSubNotification, linked auth.LinkAccountStore, codes auth.LinkCodeService) error {
 	var err error
 	var chatEvent helix.EventSubChannelChatMessageEvent
 	err = json.NewDecoder(bytes.NewReader(vals.Event)).Decode(&chatEvent)
@@ -124,58 +128,36 @@ func handleChannelChatMessage(ctx context.Context, userId string, eventsub Event
 		// return errors.New("chat message does not contain a command")
 	}
 	switch args[0] {
-	// !link platform platformNameOrId
+	// !link platform code, the code comes from the platform, e.g. a Minecraft server plugin
 	case "link":
-		fromPlatform := auth.PlatformTwitch
-		fromPlatformId := chatEvent.ChatterUserID
-
-		toPlatform := auth.Platform(args[1])
-		toPlatformId := args[2]
-
-		if toPlatform == auth.PlatformMinecraft {
-			fromLinkedAccount, _ := linked.GetLinkedAccountByPlatformID(fromPlatform, fromPlatformId)
-			alreadyLinkedAccount, _ := linked.GetLinkedAccountByUserID(fromLinkedAccount.UserID, toPlatform)
-			toLinkedAccount, _ := linked.GetLinkedAccountByPlatformName(toPlatform, toPlatformId)
-
-			// Logic Matrix:
-			// 1. The Twitch user is already linked to this Minecraft account
-			// 2. The Twitch user is already linked to another Minecraft account
-
-			if fromLinkedAccount != nil && toLinkedAccount != nil && fromLinkedAccount.UserID == toLinkedAccount.UserID {
-				mw.LogRequest(ctx, userId, "Minecraft account is already linked to this user:", toLinkedAccount.PlatformUsername)
-				// return errors.New("user is already linked to Minecraft account")
-				// TODO: Reply with Twitch API
-				return nil
-			} else if fromLinkedAccount != nil && alreadyLinkedAccount != nil {
-				if alreadyLinkedAccount.PlatformUsername == toLinkedAccount.PlatformUsername {
-					mw.LogRequest(ctx, userId, "Minecraft account is already linked to this user:", alreadyLinkedAccount.PlatformUsername)
-					// return errors.New("user is already linked to Minecraft account")
-				}
-			} else if toLinkedAccount != nil {
-				mw.LogRequest(ctx, userId, "Minecraft account is already linked to another user:", toLinkedAccount.PlatformUsername)
-				// return errors.New("user is already linked to Minecraft account")
-				// TODO: Reply with Twitch API
-				return nil
-			} else if fromLinkedAccount != nil && fromLinkedAccount.Platform != fromPlatform {
-			}
+		if len(args) < 3 {
+			mw.LogRequest(ctx, userId, "Link command is missing the platform or code")
+			// TODO: Reply with Twitch API
+			return nil
+		}
+		toPlatform := auth.Platform(strings.ToLower(args[1]))
+		if toPlatform != auth.PlatformMinecraft {
+			mw.LogRequest(ctx, userId, "Unsupported platform for linking:", string(toPlatform))
+			// TODO: Reply with Twitch API
+			return nil
+		}
 
-			// Check if the user is already linked to a Minecraft account
-			if fromLinkedAccount != nil {
-				tla, _ := linked.GetLinkedAccountByUserID(fromLinkedAccount.UserID, toPlatform)
-				if tla != nil {
-					mw.LogRequest(ctx, userId, "User is already linked to a Minecraft account:", tla.PlatformUsername)
-					// return errors.New("user is already linked to Minecraft account")
-					// TODO: Reply with Twitch API
-					return nil
-				}
-			}
+		fromLinkedAccount, err := linked.GetLinkedAccountByPlatformID(auth.PlatformTwitch, chatEvent.ChatterUserID)
+		if err != nil {
+			mw.LogRequest(ctx, userId, "Twitch user has not signed in, so there is no account to link to:", chatEvent.ChatterUserLogin)
+			// TODO: Reply with Twitch API
+			return nil
+		}
 
-		} else {
-			mw.LogRequest(ctx, userId, "Unsupported platform for linking:", string(toPlatform))
-			// return errors.New("unsupported platform for linking")
+		la, err := codes.RedeemPlatformCode(args[2], toPlatform, fromLinkedAccount.UserID)
+		if err != nil {
+			mw.LogRequest(ctx, userId, "Failed to link Minecraft account:", err.Error())
 			// TODO: Reply with Twitch API
 			return nil
 		}
+		mw.LogRequest(ctx, userId, "Linked Minecraft account:", la.PlatformUsername)
+		// TODO: Reply with Twitch API
+		return nil
 	}
 
 	log.Printf("User %s sent a chat message in channel %s: %s\n", chatEvent.ChatterUserID, chatEvent.BroadcasterUserID, chatEvent.Message.Text)
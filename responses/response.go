@@ -144,6 +144,20 @@ func NotFound(w http.ResponseWriter, r *http.Request, message string) {
 	).SendProblem(w, r)
 }
 
+// Conflict -- Send a ConflictResponse as JSON or XML
+func Conflict(w http.ResponseWriter, r *http.Request, message string) {
+	if message == "" {
+		message = "The request conflicts with the current state of the resource."
+	}
+	NewProblem(
+		"about:blank",
+		http.StatusConflict,
+		"Conflict",
+		message,
+		"https://developer.mozilla.org/en-US/docs/Web/HTTP/Status/409",
+	).SendProblem(w, r)
+}
+
 // TooManyRequests -- Send a TooManyRequestsResponse as JSON or XML
 func TooManyRequests(w http.ResponseWriter, r *http.Request, retryAfter int, message string) {
 	if message == "" {